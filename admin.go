@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/rs/zerolog/log"
+
+	"tracer/internal/config"
+)
+
+// newAdminServer exposes the pprof profiles (cpu, heap, goroutine, block,
+// mutex, ...) under /debug/pprof/ on their own listener, away from the API
+// and its middleware
+func newAdminServer(cfg config.ServerConfig) *http.Server {
+	runtime.SetBlockProfileRate(cfg.BlockProfileRate)
+	runtime.SetMutexProfileFraction(cfg.MutexProfileFraction)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// No write timeout, since CPU profiles and traces take as long as asked
+	return &http.Server{Addr: cfg.AdminAddr, Handler: mux, ReadHeaderTimeout: cfg.ReadHeaderTimeout}
+}
+
+// serveAdmin starts srv in the background, reporting to failed if it stops
+// serving before it is closed
+func serveAdmin(srv *http.Server, failed chan<- error) {
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			failed <- fmt.Errorf("start admin server: %w", err)
+		}
+	}()
+	log.Info().Str("addr", srv.Addr).Msg("Admin server started")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+
+	"tracer/internal/config"
+	"tracer/internal/telemetry"
+)
+
+// newRootCommand builds the CLI. Run without a subcommand it serves the
+// API, so existing deployments keep working unchanged.
+func newRootCommand() *cobra.Command {
+	var configPath string
+
+	loadConfig := func() config.Config {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid configuration")
+		}
+		return cfg
+	}
+
+	serve := func(*cobra.Command, []string) error {
+		return runServer(loadConfig())
+	}
+
+	root := &cobra.Command{
+		Use:           "tracer",
+		Short:         "Users API traced end to end with OpenTelemetry",
+		Args:          cobra.NoArgs,
+		RunE:          serve,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&configPath, "config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "serve",
+			Short: "Serve the REST, gRPC and admin APIs",
+			Args:  cobra.NoArgs,
+			RunE:  serve,
+		},
+		newMigrateCommand(loadConfig),
+		newSeedCommand(loadConfig),
+		newLoadgenCommand(loadConfig),
+	)
+	return root
+}
+
+// initCommandTelemetry sets up logging and tracing for a command other than
+// serve, reporting as a service of its own so it stands apart from the API in
+// Jaeger. Logs only go to stdout. The returned function flushes both.
+func initCommandTelemetry(cfg config.Config, service string) func() {
+	cfg.Tracing.ServiceName = service
+	cfg.Logging.File = ""
+
+	resources, err := telemetry.NewResource(cfg.Tracing)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create resource")
+	}
+
+	closeLogs, err := telemetry.SetupLogging(cfg.Logging, resources)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up logging")
+	}
+
+	shutdownTracer, err := telemetry.InitTracer(cfg.Tracing, cfg.Profiling, resources)
+	if err != nil {
+		closeLogs()
+		log.Fatal().Err(err).Msg("Failed to create exporter")
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracer(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to shutdown TracerProvider")
+		}
+		closeLogs()
+	}
+}
+
+// connectMongo opens a client for a short-lived command, tracing every
+// MongoDB command as a child span
+func connectMongo(cfg config.Config) (*mongo.Client, error) {
+	clientOpts := options.Client().
+		ApplyURI(cfg.Mongo.URI).
+		SetMonitor(otelmongo.NewMonitor()).
+		SetConnectTimeout(cfg.Mongo.ConnectTimeout).
+		SetServerSelectionTimeout(cfg.Mongo.ServerSelectionTimeout)
+	client, err := mongo.Connect(context.Background(), clientOpts)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MongoDB: %w", err)
+	}
+	return client, nil
+}
+
+func disconnectMongo(client *mongo.Client, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := client.Disconnect(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to disconnect from MongoDB")
+	}
+}
@@ -0,0 +1,136 @@
+// Command events-consumer is an example subscriber for the user events the
+// API publishes to NATS JetStream. It continues each event's trace from the
+// message headers, so a request and its downstream processing show up as
+// one trace in Jaeger.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/config"
+	"tracer/internal/downstream"
+	"tracer/internal/service"
+	"tracer/internal/telemetry"
+)
+
+func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+	if cfg.NATS.URL == "" {
+		log.Fatal().Msg("nats.url must be set")
+	}
+
+	// Report as a service of its own, next to the API in Jaeger
+	cfg.Tracing.ServiceName = cfg.NATS.Consumer
+	cfg.Logging.File = cfg.NATS.Consumer + ".log"
+
+	resources, err := telemetry.NewResource(cfg.Tracing)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create resource")
+	}
+
+	closeLogs, err := telemetry.SetupLogging(cfg.Logging, resources)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up logging")
+	}
+	defer closeLogs()
+
+	shutdownTracer, err := telemetry.InitTracer(cfg.Tracing, cfg.Profiling, resources)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create exporter")
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracer(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to shutdown TracerProvider")
+		}
+	}()
+	tracer := telemetry.NewTracer()
+
+	conn, err := downstream.ConnectNATS(cfg.NATS.URL, cfg.NATS.Consumer)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to NATS")
+	}
+	defer conn.Drain()
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create JetStream context")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Durable, so a restarted consumer picks up where it left off
+	consumer, err := js.CreateOrUpdateConsumer(ctx, cfg.NATS.Stream, jetstream.ConsumerConfig{
+		Durable:       cfg.NATS.Consumer,
+		FilterSubject: cfg.NATS.Subject + ".>",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create consumer")
+	}
+
+	consumeCtx, err := consumer.Consume(func(msg jetstream.Msg) {
+		handle(tracer, msg)
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to consume events")
+	}
+	defer consumeCtx.Stop()
+
+	log.Info().Str("stream", cfg.NATS.Stream).Str("consumer", cfg.NATS.Consumer).Msg("Consuming user events")
+	<-ctx.Done()
+	log.Info().Msg("Shutting down consumer")
+}
+
+// handle continues the publisher's trace with a consumer span, logs the
+// event and acknowledges it. Events that cannot be decoded are terminated
+// instead of being redelivered forever.
+func handle(tracer telemetry.Tracer, msg jetstream.Msg) {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), downstream.NATSHeaderCarrier(msg.Headers()))
+	ctx, span := tracer.Start(ctx, msg.Subject()+" process", trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.MessagingSystemKey.String("nats"),
+		semconv.MessagingSourceNameKey.String(msg.Subject()),
+		semconv.MessagingOperationProcess,
+	)
+
+	var event service.UserEvent
+	if err := json.Unmarshal(msg.Data(), &event); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		log.Ctx(ctx).Error().Err(err).Str("subject", msg.Subject()).Msg("Failed to decode event")
+		if err := msg.Term(); err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Failed to terminate message")
+		}
+		return
+	}
+
+	span.SetAttributes(semconv.MessagingMessageIDKey.String(event.ID))
+	log.Ctx(ctx).Info().Str("eventId", event.ID).Str("type", event.Type).Str("userId", event.User.ID.Hex()).Msg("User event received")
+
+	if err := msg.Ack(); err != nil {
+		span.RecordError(err)
+		log.Ctx(ctx).Error().Err(err).Msg("Failed to acknowledge event")
+	}
+}
@@ -0,0 +1,83 @@
+// Package buildinfo describes the running binary. Release builds set the
+// values with -ldflags, for example
+//
+//	go build -ldflags "-X tracer/internal/buildinfo.version=1.4.0 \
+//		-X tracer/internal/buildinfo.commit=$(git rev-parse HEAD) \
+//		-X tracer/internal/buildinfo.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Values left unset fall back to what the Go toolchain stamped into the
+// binary, so plain go build and go install still report the commit.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	sdk "go.opentelemetry.io/otel/sdk"
+)
+
+// Set with -ldflags -X
+var (
+	version   string
+	commit    string
+	buildTime string
+)
+
+// Info is what GET /version reports
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	// Without -ldflags, the time of the commit rather than of the build
+	BuildTime string `json:"buildTime,omitempty"`
+	// The working tree had uncommitted changes at build time
+	Modified    bool   `json:"modified,omitempty"`
+	GoVersion   string `json:"goVersion"`
+	OTelVersion string `json:"otelVersion"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the build info, read once
+func Get() Info {
+	once.Do(func() {
+		info = Info{
+			Version:     version,
+			Commit:      commit,
+			BuildTime:   buildTime,
+			GoVersion:   runtime.Version(),
+			OTelVersion: sdk.Version(),
+		}
+
+		if build, ok := debug.ReadBuildInfo(); ok {
+			if info.Version == "" && build.Main.Version != "(devel)" {
+				info.Version = build.Main.Version
+			}
+			for _, setting := range build.Settings {
+				switch setting.Key {
+				case "vcs.revision":
+					if info.Commit == "" {
+						info.Commit = setting.Value
+					}
+				case "vcs.time":
+					if info.BuildTime == "" {
+						info.BuildTime = setting.Value
+					}
+				case "vcs.modified":
+					info.Modified = setting.Value == "true"
+				}
+			}
+		}
+
+		if info.Version == "" {
+			info.Version = "dev"
+		}
+		if info.Commit == "" {
+			info.Commit = "unknown"
+		}
+	})
+	return info
+}
@@ -0,0 +1,1337 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MetricsExporterPrometheus = "prometheus"
+	MetricsExporterOTLP       = "otlp"
+)
+
+const (
+	TraceExporterOTLP     = "otlp"
+	TraceExporterOTLPHTTP = "otlphttp"
+	TraceExporterZipkin   = "zipkin"
+	TraceExporterStdout   = "stdout"
+	TraceExporterFile     = "file"
+)
+
+const (
+	PropagatorTraceContext = "tracecontext"
+	PropagatorBaggage      = "baggage"
+	PropagatorB3           = "b3"
+	PropagatorB3Multi      = "b3multi"
+	PropagatorJaeger       = "jaeger"
+)
+
+// Levels accepted for logging.level
+var LogLevels = []string{"trace", "debug", "info", "warn", "error"}
+
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIDRatio            = "traceidratio"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+	SamplerRules                   = "rules"
+)
+
+const (
+	JobsBackendMemory = "memory"
+	JobsBackendMongo  = "mongo"
+)
+
+// Deployment environments. Production turns off the debugging aids.
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+const (
+	FlagSourceConfig = "config"
+	FlagSourceMongo  = "mongo"
+)
+
+const (
+	TenancyOff      = "off"
+	TenancyFilter   = "filter"
+	TenancyDatabase = "database"
+)
+
+const (
+	AuthModeNone   = "none"
+	AuthModeAPIKey = "apikey"
+	AuthModeBearer = "bearer"
+	AuthModeJWT    = "jwt"
+)
+
+type Config struct {
+	// dev, staging or prod. Picks the Gin mode and the default log level;
+	// prod also turns off payload logging, pprof and the API docs.
+	Env string `yaml:"env"`
+
+	// Settings the env turned off, so the caller can say so
+	Overridden []string `yaml:"-"`
+
+	Server    ServerConfig    `yaml:"server"`
+	Mongo     MongoConfig     `yaml:"mongo"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Health    HealthConfig    `yaml:"health"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Auth      AuthConfig      `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rateLimit"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Profiling ProfilingConfig `yaml:"profiling"`
+
+	EmailVerification EmailVerificationConfig `yaml:"emailVerification"`
+	Webhooks          WebhookConfig           `yaml:"webhooks"`
+	Kafka             KafkaConfig             `yaml:"kafka"`
+	NATS              NATSConfig              `yaml:"nats"`
+	Jobs              JobsConfig              `yaml:"jobs"`
+	Maintenance       MaintenanceConfig       `yaml:"maintenance"`
+	Migrations        MigrationsConfig        `yaml:"migrations"`
+	FeatureFlags      FeatureFlagsConfig      `yaml:"featureFlags"`
+	Tenancy           TenancyConfig           `yaml:"tenancy"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port"`
+	// Components stop within ShutdownTimeout, all together. Traces, metrics
+	// and logs are flushed after them within a budget of their own, so a
+	// slow drain cannot leave them no time.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	FlushTimeout    time.Duration `yaml:"flushTimeout"`
+	// Requests still running after this get 504, 0 disables it. Streaming
+	// routes are exempt.
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+	// Limits of the HTTP server against slow or oversized clients. Zero
+	// timeouts disable them; WriteTimeout does not apply to streaming routes.
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	MaxHeaderBytes    int           `yaml:"maxHeaderBytes"`
+	MaxPageSize       int64         `yaml:"maxPageSize"`
+	CollationLocale   string        `yaml:"collationLocale"`
+	// Port of the gRPC API, 0 disables it
+	GRPCPort int `yaml:"grpcPort"`
+	// How long responses to requests with an Idempotency-Key are replayed
+	IdempotencyTTL time.Duration `yaml:"idempotencyTtl"`
+	// Serve the Swagger UI and OpenAPI spec under /docs
+	Docs bool `yaml:"docs"`
+	// IPs or CIDRs of the proxies whose X-Forwarded-For is believed when
+	// finding the client IP. Empty trusts none and uses the peer address.
+	TrustedProxies []string `yaml:"trustedProxies"`
+
+	// Address of the pprof admin listener, empty disables it. Block and
+	// mutex profiles stay empty unless their sampling rates are set.
+	AdminAddr            string `yaml:"adminAddr"`
+	BlockProfileRate     int    `yaml:"blockProfileRate"`
+	MutexProfileFraction int    `yaml:"mutexProfileFraction"`
+
+	TLS ServerTLSConfig `yaml:"tls"`
+}
+
+// ServerTLSConfig serves the REST API over HTTPS when CertFile is set
+type ServerTLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// How often the files are checked for a rotated certificate, 0 loads
+	// them once at startup
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+	// Plain HTTP port that redirects to HTTPS, 0 disables it
+	RedirectPort int `yaml:"redirectPort"`
+}
+
+type MongoConfig struct {
+	URI              string        `yaml:"uri"`
+	Database         string        `yaml:"database"`
+	OperationTimeout time.Duration `yaml:"operationTimeout"`
+
+	// Connection pool limits; a MaxPoolSize of 0 means unlimited
+	MaxPoolSize     uint64        `yaml:"maxPoolSize"`
+	MinPoolSize     uint64        `yaml:"minPoolSize"`
+	MaxConnIdleTime time.Duration `yaml:"maxConnIdleTime"`
+	// How long to wait for a new connection and for a usable server
+	ConnectTimeout         time.Duration `yaml:"connectTimeout"`
+	ServerSelectionTimeout time.Duration `yaml:"serverSelectionTimeout"`
+
+	Breaker BreakerConfig `yaml:"breaker"`
+	Retry   RetryConfig   `yaml:"retry"`
+}
+
+// RetryConfig sets the backoff for reads that fail with transient errors
+type RetryConfig struct {
+	// Total attempts including the first, 1 disables retries
+	MaxAttempts int           `yaml:"maxAttempts"`
+	BaseDelay   time.Duration `yaml:"baseDelay"`
+	MaxDelay    time.Duration `yaml:"maxDelay"`
+}
+
+// BreakerConfig tunes the circuit breaker around user repository calls
+type BreakerConfig struct {
+	// Consecutive failures that open the breaker, 0 disables it
+	FailureThreshold uint32 `yaml:"failureThreshold"`
+	// How long the breaker stays open before letting trial requests through
+	OpenTimeout time.Duration `yaml:"openTimeout"`
+	// Trial requests allowed while half-open
+	HalfOpenRequests uint32 `yaml:"halfOpenRequests"`
+}
+
+type TracingConfig struct {
+	ServiceName string `yaml:"serviceName"`
+	// Defaults to the build version
+	ServiceVersion string `yaml:"serviceVersion"`
+
+	// Exporter is otlp (gRPC), otlphttp, zipkin, stdout or file. Endpoint is
+	// host:port or an http(s) URL for the OTLP exporters and the collector
+	// URL for zipkin. OTLP URLs are used with their path, and https turns
+	// on TLS.
+	Exporter     string   `yaml:"exporter"`
+	Endpoint     string   `yaml:"endpoint"`
+	File         string   `yaml:"file"`
+	ExcludePaths []string `yaml:"excludePaths"`
+
+	// Header formats read from callers and written to outgoing requests:
+	// tracecontext, baggage, b3 (single header), b3multi or jaeger
+	Propagators []string `yaml:"propagators"`
+	// Baggage members copied onto server spans and request log lines
+	BaggageKeys []string `yaml:"baggageKeys"`
+
+	// Sampler is one of the OTEL_TRACES_SAMPLER names always_on, always_off,
+	// traceidratio, parentbased_always_on, parentbased_always_off or
+	// parentbased_traceidratio, the last of which keeps SamplerRatio of new
+	// traces and follows the caller's decision. rules samples per route and
+	// keeps errors and slow requests.
+	Sampler      string  `yaml:"sampler"`
+	SamplerRatio float64 `yaml:"samplerRatio"`
+
+	// With the rules sampler, routes without a rule use SamplerRatio, and
+	// spans that fail or take at least SlowThreshold are always exported
+	SamplingRules []SamplingRule `yaml:"samplingRules"`
+	SlowThreshold time.Duration  `yaml:"slowThreshold"`
+
+	// Connection settings of the otlp and otlphttp exporters. Headers are
+	// sent with every export, e.g. the API key of a hosted backend.
+	TLS     OTLPTLSConfig     `yaml:"tls"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// OTLPTLSConfig secures the connection to the OTLP collector, which is
+// plaintext unless Enabled is set
+type OTLPTLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// PEM bundle of CAs trusted for the collector; empty uses the system pool
+	CAFile string `yaml:"caFile"`
+	// Client certificate and key for mTLS, set together or not at all
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// Overrides the name checked against the collector's certificate
+	ServerName string `yaml:"serverName"`
+}
+
+// SamplingRule sets the share of traces kept for a route, such as
+// GET /users/:id. An empty Method matches every method.
+type SamplingRule struct {
+	Method string  `yaml:"method"`
+	Route  string  `yaml:"route"`
+	Ratio  float64 `yaml:"ratio"`
+}
+
+// MetricsConfig selects between serving metrics for Prometheus to scrape and
+// pushing them to an OTLP collector
+type MetricsConfig struct {
+	Exporter string        `yaml:"exporter"`
+	Endpoint string        `yaml:"endpoint"`
+	Interval time.Duration `yaml:"interval"`
+
+	// Attach the trace ID of sampled requests to histogram buckets, so a
+	// latency spike links to a representative trace
+	Exemplars bool `yaml:"exemplars"`
+}
+
+type HealthConfig struct {
+	// Upper bound for all readiness checks together
+	Timeout time.Duration `yaml:"timeout"`
+	// Also require the OTLP collector to accept connections to be ready
+	CheckCollector bool `yaml:"checkCollector"`
+}
+
+type LoggingConfig struct {
+	// trace, debug, info, warn or error; PUT /admin/log-level changes it at runtime
+	Level string `yaml:"level"`
+	// Empty logs to stdout only
+	File       string            `yaml:"file"`
+	BufferSize int               `yaml:"bufferSize"`
+	Rotation   LogRotationConfig `yaml:"rotation"`
+
+	// Logs are also exported over OTLP when set
+	OTLPEndpoint string `yaml:"otlpEndpoint"`
+
+	AccessLog AccessLogConfig      `yaml:"accessLog"`
+	Payloads  PayloadLoggingConfig `yaml:"payloads"`
+}
+
+// AccessLogConfig controls the one-line-per-request access log
+type AccessLogConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Paths such as health probes that are not logged
+	ExcludePaths []string `yaml:"excludePaths"`
+}
+
+// LogRotationConfig starts a new log file once the current one reaches
+// MaxSizeMB. Old files are removed beyond MaxBackups or MaxAgeDays, where 0
+// keeps them.
+type LogRotationConfig struct {
+	MaxSizeMB  int  `yaml:"maxSizeMb"`
+	MaxBackups int  `yaml:"maxBackups"`
+	MaxAgeDays int  `yaml:"maxAgeDays"`
+	Compress   bool `yaml:"compress"`
+}
+
+// PayloadLoggingConfig controls capturing request and response bodies for
+// debugging. Fields named in RedactFields are masked at any depth.
+type PayloadLoggingConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	MaxBytes     int      `yaml:"maxBytes"`
+	RedactFields []string `yaml:"redactFields"`
+}
+
+type AuthConfig struct {
+	Mode        string    `yaml:"mode"`
+	Credentials []string  `yaml:"credentials"`
+	JWT         JWTConfig `yaml:"jwt"`
+
+	// Also accept X-API-Key values stored hashed in the api_keys collection.
+	// Not allowed in jwt mode, where stored keys would carry no roles.
+	MongoAPIKeys bool `yaml:"mongoApiKeys"`
+}
+
+// JWTConfig configures validation of HS256-signed tokens in jwt mode
+type JWTConfig struct {
+	SigningKey string `yaml:"signingKey"`
+	// Tokens must carry this iss claim when set
+	Issuer string `yaml:"issuer"`
+	// Clock skew tolerated when checking exp and nbf
+	Leeway time.Duration `yaml:"leeway"`
+}
+
+// RateLimitConfig sets token bucket limits per client IP and per
+// authenticated caller. A rate of 0 turns that limit off.
+type RateLimitConfig struct {
+	// Requests per second refilled into each bucket
+	PerIP  float64 `yaml:"perIp"`
+	PerKey float64 `yaml:"perKey"`
+	// Requests a client may make at once before being throttled
+	Burst int `yaml:"burst"`
+}
+
+// CORSConfig controls which browser origins may call the API. CORS is off
+// while AllowedOrigins is empty; "*" allows any origin.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowedOrigins"`
+	AllowedMethods   []string      `yaml:"allowedMethods"`
+	AllowedHeaders   []string      `yaml:"allowedHeaders"`
+	ExposedHeaders   []string      `yaml:"exposedHeaders"`
+	AllowCredentials bool          `yaml:"allowCredentials"`
+	MaxAge           time.Duration `yaml:"maxAge"`
+	// Preflight OPTIONS requests are not traced unless set
+	TracePreflight bool `yaml:"tracePreflight"`
+}
+
+// CacheConfig enables the Redis read-through cache for single-user reads
+// when RedisAddr is set
+type CacheConfig struct {
+	RedisAddr     string        `yaml:"redisAddr"`
+	RedisPassword string        `yaml:"redisPassword"`
+	RedisDB       int           `yaml:"redisDb"`
+	TTL           time.Duration `yaml:"ttl"`
+}
+
+// ProfilingConfig enables continuous profiling to Pyroscope when
+// ServerAddress is set
+type ProfilingConfig struct {
+	ServerAddress string `yaml:"serverAddress"`
+	// Label CPU samples with the span that was active, linking traces to profiles
+	SpanProfiles bool `yaml:"spanProfiles"`
+}
+
+// EmailVerificationConfig enables checking new email addresses against the
+// email verification service when URL is set
+type EmailVerificationConfig struct {
+	URL string `yaml:"url"`
+	// Per attempt
+	Timeout time.Duration `yaml:"timeout"`
+	Retry   RetryConfig   `yaml:"retry"`
+}
+
+// WebhookConfig posts user lifecycle events to URLs when any are set
+type WebhookConfig struct {
+	URLs []string `yaml:"urls"`
+	// Key for the HMAC-SHA256 signature on every payload
+	Secret string `yaml:"secret"`
+	// Per attempt
+	Timeout time.Duration `yaml:"timeout"`
+	Retry   RetryConfig   `yaml:"retry"`
+	// Deliveries waiting for a worker; events beyond this are dropped
+	QueueSize int `yaml:"queueSize"`
+	Workers   int `yaml:"workers"`
+}
+
+// KafkaConfig publishes user lifecycle events to Topic when Brokers is set
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+}
+
+// NATSConfig publishes user lifecycle events to JetStream when URL is set.
+// Consumer names the durable consumer of cmd/events-consumer.
+type NATSConfig struct {
+	URL      string `yaml:"url"`
+	Stream   string `yaml:"stream"`
+	Subject  string `yaml:"subject"`
+	Consumer string `yaml:"consumer"`
+}
+
+// JobsConfig sets up the background job queue. The memory backend runs jobs
+// in-process; the mongo backend persists them so they survive restarts.
+type JobsConfig struct {
+	Backend string `yaml:"backend"`
+	Workers int    `yaml:"workers"`
+	// Jobs the memory backend holds before refusing new ones
+	QueueSize int `yaml:"queueSize"`
+	// How often the mongo backend looks for due jobs when idle
+	PollInterval time.Duration `yaml:"pollInterval"`
+	// Total attempts per job; retries wait RetryDelay times the attempt number
+	MaxAttempts int           `yaml:"maxAttempts"`
+	RetryDelay  time.Duration `yaml:"retryDelay"`
+}
+
+// MaintenanceConfig schedules the housekeeping jobs. Schedules are cron
+// expressions or descriptors such as @daily; an empty schedule disables
+// the job.
+type MaintenanceConfig struct {
+	// Hard-delete users soft-deleted longer than PurgeRetention ago
+	PurgeSchedule  string        `yaml:"purgeSchedule"`
+	PurgeRetention time.Duration `yaml:"purgeRetention"`
+	// Recount users for the users.count gauge
+	StatsSchedule string `yaml:"statsSchedule"`
+	// Upper bound for a single run
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// MigrationsConfig controls the schema migrations. With OnStartup off they
+// only run through the migrate command.
+type MigrationsConfig struct {
+	OnStartup bool `yaml:"onStartup"`
+	// Upper bound for a run, including the wait for another replica's run.
+	// Also the lease on the lock, so a crashed run does not block the next.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// FeatureFlagsConfig sets where feature flags come from. A flag is on for
+// its rollout percentage of callers, from 0 to 100.
+type FeatureFlagsConfig struct {
+	// config uses Flags only; mongo reads the feature_flags collection and
+	// falls back to Flags for flags it does not define
+	Source string         `yaml:"source"`
+	Flags  map[string]int `yaml:"flags"`
+	// How long flags read from MongoDB are cached
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+}
+
+// TenancyConfig scopes users to the tenant a request acts for. In filter
+// mode tenants share the collections and every document carries a
+// tenantId; in database mode each tenant gets the database
+// DatabasePrefix + tenant. Requests without a tenant use the configured
+// database and only see documents without a tenantId.
+type TenancyConfig struct {
+	Mode string `yaml:"mode"`
+	// Header naming the tenant for callers whose credentials carry none
+	Header string `yaml:"header"`
+	// Tenants that may be picked with the header or baggage. A JWT tenant
+	// claim is trusted as is; any other tenant not listed is refused.
+	Allowed []string `yaml:"allowed"`
+	// Refuse requests that name no tenant
+	Required       bool   `yaml:"required"`
+	DatabasePrefix string `yaml:"databasePrefix"`
+}
+
+// Default returns the configuration matching the docker-compose setup
+func Default() Config {
+	return Config{
+		Env: EnvDev,
+		Server: ServerConfig{
+			Port:            8080,
+			ShutdownTimeout: 15 * time.Second,
+			FlushTimeout:    5 * time.Second,
+			RequestTimeout:  30 * time.Second,
+			// Long enough for the request timeout's 504 to be written
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			MaxPageSize:       100,
+			CollationLocale:   "en",
+			GRPCPort:          9090,
+			IdempotencyTTL:    24 * time.Hour,
+			Docs:              true,
+			TLS: ServerTLSConfig{
+				ReloadInterval: time.Minute,
+			},
+		},
+		Mongo: MongoConfig{
+			// No default URI: credentials must come from the config file or MONGO_URI
+			Database:         "testdb",
+			OperationTimeout: 5 * time.Second,
+			// Driver defaults
+			MaxPoolSize:            100,
+			ConnectTimeout:         30 * time.Second,
+			ServerSelectionTimeout: 30 * time.Second,
+			Breaker: BreakerConfig{
+				FailureThreshold: 5,
+				OpenTimeout:      30 * time.Second,
+				HalfOpenRequests: 1,
+			},
+			Retry: RetryConfig{
+				MaxAttempts: 3,
+				BaseDelay:   50 * time.Millisecond,
+				MaxDelay:    time.Second,
+			},
+		},
+		Tracing: TracingConfig{
+			ServiceName:   "gin-mongo-service",
+			Exporter:      TraceExporterOTLP,
+			Endpoint:      "localhost:4317",
+			File:          "traces.json",
+			ExcludePaths:  []string{"/healthz", "/readyz", "/livez", "/metrics"},
+			Propagators:   []string{PropagatorTraceContext, PropagatorBaggage},
+			BaggageKeys:   []string{"tenant.id", "caller.service"},
+			Sampler:       SamplerAlwaysOn,
+			SamplerRatio:  1,
+			SlowThreshold: 500 * time.Millisecond,
+		},
+		Metrics: MetricsConfig{
+			Exporter:  MetricsExporterPrometheus,
+			Endpoint:  "localhost:4317",
+			Interval:  15 * time.Second,
+			Exemplars: true,
+		},
+		Health: HealthConfig{
+			Timeout: 2 * time.Second,
+		},
+		Logging: LoggingConfig{
+			File:       "app.log",
+			BufferSize: 1000,
+			Rotation: LogRotationConfig{
+				MaxSizeMB:  100,
+				MaxBackups: 5,
+				MaxAgeDays: 30,
+				Compress:   true,
+			},
+			AccessLog: AccessLogConfig{
+				Enabled:      true,
+				ExcludePaths: []string{"/healthz", "/readyz", "/livez", "/metrics"},
+			},
+			Payloads: PayloadLoggingConfig{
+				MaxBytes:     4096,
+				RedactFields: []string{"email", "password", "token"},
+			},
+		},
+		Auth: AuthConfig{
+			Mode: AuthModeNone,
+			JWT: JWTConfig{
+				Leeway: 30 * time.Second,
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Burst: 20,
+		},
+		Cache: CacheConfig{
+			TTL: 5 * time.Minute,
+		},
+		Profiling: ProfilingConfig{
+			SpanProfiles: true,
+		},
+		Webhooks: WebhookConfig{
+			Timeout: 5 * time.Second,
+			Retry: RetryConfig{
+				MaxAttempts: 5,
+				BaseDelay:   time.Second,
+				MaxDelay:    30 * time.Second,
+			},
+			QueueSize: 1000,
+			Workers:   4,
+		},
+		Jobs: JobsConfig{
+			Backend:      JobsBackendMemory,
+			Workers:      4,
+			QueueSize:    1000,
+			PollInterval: 5 * time.Second,
+			MaxAttempts:  3,
+			RetryDelay:   10 * time.Second,
+		},
+		Maintenance: MaintenanceConfig{
+			PurgeSchedule:  "@daily",
+			PurgeRetention: 30 * 24 * time.Hour,
+			StatsSchedule:  "@every 5m",
+			Timeout:        time.Minute,
+		},
+		Migrations: MigrationsConfig{
+			OnStartup: true,
+			Timeout:   10 * time.Minute,
+		},
+		FeatureFlags: FeatureFlagsConfig{
+			Source:   FlagSourceConfig,
+			CacheTTL: 30 * time.Second,
+		},
+		Tenancy: TenancyConfig{
+			Mode:           TenancyOff,
+			Header:         "X-Tenant-ID",
+			DatabasePrefix: "tenant_",
+		},
+		Kafka: KafkaConfig{
+			Topic: "user-events",
+		},
+		NATS: NATSConfig{
+			Stream:   "USERS",
+			Subject:  "users",
+			Consumer: "user-events-consumer",
+		},
+		EmailVerification: EmailVerificationConfig{
+			Timeout: 2 * time.Second,
+			Retry: RetryConfig{
+				MaxAttempts: 3,
+				BaseDelay:   100 * time.Millisecond,
+				MaxDelay:    time.Second,
+			},
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-API-Key", "X-Request-ID", "If-Modified-Since", "If-None-Match", "If-Match", "Idempotency-Key", "X-Tenant-ID"},
+			ExposedHeaders: []string{"X-Request-ID", "Retry-After", "Last-Modified", "ETag", "Idempotent-Replayed"},
+			MaxAge:         10 * time.Minute,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path (if
+// any) and finally environment variables, then validates the result
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return cfg, fmt.Errorf("open config file: %w", err)
+		}
+		defer file.Close()
+
+		// Reject unknown keys so typos don't silently fall back to defaults
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	cfg.applyEnvProfile()
+
+	return cfg, cfg.Validate()
+}
+
+// applyEnvProfile fills in the log level when none is set, debug in dev
+// and info elsewhere. In prod it turns off the debugging aids whatever the
+// rest of the config says, and records which ones it overrode.
+func (c *Config) applyEnvProfile() {
+	if c.Logging.Level == "" {
+		c.Logging.Level = "info"
+		if c.Env == EnvDev {
+			c.Logging.Level = "debug"
+		}
+	}
+	if c.Env != EnvProd {
+		return
+	}
+
+	override := func(setting string, on bool, turnOff func()) {
+		if on {
+			turnOff()
+			c.Overridden = append(c.Overridden, setting)
+		}
+	}
+	override("logging.level", c.Logging.Level == "trace" || c.Logging.Level == "debug", func() { c.Logging.Level = "info" })
+	override("logging.payloads.enabled", c.Logging.Payloads.Enabled, func() { c.Logging.Payloads.Enabled = false })
+	override("server.adminAddr", c.Server.AdminAddr != "", func() { c.Server.AdminAddr = "" })
+	override("server.docs", c.Server.Docs, func() { c.Server.Docs = false })
+}
+
+// Validate reports every invalid setting at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Env == EnvDev || c.Env == EnvStaging || c.Env == EnvProd, "env: unknown environment %q, expected dev, staging or prod", c.Env)
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port: %d is not a valid port", c.Server.Port)
+	check(c.Server.ShutdownTimeout > 0, "server.shutdownTimeout: must be positive")
+	check(c.Server.FlushTimeout > 0, "server.flushTimeout: must be positive")
+	check(c.Server.RequestTimeout >= 0, "server.requestTimeout: must not be negative")
+	check(c.Server.ReadHeaderTimeout >= 0, "server.readHeaderTimeout: must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.writeTimeout: must not be negative")
+	check(c.Server.WriteTimeout == 0 || c.Server.RequestTimeout == 0 || c.Server.WriteTimeout > c.Server.RequestTimeout,
+		"server.writeTimeout: must exceed requestTimeout so timed out requests can still be answered")
+	check(c.Server.IdleTimeout >= 0, "server.idleTimeout: must not be negative")
+	check(c.Server.MaxHeaderBytes > 0, "server.maxHeaderBytes: must be positive")
+	check(c.Server.MaxPageSize > 0, "server.maxPageSize: must be positive")
+	check(c.Server.CollationLocale != "", "server.collationLocale: must not be empty")
+	check(c.Server.GRPCPort >= 0 && c.Server.GRPCPort <= 65535, "server.grpcPort: %d is not a valid port", c.Server.GRPCPort)
+	check(c.Server.GRPCPort != c.Server.Port, "server.grpcPort: must differ from server.port")
+	check(c.Server.IdempotencyTTL > 0, "server.idempotencyTtl: must be positive")
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "server.trustedProxies: %q is not an IP or CIDR", proxy)
+	}
+	check(c.Server.BlockProfileRate >= 0, "server.blockProfileRate: must not be negative")
+	check(c.Server.MutexProfileFraction >= 0, "server.mutexProfileFraction: must not be negative")
+	if tls := c.Server.TLS; tls.CertFile != "" || tls.KeyFile != "" {
+		check(tls.CertFile != "" && tls.KeyFile != "", "server.tls: certFile and keyFile must be set together")
+		check(tls.ReloadInterval >= 0, "server.tls.reloadInterval: must not be negative")
+		check(tls.RedirectPort >= 0 && tls.RedirectPort <= 65535, "server.tls.redirectPort: %d is not a valid port", tls.RedirectPort)
+		check(tls.RedirectPort != c.Server.Port, "server.tls.redirectPort: must differ from server.port")
+	} else {
+		check(tls.RedirectPort == 0, "server.tls.redirectPort: requires certFile and keyFile")
+	}
+
+	check(c.Mongo.URI != "", "mongo.uri: is required, set it in the config file or with MONGO_URI")
+	check(c.Mongo.Database != "", "mongo.database: must not be empty")
+	check(c.Mongo.OperationTimeout > 0, "mongo.operationTimeout: must be positive")
+	check(c.Mongo.MaxPoolSize == 0 || c.Mongo.MinPoolSize <= c.Mongo.MaxPoolSize, "mongo.minPoolSize: must not exceed maxPoolSize")
+	check(c.Mongo.MaxConnIdleTime >= 0, "mongo.maxConnIdleTime: must not be negative")
+	check(c.Mongo.ConnectTimeout > 0, "mongo.connectTimeout: must be positive")
+	check(c.Mongo.ServerSelectionTimeout > 0, "mongo.serverSelectionTimeout: must be positive")
+	check(c.Mongo.Retry.MaxAttempts > 0, "mongo.retry.maxAttempts: must be positive")
+	check(c.Mongo.Retry.BaseDelay >= 0, "mongo.retry.baseDelay: must not be negative")
+	check(c.Mongo.Retry.MaxDelay >= c.Mongo.Retry.BaseDelay, "mongo.retry.maxDelay: must not be less than baseDelay")
+	if c.Mongo.Breaker.FailureThreshold > 0 {
+		check(c.Mongo.Breaker.OpenTimeout > 0, "mongo.breaker.openTimeout: must be positive")
+		check(c.Mongo.Breaker.HalfOpenRequests > 0, "mongo.breaker.halfOpenRequests: must be positive")
+	}
+
+	check(c.Tracing.ServiceName != "", "tracing.serviceName: must not be empty")
+	switch c.Tracing.Exporter {
+	case TraceExporterOTLP, TraceExporterOTLPHTTP, TraceExporterZipkin:
+		check(c.Tracing.Endpoint != "", "tracing.endpoint: must not be empty")
+	case TraceExporterStdout:
+	case TraceExporterFile:
+		check(c.Tracing.File != "", "tracing.file: must not be empty")
+	default:
+		check(false, "tracing.exporter: unknown exporter %q, expected otlp, otlphttp, zipkin, stdout or file", c.Tracing.Exporter)
+	}
+
+	if c.Tracing.Exporter == TraceExporterOTLP || c.Tracing.Exporter == TraceExporterOTLPHTTP {
+		check(validOTLPEndpoint(c.Tracing.Endpoint), "tracing.endpoint: %q is neither host:port nor an http or https URL", c.Tracing.Endpoint)
+	}
+	if otlpTLS := c.Tracing.TLS; otlpTLS.Enabled {
+		check((otlpTLS.CertFile == "") == (otlpTLS.KeyFile == ""), "tracing.tls: certFile and keyFile must be set together")
+		check(!strings.HasPrefix(c.Tracing.Endpoint, "http://"), "tracing.tls: enabled but the endpoint is an http URL")
+	} else {
+		check(otlpTLS.CAFile == "" && otlpTLS.CertFile == "" && otlpTLS.KeyFile == "", "tracing.tls: files are set but enabled is false")
+	}
+
+	check(len(c.Tracing.Propagators) > 0, "tracing.propagators: must not be empty")
+	for _, name := range c.Tracing.Propagators {
+		switch name {
+		case PropagatorTraceContext, PropagatorBaggage, PropagatorB3, PropagatorB3Multi, PropagatorJaeger:
+		default:
+			check(false, "tracing.propagators: unknown propagator %q, expected tracecontext, baggage, b3, b3multi or jaeger", name)
+		}
+	}
+
+	switch c.Tracing.Sampler {
+	case SamplerAlwaysOn, SamplerAlwaysOff, SamplerParentBasedAlwaysOn, SamplerParentBasedAlwaysOff:
+	case SamplerTraceIDRatio, SamplerParentBasedTraceIDRatio:
+		check(c.Tracing.SamplerRatio >= 0 && c.Tracing.SamplerRatio <= 1, "tracing.samplerRatio: %g is not between 0 and 1", c.Tracing.SamplerRatio)
+	case SamplerRules:
+		check(c.Tracing.SamplerRatio >= 0 && c.Tracing.SamplerRatio <= 1, "tracing.samplerRatio: %g is not between 0 and 1", c.Tracing.SamplerRatio)
+		check(c.Tracing.SlowThreshold > 0, "tracing.slowThreshold: must be positive")
+		for i, rule := range c.Tracing.SamplingRules {
+			check(rule.Route != "", "tracing.samplingRules[%d].route: must not be empty", i)
+			check(rule.Ratio >= 0 && rule.Ratio <= 1, "tracing.samplingRules[%d].ratio: %g is not between 0 and 1", i, rule.Ratio)
+		}
+	default:
+		check(false, "tracing.sampler: unknown sampler %q, expected always_on, always_off, traceidratio, parentbased_always_on, parentbased_always_off, parentbased_traceidratio or rules", c.Tracing.Sampler)
+	}
+
+	switch c.Metrics.Exporter {
+	case MetricsExporterPrometheus:
+	case MetricsExporterOTLP:
+		check(c.Metrics.Endpoint != "", "metrics.endpoint: must not be empty")
+		check(validOTLPEndpoint(c.Metrics.Endpoint), "metrics.endpoint: %q is neither host:port nor an http or https URL", c.Metrics.Endpoint)
+		check(c.Metrics.Interval > 0, "metrics.interval: must be positive")
+	default:
+		check(false, "metrics.exporter: unknown exporter %q, expected prometheus or otlp", c.Metrics.Exporter)
+	}
+
+	check(c.Health.Timeout > 0, "health.timeout: must be positive")
+	check(!c.Health.CheckCollector || c.Tracing.Exporter == TraceExporterOTLP || c.Tracing.Exporter == TraceExporterOTLPHTTP,
+		"health.checkCollector: requires the otlp or otlphttp trace exporter")
+
+	check(slices.Contains(LogLevels, c.Logging.Level), "logging.level: unknown level %q, expected %s", c.Logging.Level, strings.Join(LogLevels, ", "))
+	check(c.Logging.OTLPEndpoint == "" || validOTLPEndpoint(c.Logging.OTLPEndpoint),
+		"logging.otlpEndpoint: %q is neither host:port nor an http or https URL", c.Logging.OTLPEndpoint)
+	check(c.Logging.BufferSize > 0, "logging.bufferSize: must be positive")
+	check(c.Logging.Rotation.MaxSizeMB > 0, "logging.rotation.maxSizeMb: must be positive")
+	check(c.Logging.Rotation.MaxBackups >= 0, "logging.rotation.maxBackups: must not be negative")
+	check(c.Logging.Rotation.MaxAgeDays >= 0, "logging.rotation.maxAgeDays: must not be negative")
+	check(c.Logging.Payloads.MaxBytes > 0, "logging.payloads.maxBytes: must be positive")
+
+	switch c.Auth.Mode {
+	case AuthModeNone:
+	case AuthModeAPIKey:
+		check(len(c.Auth.Credentials) > 0 || c.Auth.MongoAPIKeys, "auth.credentials: apikey authentication requires at least one credential or mongoApiKeys")
+	case AuthModeBearer:
+		check(len(c.Auth.Credentials) > 0, "auth.credentials: bearer authentication requires at least one credential")
+	case AuthModeJWT:
+		// HS256 keys shorter than the hash output weaken the signature
+		check(len(c.Auth.JWT.SigningKey) >= 32, "auth.jwt.signingKey: must be at least 32 bytes")
+		check(c.Auth.JWT.Leeway >= 0, "auth.jwt.leeway: must not be negative")
+		check(!c.Auth.MongoAPIKeys, "auth.mongoApiKeys: not supported in jwt mode, API keys carry no roles")
+	default:
+		check(false, "auth.mode: unknown mode %q, expected none, apikey, bearer or jwt", c.Auth.Mode)
+	}
+
+	check(c.RateLimit.PerIP >= 0, "rateLimit.perIp: must not be negative")
+	check(c.RateLimit.PerKey >= 0, "rateLimit.perKey: must not be negative")
+	check(c.RateLimit.Burst > 0, "rateLimit.burst: must be positive")
+
+	check(!c.CORS.AllowCredentials || !slices.Contains(c.CORS.AllowedOrigins, "*"),
+		"cors.allowCredentials: cannot be combined with the \"*\" origin")
+	check(c.CORS.MaxAge >= 0, "cors.maxAge: must not be negative")
+
+	check(c.Cache.TTL > 0, "cache.ttl: must be positive")
+
+	if c.EmailVerification.URL != "" {
+		check(c.EmailVerification.Timeout > 0, "emailVerification.timeout: must be positive")
+		check(c.EmailVerification.Retry.MaxAttempts > 0, "emailVerification.retry.maxAttempts: must be positive")
+		check(c.EmailVerification.Retry.MaxDelay >= c.EmailVerification.Retry.BaseDelay, "emailVerification.retry.maxDelay: must not be less than baseDelay")
+	}
+
+	switch c.Jobs.Backend {
+	case JobsBackendMemory:
+		check(c.Jobs.QueueSize > 0, "jobs.queueSize: must be positive")
+	case JobsBackendMongo:
+		check(c.Jobs.PollInterval > 0, "jobs.pollInterval: must be positive")
+	default:
+		check(false, "jobs.backend: unknown backend %q, expected memory or mongo", c.Jobs.Backend)
+	}
+	check(c.Jobs.Workers > 0, "jobs.workers: must be positive")
+	check(c.Jobs.MaxAttempts > 0, "jobs.maxAttempts: must be positive")
+	check(c.Jobs.RetryDelay >= 0, "jobs.retryDelay: must not be negative")
+
+	if c.Maintenance.PurgeSchedule != "" {
+		check(c.Maintenance.PurgeRetention > 0, "maintenance.purgeRetention: must be positive")
+	}
+	check(c.Maintenance.Timeout > 0, "maintenance.timeout: must be positive")
+	check(c.Migrations.Timeout > 0, "migrations.timeout: must be positive")
+
+	switch c.FeatureFlags.Source {
+	case FlagSourceConfig:
+	case FlagSourceMongo:
+		check(c.FeatureFlags.CacheTTL > 0, "featureFlags.cacheTTL: must be positive")
+	default:
+		check(false, "featureFlags.source: unknown source %q, expected config or mongo", c.FeatureFlags.Source)
+	}
+	for name, percent := range c.FeatureFlags.Flags {
+		check(percent >= 0 && percent <= 100, "featureFlags.flags.%s: %d is not a percentage from 0 to 100", name, percent)
+	}
+
+	switch c.Tenancy.Mode {
+	case TenancyOff, TenancyFilter:
+	case TenancyDatabase:
+		check(c.Tenancy.DatabasePrefix != "", "tenancy.databasePrefix: must not be empty")
+	default:
+		check(false, "tenancy.mode: unknown mode %q, expected off, filter or database", c.Tenancy.Mode)
+	}
+	if c.Tenancy.Mode != TenancyOff {
+		check(c.Tenancy.Header != "", "tenancy.header: must not be empty")
+	}
+	for _, tenant := range c.Tenancy.Allowed {
+		check(tenant != "", "tenancy.allowed: entries must not be empty")
+	}
+
+	if len(c.Kafka.Brokers) > 0 {
+		check(c.Kafka.Topic != "", "kafka.topic: must not be empty")
+	}
+
+	if c.NATS.URL != "" {
+		check(c.NATS.Stream != "", "nats.stream: must not be empty")
+		check(c.NATS.Subject != "", "nats.subject: must not be empty")
+		check(c.NATS.Consumer != "", "nats.consumer: must not be empty")
+	}
+
+	if len(c.Webhooks.URLs) > 0 {
+		check(c.Webhooks.Secret != "", "webhooks.secret: must not be empty")
+		check(c.Webhooks.Timeout > 0, "webhooks.timeout: must be positive")
+		check(c.Webhooks.Retry.MaxAttempts > 0, "webhooks.retry.maxAttempts: must be positive")
+		check(c.Webhooks.Retry.MaxDelay >= c.Webhooks.Retry.BaseDelay, "webhooks.retry.maxDelay: must not be less than baseDelay")
+		check(c.Webhooks.QueueSize > 0, "webhooks.queueSize: must be positive")
+		check(c.Webhooks.Workers > 0, "webhooks.workers: must be positive")
+	}
+	check(c.Cache.RedisDB >= 0, "cache.redisDb: must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// applyEnv overrides settings with any environment variables that are set
+func (c *Config) applyEnv() error {
+	env := &envReader{}
+
+	// The standard OpenTelemetry variables come first so the service's own
+	// variables win when both are set
+	c.applyOTelEnv(env)
+
+	env.String("APP_ENV", &c.Env)
+	c.Env = strings.ToLower(c.Env)
+
+	env.Int("PORT", &c.Server.Port)
+	env.Duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	env.Duration("FLUSH_TIMEOUT", &c.Server.FlushTimeout)
+	env.Duration("REQUEST_TIMEOUT", &c.Server.RequestTimeout)
+	env.Duration("READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout)
+	env.Duration("WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	env.Duration("IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	env.Int("MAX_HEADER_BYTES", &c.Server.MaxHeaderBytes)
+	env.Int64("MAX_PAGE_SIZE", &c.Server.MaxPageSize)
+	env.String("COLLATION_LOCALE", &c.Server.CollationLocale)
+	env.Int("GRPC_PORT", &c.Server.GRPCPort)
+	env.Duration("IDEMPOTENCY_TTL", &c.Server.IdempotencyTTL)
+	env.String("ADMIN_ADDR", &c.Server.AdminAddr)
+	env.Bool("API_DOCS", &c.Server.Docs)
+	env.List("TRUSTED_PROXIES", &c.Server.TrustedProxies)
+	env.Int("BLOCK_PROFILE_RATE", &c.Server.BlockProfileRate)
+	env.Int("MUTEX_PROFILE_FRACTION", &c.Server.MutexProfileFraction)
+	env.String("TLS_CERT_FILE", &c.Server.TLS.CertFile)
+	env.String("TLS_KEY_FILE", &c.Server.TLS.KeyFile)
+	env.Duration("TLS_RELOAD_INTERVAL", &c.Server.TLS.ReloadInterval)
+	env.Int("TLS_REDIRECT_PORT", &c.Server.TLS.RedirectPort)
+
+	env.String("MONGO_URI", &c.Mongo.URI)
+	env.String("MONGO_DATABASE", &c.Mongo.Database)
+	env.Duration("MONGO_OPERATION_TIMEOUT", &c.Mongo.OperationTimeout)
+	env.Uint64("MONGO_MAX_POOL_SIZE", &c.Mongo.MaxPoolSize)
+	env.Uint64("MONGO_MIN_POOL_SIZE", &c.Mongo.MinPoolSize)
+	env.Duration("MONGO_MAX_CONN_IDLE_TIME", &c.Mongo.MaxConnIdleTime)
+	env.Duration("MONGO_CONNECT_TIMEOUT", &c.Mongo.ConnectTimeout)
+	env.Duration("MONGO_SERVER_SELECTION_TIMEOUT", &c.Mongo.ServerSelectionTimeout)
+	env.Uint32("MONGO_BREAKER_FAILURE_THRESHOLD", &c.Mongo.Breaker.FailureThreshold)
+	env.Duration("MONGO_BREAKER_OPEN_TIMEOUT", &c.Mongo.Breaker.OpenTimeout)
+	env.Int("MONGO_RETRY_MAX_ATTEMPTS", &c.Mongo.Retry.MaxAttempts)
+
+	env.String("SERVICE_NAME", &c.Tracing.ServiceName)
+	env.String("SERVICE_VERSION", &c.Tracing.ServiceVersion)
+	env.String("TRACE_EXPORTER", &c.Tracing.Exporter)
+	env.String("OTLP_ENDPOINT", &c.Tracing.Endpoint)
+	env.String("TRACE_FILE", &c.Tracing.File)
+	env.List("TRACE_EXCLUDE_PATHS", &c.Tracing.ExcludePaths)
+	env.List("TRACE_PROPAGATORS", &c.Tracing.Propagators)
+	env.List("TRACE_BAGGAGE_KEYS", &c.Tracing.BaggageKeys)
+	env.String("TRACE_SAMPLER", &c.Tracing.Sampler)
+	env.Float64("TRACE_SAMPLER_RATIO", &c.Tracing.SamplerRatio)
+	env.Duration("TRACE_SLOW_THRESHOLD", &c.Tracing.SlowThreshold)
+	env.Bool("OTLP_TLS_ENABLED", &c.Tracing.TLS.Enabled)
+	env.String("OTLP_TLS_CA_FILE", &c.Tracing.TLS.CAFile)
+	env.String("OTLP_TLS_CERT_FILE", &c.Tracing.TLS.CertFile)
+	env.String("OTLP_TLS_KEY_FILE", &c.Tracing.TLS.KeyFile)
+	env.String("OTLP_TLS_SERVER_NAME", &c.Tracing.TLS.ServerName)
+	env.Map("OTLP_HEADERS", &c.Tracing.Headers)
+
+	env.String("METRICS_EXPORTER", &c.Metrics.Exporter)
+	c.Metrics.Exporter = strings.ToLower(c.Metrics.Exporter)
+	env.String("METRICS_ENDPOINT", &c.Metrics.Endpoint)
+	env.Duration("METRICS_INTERVAL", &c.Metrics.Interval)
+	env.Bool("METRICS_EXEMPLARS", &c.Metrics.Exemplars)
+
+	env.Duration("HEALTH_TIMEOUT", &c.Health.Timeout)
+	env.Bool("HEALTH_CHECK_COLLECTOR", &c.Health.CheckCollector)
+
+	env.String("LOG_LEVEL", &c.Logging.Level)
+	c.Logging.Level = strings.ToLower(c.Logging.Level)
+	env.String("LOG_FILE", &c.Logging.File)
+	env.Int("LOG_BUFFER_SIZE", &c.Logging.BufferSize)
+	env.Int("LOG_MAX_SIZE_MB", &c.Logging.Rotation.MaxSizeMB)
+	env.Int("LOG_MAX_BACKUPS", &c.Logging.Rotation.MaxBackups)
+	env.Int("LOG_MAX_AGE_DAYS", &c.Logging.Rotation.MaxAgeDays)
+	env.Bool("LOG_COMPRESS", &c.Logging.Rotation.Compress)
+	env.String("LOG_OTLP_ENDPOINT", &c.Logging.OTLPEndpoint)
+	env.Bool("ACCESS_LOG", &c.Logging.AccessLog.Enabled)
+	env.List("ACCESS_LOG_EXCLUDE_PATHS", &c.Logging.AccessLog.ExcludePaths)
+	env.Bool("LOG_PAYLOADS", &c.Logging.Payloads.Enabled)
+	env.Int("LOG_PAYLOADS_MAX_BYTES", &c.Logging.Payloads.MaxBytes)
+	env.List("LOG_PAYLOADS_REDACT_FIELDS", &c.Logging.Payloads.RedactFields)
+
+	env.String("AUTH_MODE", &c.Auth.Mode)
+	c.Auth.Mode = strings.ToLower(c.Auth.Mode)
+	switch c.Auth.Mode {
+	case AuthModeAPIKey:
+		env.List("API_KEYS", &c.Auth.Credentials)
+	case AuthModeBearer:
+		env.List("BEARER_TOKENS", &c.Auth.Credentials)
+	}
+	env.String("JWT_SIGNING_KEY", &c.Auth.JWT.SigningKey)
+	env.String("JWT_ISSUER", &c.Auth.JWT.Issuer)
+	env.Duration("JWT_LEEWAY", &c.Auth.JWT.Leeway)
+	env.Bool("AUTH_MONGO_API_KEYS", &c.Auth.MongoAPIKeys)
+
+	env.Float64("RATE_LIMIT_PER_IP", &c.RateLimit.PerIP)
+	env.Float64("RATE_LIMIT_PER_KEY", &c.RateLimit.PerKey)
+	env.Int("RATE_LIMIT_BURST", &c.RateLimit.Burst)
+
+	env.List("CORS_ALLOWED_ORIGINS", &c.CORS.AllowedOrigins)
+	env.Bool("CORS_ALLOW_CREDENTIALS", &c.CORS.AllowCredentials)
+	env.Bool("CORS_TRACE_PREFLIGHT", &c.CORS.TracePreflight)
+
+	env.String("REDIS_ADDR", &c.Cache.RedisAddr)
+	env.String("REDIS_PASSWORD", &c.Cache.RedisPassword)
+	env.Int("REDIS_DB", &c.Cache.RedisDB)
+	env.Duration("CACHE_TTL", &c.Cache.TTL)
+
+	env.String("PYROSCOPE_SERVER_ADDRESS", &c.Profiling.ServerAddress)
+	env.Bool("PROFILING_SPAN_PROFILES", &c.Profiling.SpanProfiles)
+
+	env.String("EMAIL_VERIFICATION_URL", &c.EmailVerification.URL)
+	env.Duration("EMAIL_VERIFICATION_TIMEOUT", &c.EmailVerification.Timeout)
+	env.Int("EMAIL_VERIFICATION_MAX_ATTEMPTS", &c.EmailVerification.Retry.MaxAttempts)
+
+	env.List("WEBHOOK_URLS", &c.Webhooks.URLs)
+	env.String("WEBHOOK_SECRET", &c.Webhooks.Secret)
+	env.Int("WEBHOOK_MAX_ATTEMPTS", &c.Webhooks.Retry.MaxAttempts)
+	env.Int("WEBHOOK_WORKERS", &c.Webhooks.Workers)
+
+	env.String("JOBS_BACKEND", &c.Jobs.Backend)
+	env.Int("JOBS_WORKERS", &c.Jobs.Workers)
+	env.Int("JOBS_MAX_ATTEMPTS", &c.Jobs.MaxAttempts)
+
+	env.String("MAINTENANCE_PURGE_SCHEDULE", &c.Maintenance.PurgeSchedule)
+	env.Duration("MAINTENANCE_PURGE_RETENTION", &c.Maintenance.PurgeRetention)
+	env.String("MAINTENANCE_STATS_SCHEDULE", &c.Maintenance.StatsSchedule)
+
+	env.Bool("MIGRATIONS_ON_STARTUP", &c.Migrations.OnStartup)
+	env.Duration("MIGRATIONS_TIMEOUT", &c.Migrations.Timeout)
+
+	env.String("FEATURE_FLAGS_SOURCE", &c.FeatureFlags.Source)
+	env.IntMap("FEATURE_FLAGS", &c.FeatureFlags.Flags)
+	env.Duration("FEATURE_FLAGS_CACHE_TTL", &c.FeatureFlags.CacheTTL)
+
+	env.String("TENANCY_MODE", &c.Tenancy.Mode)
+	env.String("TENANCY_HEADER", &c.Tenancy.Header)
+	env.List("TENANCY_ALLOWED", &c.Tenancy.Allowed)
+	env.Bool("TENANCY_REQUIRED", &c.Tenancy.Required)
+	env.String("TENANCY_DATABASE_PREFIX", &c.Tenancy.DatabasePrefix)
+
+	env.List("KAFKA_BROKERS", &c.Kafka.Brokers)
+	env.String("KAFKA_TOPIC", &c.Kafka.Topic)
+
+	env.String("NATS_URL", &c.NATS.URL)
+	env.String("NATS_STREAM", &c.NATS.Stream)
+	env.String("NATS_SUBJECT", &c.NATS.Subject)
+	env.String("NATS_CONSUMER", &c.NATS.Consumer)
+
+	return errors.Join(env.errs...)
+}
+
+// applyOTelEnv reads the OTEL_* variables the OpenTelemetry SDKs share, so
+// the service can be configured like any other instrumented app.
+// OTEL_RESOURCE_ATTRIBUTES is read by telemetry.NewResource.
+func (c *Config) applyOTelEnv(env *envReader) {
+	env.String("OTEL_SERVICE_NAME", &c.Tracing.ServiceName)
+
+	// Signal-specific variables override the general ones
+	for _, key := range []string{"OTEL_EXPORTER_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"} {
+		env.OTLPProtocol(key, &c.Tracing.Exporter)
+	}
+	// The general endpoint is a base URL that the HTTP exporter adds the
+	// signal path to; the traces one is used as is
+	var tracesPath string
+	if c.Tracing.Exporter == TraceExporterOTLPHTTP {
+		tracesPath = "/v1/traces"
+	}
+	env.OTLPEndpoint("OTEL_EXPORTER_OTLP_ENDPOINT", tracesPath, &c.Tracing.Endpoint, &c.Tracing.TLS.Enabled)
+	env.OTLPEndpoint("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "", &c.Tracing.Endpoint, &c.Tracing.TLS.Enabled)
+	for _, key := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		env.OTLPHeaders(key, &c.Tracing.Headers)
+	}
+	for _, prefix := range []string{"OTEL_EXPORTER_OTLP_", "OTEL_EXPORTER_OTLP_TRACES_"} {
+		env.String(prefix+"CERTIFICATE", &c.Tracing.TLS.CAFile)
+		env.String(prefix+"CLIENT_CERTIFICATE", &c.Tracing.TLS.CertFile)
+		env.String(prefix+"CLIENT_KEY", &c.Tracing.TLS.KeyFile)
+	}
+	if c.Tracing.TLS.CAFile != "" || c.Tracing.TLS.CertFile != "" {
+		c.Tracing.TLS.Enabled = true
+	}
+
+	env.String("OTEL_TRACES_SAMPLER", &c.Tracing.Sampler)
+	env.Float64("OTEL_TRACES_SAMPLER_ARG", &c.Tracing.SamplerRatio)
+}
+
+// validOTLPEndpoint accepts host:port and http or https URLs
+func validOTLPEndpoint(endpoint string) bool {
+	if !strings.Contains(endpoint, "://") {
+		_, _, err := net.SplitHostPort(endpoint)
+		return err == nil
+	}
+	u, err := url.Parse(endpoint)
+	return err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// envReader collects parse errors instead of stopping at the first one.
+// Unset variables leave the target untouched.
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) fail(key string, err error) {
+	r.errs = append(r.errs, fmt.Errorf("%s: %w", key, err))
+}
+
+func (r *envReader) String(key string, target *string) {
+	if value, ok := os.LookupEnv(key); ok {
+		*target = strings.TrimSpace(value)
+	}
+}
+
+func (r *envReader) Int(key string, target *int) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		r.fail(key, fmt.Errorf("%q is not an integer", value))
+		return
+	}
+	*target = n
+}
+
+func (r *envReader) Int64(key string, target *int64) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		r.fail(key, fmt.Errorf("%q is not an integer", value))
+		return
+	}
+	*target = n
+}
+
+func (r *envReader) Uint64(key string, target *uint64) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		r.fail(key, fmt.Errorf("%q is not a non-negative integer", value))
+		return
+	}
+	*target = n
+}
+
+func (r *envReader) Uint32(key string, target *uint32) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		r.fail(key, fmt.Errorf("%q is not a non-negative integer", value))
+		return
+	}
+	*target = uint32(n)
+}
+
+func (r *envReader) Float64(key string, target *float64) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		r.fail(key, fmt.Errorf("%q is not a number", value))
+		return
+	}
+	*target = f
+}
+
+func (r *envReader) Bool(key string, target *bool) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		r.fail(key, fmt.Errorf("%q is not a boolean", value))
+		return
+	}
+	*target = b
+}
+
+func (r *envReader) Duration(key string, target *time.Duration) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		r.fail(key, fmt.Errorf("%q is not a duration", value))
+		return
+	}
+	*target = d
+}
+
+// List reads a comma-separated list
+func (r *envReader) List(key string, target *[]string) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*target = items
+}
+
+// Map reads comma-separated key=value pairs, such as
+// "x-honeycomb-team=abc,x-honeycomb-dataset=traces"
+func (r *envReader) Map(key string, target *map[string]string) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	items := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		k, v, found := strings.Cut(item, "=")
+		if !found || strings.TrimSpace(k) == "" {
+			// Not quoted, since the values may be secrets
+			r.fail(key, errors.New("entries must be key=value pairs"))
+			return
+		}
+		items[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	*target = items
+}
+
+// IntMap reads comma-separated key=integer pairs, such as "newSearch=25"
+func (r *envReader) IntMap(key string, target *map[string]int) {
+	var raw map[string]string
+	r.Map(key, &raw)
+	if raw == nil {
+		return
+	}
+
+	items := make(map[string]int, len(raw))
+	for k, v := range raw {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			r.fail(key, fmt.Errorf("%s: %q is not an integer", k, v))
+			return
+		}
+		items[k] = n
+	}
+	*target = items
+}
+
+// OTLPProtocol maps OTEL_EXPORTER_OTLP_PROTOCOL to the otlp or otlphttp exporter
+func (r *envReader) OTLPProtocol(key string, target *string) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	switch strings.TrimSpace(value) {
+	case "grpc":
+		*target = TraceExporterOTLP
+	case "http/protobuf":
+		*target = TraceExporterOTLPHTTP
+	default:
+		r.fail(key, fmt.Errorf("unsupported protocol %q, expected grpc or http/protobuf", value))
+	}
+}
+
+// OTLPEndpoint reads an OTLP endpoint URL such as https://collector:4317,
+// turning TLS on for https. signalPath is added to the path of base URLs,
+// as the HTTP exporter expects of OTEL_EXPORTER_OTLP_ENDPOINT.
+func (r *envReader) OTLPEndpoint(key, signalPath string, target *string, secure *bool) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	u, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		r.fail(key, fmt.Errorf("%q is not an http or https URL", value))
+		return
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + signalPath
+	*target = u.String()
+	*secure = u.Scheme == "https"
+}
+
+// OTLPHeaders reads key=value pairs whose values are URL-encoded, as the
+// OpenTelemetry specification defines them
+func (r *envReader) OTLPHeaders(key string, target *map[string]string) {
+	var headers map[string]string
+	r.Map(key, &headers)
+	if headers == nil {
+		return
+	}
+
+	for k, v := range headers {
+		decoded, err := url.QueryUnescape(v)
+		if err != nil {
+			r.fail(key, fmt.Errorf("value of %s is not URL-encoded", k))
+			return
+		}
+		headers[k] = decoded
+	}
+	*target = headers
+}
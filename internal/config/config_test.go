@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadRequiresMongoURI(t *testing.T) {
+	// Setenv restores the variable after the test, even though it is unset here
+	t.Setenv("MONGO_URI", "")
+	os.Unsetenv("MONGO_URI")
+
+	_, err := Load("")
+	if err == nil || !strings.Contains(err.Error(), "mongo.uri") {
+		t.Fatalf("Load() error = %v, want a mongo.uri error", err)
+	}
+}
+
+func TestLoadReadsMongoURIFromEnv(t *testing.T) {
+	const uri = "mongodb://localhost:27017"
+	t.Setenv("MONGO_URI", uri)
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Mongo.URI != uri {
+		t.Errorf("Mongo.URI = %q, want %q", cfg.Mongo.URI, uri)
+	}
+}
+
+func TestLoadReadsTraceExcludePaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		value *string
+		want  []string
+	}{
+		{name: "default", want: []string{"/healthz", "/readyz", "/livez", "/metrics"}},
+		{name: "from env", value: ptr(" /healthz, ,/internal/ping"), want: []string{"/healthz", "/internal/ping"}},
+		{name: "empty traces everything", value: ptr("")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MONGO_URI", "mongodb://localhost:27017")
+			if tt.value != nil {
+				t.Setenv("TRACE_EXCLUDE_PATHS", *tt.value)
+			}
+
+			cfg, err := Load("")
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !reflect.DeepEqual(cfg.Tracing.ExcludePaths, tt.want) {
+				t.Errorf("ExcludePaths = %v, want %v", cfg.Tracing.ExcludePaths, tt.want)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string { return &s }
+
+func TestValidateRejectsStoredKeysInJWTMode(t *testing.T) {
+	cfg := Default()
+	cfg.Mongo.URI = "mongodb://localhost:27017"
+	cfg.Auth.Mode = AuthModeJWT
+	cfg.Auth.JWT.SigningKey = strings.Repeat("k", 32)
+	cfg.Auth.MongoAPIKeys = true
+
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "auth.mongoApiKeys") {
+		t.Fatalf("Validate() error = %v, want an auth.mongoApiKeys error", err)
+	}
+}
+
+func TestValidateChecksTrustedProxies(t *testing.T) {
+	tests := []struct {
+		proxies []string
+		wantErr bool
+	}{
+		{proxies: nil},
+		{proxies: []string{"10.0.0.1", "10.0.0.0/8", "::1"}},
+		{proxies: []string{"proxy.internal"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.Mongo.URI = "mongodb://localhost:27017"
+		cfg.Server.TrustedProxies = tt.proxies
+
+		err := cfg.Validate()
+		if gotErr := err != nil && strings.Contains(err.Error(), "server.trustedProxies"); gotErr != tt.wantErr {
+			t.Errorf("Validate(%v) error = %v, want error %v", tt.proxies, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadKeepsOTLPEndpointURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		value      string
+		protocol   string
+		want       string
+		wantSecure bool
+	}{
+		{name: "path kept", key: "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", value: "https://gateway.example.com/otlp/v1/traces",
+			protocol: "http/protobuf", want: "https://gateway.example.com/otlp/v1/traces", wantSecure: true},
+		{name: "base URL gets the signal path", key: "OTEL_EXPORTER_OTLP_ENDPOINT", value: "https://gateway.example.com/otlp/",
+			protocol: "http/protobuf", want: "https://gateway.example.com/otlp/v1/traces", wantSecure: true},
+		{name: "plaintext gRPC", key: "OTEL_EXPORTER_OTLP_ENDPOINT", value: "http://collector:4317",
+			protocol: "grpc", want: "http://collector:4317"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MONGO_URI", "mongodb://localhost:27017")
+			t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", tt.protocol)
+			t.Setenv(tt.key, tt.value)
+
+			cfg, err := Load("")
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Tracing.Endpoint != tt.want || cfg.Tracing.TLS.Enabled != tt.wantSecure {
+				t.Errorf("endpoint = %q, TLS = %v, want %q, %v", cfg.Tracing.Endpoint, cfg.Tracing.TLS.Enabled, tt.want, tt.wantSecure)
+			}
+		})
+	}
+}
+
+func TestValidateChecksOTLPEndpoints(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		wantErr  bool
+	}{
+		{endpoint: "localhost:4317"},
+		{endpoint: "https://collector.example.com/otlp"},
+		{endpoint: "collector", wantErr: true},
+		{endpoint: "grpc://collector:4317", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.Mongo.URI = "mongodb://localhost:27017"
+		cfg.Logging.OTLPEndpoint = tt.endpoint
+
+		err := cfg.Validate()
+		if gotErr := err != nil && strings.Contains(err.Error(), "logging.otlpEndpoint"); gotErr != tt.wantErr {
+			t.Errorf("Validate(%q) error = %v, want error %v", tt.endpoint, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package downstream
+
+import (
+	"math/rand"
+	"time"
+
+	"tracer/internal/config"
+)
+
+// backoff mirrors the MongoDB retry policy: a random delay up to BaseDelay
+// doubled once per attempt, capped at MaxDelay
+func backoff(retry config.RetryConfig, attempt int) time.Duration {
+	ceiling := retry.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		ceiling = min(retry.MaxDelay, retry.BaseDelay<<shift)
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
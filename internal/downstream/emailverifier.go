@@ -0,0 +1,130 @@
+// Package downstream holds clients for the services this API calls out to.
+// Requests go through otelhttp, so each attempt is a client span and the
+// trace context and baggage travel with it.
+package downstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/config"
+	"tracer/internal/telemetry"
+)
+
+// Name of the downstream service on client spans
+const emailVerificationService = "email-verification"
+
+// errRetryable marks failures worth another attempt
+var errRetryable = errors.New("retryable")
+
+// EmailVerifier asks the email verification service whether an address can
+// receive mail
+type EmailVerifier struct {
+	client *http.Client
+	url    string
+	retry  config.RetryConfig
+	tracer telemetry.Tracer
+}
+
+func NewEmailVerifier(cfg config.EmailVerificationConfig, tracer telemetry.Tracer) *EmailVerifier {
+	return &EmailVerifier{
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			// Per attempt, the caller's deadline still bounds the whole call
+			Timeout: cfg.Timeout,
+		},
+		url:    strings.TrimSuffix(cfg.URL, "/") + "/verify",
+		retry:  cfg.Retry,
+		tracer: tracer,
+	}
+}
+
+type verifyRequest struct {
+	Email string `json:"email"`
+}
+
+type verifyResponse struct {
+	Deliverable bool `json:"deliverable"`
+}
+
+// Verify reports whether email is deliverable. The address is sent in a
+// POST body rather than the URL so it does not end up in span attributes.
+// Network errors, 429 and 5xx responses are retried with backoff.
+func (v *EmailVerifier) Verify(ctx context.Context, email string) (bool, error) {
+	ctx, span := v.tracer.Start(ctx, "EmailVerifier.Verify")
+	defer span.End()
+
+	span.SetAttributes(semconv.PeerServiceKey.String(emailVerificationService))
+
+	body, err := json.Marshal(verifyRequest{Email: email})
+	if err != nil {
+		return false, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		deliverable, err := v.verifyOnce(ctx, body)
+		if err == nil {
+			span.SetAttributes(attribute.Bool("email.deliverable", deliverable))
+			return deliverable, nil
+		}
+		if attempt >= v.retry.MaxAttempts || !errors.Is(err, errRetryable) {
+			return false, err
+		}
+
+		delay := backoff(v.retry, attempt)
+		span.AddEvent("http.retry", trace.WithAttributes(
+			attribute.Int("http.attempt", attempt),
+			attribute.Int64("http.retry_delay_ms", delay.Milliseconds()),
+			attribute.String("error.message", err.Error()),
+		))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, err
+		case <-timer.C:
+		}
+	}
+}
+
+func (v *EmailVerifier) verifyOnce(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, err
+		}
+		return false, fmt.Errorf("%w: %w", errRetryable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return false, fmt.Errorf("%w: email verification returned %s", errRetryable, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("email verification returned %s", resp.Status)
+	}
+
+	var result verifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("decode email verification response: %w", err)
+	}
+	return result.Deliverable, nil
+}
@@ -0,0 +1,126 @@
+package downstream
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/config"
+	"tracer/internal/service"
+	"tracer/internal/telemetry"
+)
+
+// Header naming the event type, so consumers can filter without decoding
+const kafkaEventTypeHeader = "event-type"
+
+// KafkaPublisher writes user events to a Kafka topic, keyed by user ID so
+// each user's events stay in order. The trace context goes in the message
+// headers for consumers to continue the trace.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+	tracer telemetry.Tracer
+}
+
+func NewKafkaPublisher(cfg config.KafkaConfig, tracer telemetry.Tracer) *KafkaPublisher {
+	return &KafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(cfg.Brokers...),
+			Topic:    cfg.Topic,
+			Balancer: &kafka.Hash{},
+			// Batches are sent in the background so requests never wait on
+			// the brokers; failures are only logged
+			Async: true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					log.Error().Err(err).Int("messages", len(messages)).Msg("Failed to publish events to Kafka")
+				}
+			},
+		},
+		tracer: tracer,
+	}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, event service.UserEvent) {
+	ctx, span := p.tracer.Start(ctx, p.writer.Topic+" publish", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	key := event.User.ID.Hex()
+	span.SetAttributes(
+		semconv.MessagingSystemKey.String("kafka"),
+		semconv.MessagingDestinationNameKey.String(p.writer.Topic),
+		semconv.MessagingOperationPublish,
+		semconv.MessagingMessageIDKey.String(event.ID),
+		semconv.MessagingKafkaMessageKeyKey.String(key),
+	)
+
+	value, err := json.Marshal(event)
+	if err != nil {
+		span.RecordError(err)
+		log.Ctx(ctx).Error().Err(err).Str("eventId", event.ID).Msg("Failed to encode event")
+		return
+	}
+
+	message := kafka.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: []kafka.Header{{Key: kafkaEventTypeHeader, Value: []byte(event.Type)}},
+	}
+	otel.GetTextMapPropagator().Inject(ctx, kafkaHeaderCarrier{message: &message})
+
+	// Async writes only fail here for invalid messages or a closed writer
+	if err := p.writer.WriteMessages(ctx, message); err != nil {
+		span.RecordError(err)
+		log.Ctx(ctx).Error().Err(err).Str("eventId", event.ID).Msg("Failed to queue event for Kafka")
+	}
+}
+
+// Close flushes pending messages, giving up when ctx is done. The writer
+// keeps flushing in the background after that, until the process exits.
+func (p *KafkaPublisher) Close(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() { done <- p.writer.Close() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// kafkaHeaderCarrier lets propagators read and write message headers
+type kafkaHeaderCarrier struct {
+	message *kafka.Message
+}
+
+func (c kafkaHeaderCarrier) Get(key string) string {
+	for _, h := range c.message.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c kafkaHeaderCarrier) Set(key, value string) {
+	for i, h := range c.message.Headers {
+		if h.Key == key {
+			c.message.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.message.Headers = append(c.message.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c kafkaHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.message.Headers))
+	for _, h := range c.message.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
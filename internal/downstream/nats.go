@@ -0,0 +1,118 @@
+package downstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/config"
+	"tracer/internal/service"
+	"tracer/internal/telemetry"
+)
+
+// Connection name of the API's publisher
+const natsPublisherName = "user-events-publisher"
+
+// NATSPublisher publishes user events to JetStream under
+// <subject>.<event type>, e.g. users.user.created. Like the Kafka publisher
+// it sends asynchronously and puts the trace context in the headers.
+type NATSPublisher struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	subject string
+	tracer  telemetry.Tracer
+}
+
+// NewNATSPublisher connects to NATS and creates or updates the stream that
+// holds the events
+func NewNATSPublisher(ctx context.Context, cfg config.NATSConfig, tracer telemetry.Tracer) (*NATSPublisher, error) {
+	conn, err := ConnectNATS(cfg.URL, natsPublisherName)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := jetstream.New(conn, jetstream.WithPublishAsyncErrHandler(func(_ jetstream.JetStream, msg *nats.Msg, err error) {
+		log.Error().Err(err).Str("subject", msg.Subject).Msg("Failed to publish event to NATS")
+	}))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     cfg.Stream,
+		Subjects: []string{cfg.Subject + ".>"},
+	}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("create stream %s: %w", cfg.Stream, err)
+	}
+
+	return &NATSPublisher{conn: conn, js: js, subject: cfg.Subject, tracer: tracer}, nil
+}
+
+// ConnectNATS opens a connection under a name shown in the server's
+// connection list
+func ConnectNATS(url, name string) (*nats.Conn, error) {
+	conn, err := nats.Connect(url, nats.Name(name))
+	if err != nil {
+		return nil, fmt.Errorf("connect to NATS: %w", err)
+	}
+	return conn, nil
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, event service.UserEvent) {
+	subject := p.subject + "." + event.Type
+	ctx, span := p.tracer.Start(ctx, subject+" publish", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.MessagingSystemKey.String("nats"),
+		semconv.MessagingDestinationNameKey.String(subject),
+		semconv.MessagingOperationPublish,
+		semconv.MessagingMessageIDKey.String(event.ID),
+	)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		span.RecordError(err)
+		log.Ctx(ctx).Error().Err(err).Str("eventId", event.ID).Msg("Failed to encode event")
+		return
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	// Lets JetStream drop duplicates of the same event
+	msg.Header.Set(jetstream.MsgIDHeader, event.ID)
+	otel.GetTextMapPropagator().Inject(ctx, NATSHeaderCarrier(msg.Header))
+
+	if _, err := p.js.PublishMsgAsync(msg); err != nil {
+		span.RecordError(err)
+		log.Ctx(ctx).Error().Err(err).Str("eventId", event.ID).Msg("Failed to queue event for NATS")
+	}
+}
+
+// Close waits for outstanding acks until ctx is done, then drains the
+// connection
+func (p *NATSPublisher) Close(ctx context.Context) error {
+	select {
+	case <-p.js.PublishAsyncComplete():
+	case <-ctx.Done():
+		log.Warn().Int("pending", p.js.PublishAsyncPending()).Msg("Timed out waiting for NATS acks")
+	}
+	return p.conn.Drain()
+}
+
+// NATSHeaderCarrier adapts message headers for propagators. NATS headers
+// have the same shape as HTTP headers.
+func NATSHeaderCarrier(header nats.Header) propagation.HeaderCarrier {
+	return propagation.HeaderCarrier(http.Header(header))
+}
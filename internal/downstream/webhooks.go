@@ -0,0 +1,273 @@
+package downstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/config"
+	"tracer/internal/service"
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// Headers sent with every webhook. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the shared secret.
+const (
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookIDHeader        = "X-Webhook-ID"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// webhookJob is one event to be sent to one URL
+type webhookJob struct {
+	event service.UserEvent
+	body  []byte
+	url   string
+	// The request span that caused the event
+	origin trace.Link
+}
+
+// WebhookDispatcher posts user events to the configured webhook URLs from a
+// pool of workers, so requests never wait for receivers
+type WebhookDispatcher struct {
+	client     *http.Client
+	urls       []string
+	secret     []byte
+	retry      config.RetryConfig
+	deliveries *storage.DeliveryLog
+	tracer     telemetry.Tracer
+
+	jobs chan webhookJob
+	wg   sync.WaitGroup
+
+	// Canceled by Close once its deadline passes, to cut short deliveries
+	// still sending or waiting to retry
+	stopCtx context.Context
+	stop    context.CancelFunc
+	// Jobs left in the queue when the dispatcher was stopped
+	skipped atomic.Int64
+
+	// Guards jobs against sends after Close
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewWebhookDispatcher starts the delivery workers. Close stops them.
+func NewWebhookDispatcher(cfg config.WebhookConfig, deliveries *storage.DeliveryLog, tracer telemetry.Tracer) *WebhookDispatcher {
+	stopCtx, stop := context.WithCancel(context.Background())
+	d := &WebhookDispatcher{
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   cfg.Timeout,
+		},
+		urls:       cfg.URLs,
+		secret:     []byte(cfg.Secret),
+		retry:      cfg.Retry,
+		deliveries: deliveries,
+		tracer:     tracer,
+		jobs:       make(chan webhookJob, cfg.QueueSize),
+		stopCtx:    stopCtx,
+		stop:       stop,
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for job := range d.jobs {
+				if d.stopCtx.Err() != nil {
+					d.skipped.Add(1)
+					continue
+				}
+				d.deliver(job)
+			}
+		}()
+	}
+	return d
+}
+
+// Publish queues the event for every URL. When the queue is full the event
+// is dropped for that URL rather than blocking the request.
+func (d *WebhookDispatcher) Publish(ctx context.Context, event service.UserEvent) {
+	span := trace.SpanFromContext(ctx)
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("eventId", event.ID).Msg("Failed to encode webhook event")
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		log.Ctx(ctx).Warn().Str("eventId", event.ID).Msg("Webhook dispatcher closed, dropping event")
+		return
+	}
+
+	origin := trace.Link{SpanContext: span.SpanContext()}
+	for _, url := range d.urls {
+		select {
+		case d.jobs <- webhookJob{event: event, body: body, url: url, origin: origin}:
+		default:
+			span.AddEvent("webhook.dropped", trace.WithAttributes(
+				attribute.String("webhook.event_id", event.ID),
+				attribute.String("webhook.url", url),
+			))
+			log.Ctx(ctx).Warn().Str("eventId", event.ID).Str("url", url).Msg("Webhook queue full, dropping event")
+		}
+	}
+}
+
+// Close stops accepting events and waits for queued deliveries to finish
+// until ctx is done. It then stops the deliveries still running, which
+// record their last attempt, skips the queued ones and waits for the
+// workers to exit, so none writes to MongoDB after it is disconnected.
+func (d *WebhookDispatcher) Close(ctx context.Context) {
+	d.mu.Lock()
+	d.closed = true
+	close(d.jobs)
+	d.mu.Unlock()
+	defer d.stop()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info().Msg("Webhook dispatcher stopped")
+		return
+	case <-ctx.Done():
+	}
+
+	d.stop()
+	<-done
+	log.Warn().Int64("skipped", d.skipped.Load()).Msg("Timed out delivering webhooks")
+}
+
+// deliver sends a job, retrying with backoff, and records the outcome. Its
+// span starts a new trace linked to the request, since the delivery
+// outlives it. Stopping the dispatcher ends it after the current attempt.
+func (d *WebhookDispatcher) deliver(job webhookJob) {
+	ctx, span := d.tracer.Start(d.stopCtx, "webhook.deliver",
+		trace.WithNewRoot(),
+		trace.WithLinks(job.origin),
+		trace.WithSpanKind(trace.SpanKindProducer),
+	)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("webhook.event_id", job.event.ID),
+		attribute.String("webhook.event_type", job.event.Type),
+		attribute.String("webhook.url", job.url),
+	)
+
+	delivery := storage.WebhookDelivery{
+		EventID:   job.event.ID,
+		EventType: job.event.Type,
+		URL:       job.url,
+		TraceID:   span.SpanContext().TraceID().String(),
+		CreatedAt: job.event.OccurredAt,
+	}
+
+	for attempt := 1; ; attempt++ {
+		delivery.Attempts = attempt
+		status, err := d.send(ctx, job)
+		delivery.StatusCode = status
+		if err == nil {
+			delivery.Status = storage.DeliveryDelivered
+			delivery.LastError = ""
+			break
+		}
+
+		delivery.Status = storage.DeliveryFailed
+		delivery.LastError = err.Error()
+		if attempt >= d.retry.MaxAttempts || !retryableStatus(status) {
+			span.SetStatus(codes.Error, err.Error())
+			log.Ctx(ctx).Warn().Err(err).Str("eventId", job.event.ID).Str("url", job.url).Int("attempts", attempt).Msg("Webhook delivery failed")
+			break
+		}
+
+		delay := backoff(d.retry, attempt)
+		span.AddEvent("http.retry", trace.WithAttributes(
+			attribute.Int("http.attempt", attempt),
+			attribute.Int64("http.retry_delay_ms", delay.Milliseconds()),
+			attribute.String("error.message", err.Error()),
+		))
+		select {
+		case <-time.After(delay):
+			continue
+		case <-ctx.Done():
+			span.SetStatus(codes.Error, "dispatcher stopped")
+			log.Ctx(ctx).Warn().Err(err).Str("eventId", job.event.ID).Str("url", job.url).Int("attempts", attempt).Msg("Webhook delivery stopped at shutdown")
+		}
+		break
+	}
+
+	span.SetAttributes(
+		attribute.String("webhook.status", delivery.Status),
+		attribute.Int("webhook.attempts", delivery.Attempts),
+	)
+	delivery.CompletedAt = storage.Now()
+	// Recorded even when stopped; Close waits for it
+	d.deliveries.Record(context.WithoutCancel(ctx), delivery)
+}
+
+// send posts the signed payload once. A 0 status means no response.
+func (d *WebhookDispatcher) send(ctx context.Context, job webhookJob) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.url, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, job.event.Type)
+	req.Header.Set(webhookIDHeader, job.event.ID)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+d.sign(timestamp, job.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *WebhookDispatcher) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryableStatus retries network errors, throttling and server errors;
+// other client errors will not succeed on a second try
+func retryableStatus(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
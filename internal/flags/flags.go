@@ -0,0 +1,93 @@
+// Package flags answers whether a feature is on for the current caller, so
+// risky changes can be rolled out to a share of callers at a time. Each flag
+// has a rollout percentage; a caller is in or out depending on a stable hash
+// of the flag name and the caller's key, so its answer does not flip between
+// requests and only widens as the percentage goes up.
+package flags
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// Provider returns the rollout percentage of a flag, from 0 (off for
+// everyone) to 100 (on for everyone), and false when the flag is not defined
+type Provider interface {
+	Rollout(ctx context.Context, name string) (percent int, ok bool)
+}
+
+// StaticProvider holds the flags from the config file and environment
+type StaticProvider map[string]int
+
+func (p StaticProvider) Rollout(_ context.Context, name string) (int, bool) {
+	percent, ok := p[name]
+	return percent, ok
+}
+
+type contextKey struct{}
+
+// evaluation is the per-request state behind IsEnabled
+type evaluation struct {
+	provider Provider
+	key      string
+
+	mu        sync.Mutex
+	evaluated map[string]bool
+}
+
+// WithProvider makes IsEnabled answer from provider for ctx, bucketing the
+// caller by key
+func WithProvider(ctx context.Context, provider Provider, key string) context.Context {
+	return context.WithValue(ctx, contextKey{}, &evaluation{provider: provider, key: key, evaluated: map[string]bool{}})
+}
+
+// IsEnabled reports whether the flag name is on for the caller in ctx.
+// Undefined flags, and contexts without a provider, are off.
+func IsEnabled(ctx context.Context, name string) bool {
+	e, _ := ctx.Value(contextKey{}).(*evaluation)
+	if e == nil {
+		return false
+	}
+
+	percent, ok := e.provider.Rollout(ctx, name)
+	enabled := ok && bucket(name, e.key) < percent
+
+	e.mu.Lock()
+	e.evaluated[name] = enabled
+	e.mu.Unlock()
+	return enabled
+}
+
+// Evaluated lists the flags IsEnabled was asked about in ctx, as sorted
+// name=on or name=off entries
+func Evaluated(ctx context.Context) []string {
+	e, _ := ctx.Value(contextKey{}).(*evaluation)
+	if e == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	entries := make([]string, 0, len(e.evaluated))
+	for name, enabled := range e.evaluated {
+		state := "off"
+		if enabled {
+			state = "on"
+		}
+		entries = append(entries, name+"="+state)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// bucket places key in 0-99 for the flag name. The name is part of the hash
+// so each flag rolls out to a different set of callers first.
+func bucket(name, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int(h.Sum32() % 100)
+}
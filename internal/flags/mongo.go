@@ -0,0 +1,80 @@
+package flags
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// flagDocument is a flag in the feature_flags collection
+type flagDocument struct {
+	Name    string `bson:"_id"`
+	Rollout int    `bson:"rollout"`
+}
+
+// MongoProvider reads flags from a collection, caching all of them for ttl.
+// Flags missing from the collection are looked up in fallback. When a
+// reload fails the previous flags stay in use until the next attempt.
+type MongoProvider struct {
+	collection *mongo.Collection
+	ttl        time.Duration
+	fallback   Provider
+
+	mu       sync.Mutex
+	flags    map[string]int
+	loadedAt time.Time
+}
+
+func NewMongoProvider(collection *mongo.Collection, ttl time.Duration, fallback Provider) *MongoProvider {
+	return &MongoProvider{collection: collection, ttl: ttl, fallback: fallback}
+}
+
+func (p *MongoProvider) Rollout(ctx context.Context, name string) (int, bool) {
+	if percent, ok := p.snapshot(ctx)[name]; ok {
+		return percent, true
+	}
+	return p.fallback.Rollout(ctx, name)
+}
+
+// snapshot returns the cached flags, reloading them once they are older
+// than ttl. Concurrent callers wait for a single reload.
+func (p *MongoProvider) snapshot(ctx context.Context) map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.loadedAt) < p.ttl {
+		return p.flags
+	}
+	// Failed loads count too, so an unreachable database is not hit on every call
+	p.loadedAt = time.Now()
+
+	flags, err := p.load(ctx)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Failed to load feature flags, keeping the previous ones")
+		return p.flags
+	}
+	p.flags = flags
+	return flags
+}
+
+func (p *MongoProvider) load(ctx context.Context) (map[string]int, error) {
+	cursor, err := p.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []flagDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]int, len(docs))
+	for _, doc := range docs {
+		flags[doc.Name] = min(max(doc.Rollout, 0), 100)
+	}
+	return flags, nil
+}
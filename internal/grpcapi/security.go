@@ -0,0 +1,178 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"tracer/internal/config"
+	"tracer/internal/grpcapi/userspb"
+	"tracer/internal/handlers"
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// Security is what calls are checked against. It mirrors the HTTP
+// middleware, so a caller gets the same answer over either API.
+type Security struct {
+	Auth      config.AuthConfig
+	APIKeys   *storage.APIKeyStore
+	Tenancy   config.TenancyConfig
+	RateLimit config.RateLimitConfig
+}
+
+// Methods a caller with the user role may call for its own user. Every
+// other method needs the admin role, as do the matching REST routes.
+var selfMethods = map[string]bool{
+	userspb.UserService_GetUser_FullMethodName:    true,
+	userspb.UserService_UpdateUser_FullMethodName: true,
+}
+
+// interceptors returns the checks every call goes through, in the order
+// the HTTP middleware applies them
+func (sec Security) interceptors() []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{
+		rateLimit("ip", handlers.NewLimiter(sec.RateLimit.PerIP, sec.RateLimit.Burst), peerIP),
+		sec.authenticate,
+		sec.tenant,
+		rateLimit("key", handlers.NewLimiter(sec.RateLimit.PerKey, sec.RateLimit.Burst), func(ctx context.Context) string {
+			return principalFrom(ctx).Subject
+		}),
+		authorize,
+	}
+}
+
+type principalKey struct{}
+
+func principalFrom(ctx context.Context) handlers.Principal {
+	principal, _ := ctx.Value(principalKey{}).(handlers.Principal)
+	return principal
+}
+
+// firstValue returns the first value of a metadata key
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// authenticate is the gRPC counterpart of handlers.AuthMiddleware, reading
+// the x-api-key and authorization metadata
+func (sec Security) authenticate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if sec.Auth.Mode == config.AuthModeNone {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx, principal, err := handlers.Authenticate(ctx, sec.Auth, sec.APIKeys, handlers.Credentials{
+		APIKey:        firstValue(md, "x-api-key"),
+		Authorization: firstValue(md, "authorization"),
+	})
+	var authErr *handlers.AuthError
+	if errors.As(err, &authErr) {
+		log.Ctx(ctx).Warn().Err(err).Str("mode", sec.Auth.Mode).Str("method", info.FullMethod).Msg("Unauthorized call")
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Failed to look up API key")
+		return nil, status.Error(codes.Unavailable, "Authentication temporarily unavailable")
+	}
+
+	return handler(context.WithValue(ctx, principalKey{}, principal), req)
+}
+
+// tenant is the gRPC counterpart of handlers.Tenant, reading the tenant
+// from metadata named like the HTTP header
+func (sec Security) tenant(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if sec.Tenancy.Mode == config.TenancyOff {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := firstValue(md, sec.Tenancy.Header)
+	tenant, source, err := handlers.ResolveTenant(ctx, sec.Tenancy, principalFrom(ctx).Tenant, header)
+	switch {
+	case errors.Is(err, handlers.ErrTenantMismatch):
+		log.Ctx(ctx).Warn().Str("tenant", header).Msg("Tenant metadata does not match token")
+		return nil, status.Error(codes.PermissionDenied, "Token is not valid for this tenant")
+	case errors.Is(err, handlers.ErrTenantUnknown):
+		log.Ctx(ctx).Warn().Str("tenant", header).Msg("Tenant is not allowed")
+		return nil, status.Error(codes.PermissionDenied, "Tenant is not allowed")
+	case errors.Is(err, handlers.ErrTenantRequired):
+		return nil, status.Error(codes.InvalidArgument, sec.Tenancy.Header+" metadata is required")
+	case err != nil:
+		return nil, status.Error(codes.InvalidArgument, "Invalid tenant ID")
+	case tenant == "":
+		return handler(ctx, req)
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.source", source))
+	return handler(telemetry.WithTenant(ctx, tenant), req)
+}
+
+// authorize applies the role checks of the REST routes to each method
+func authorize(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var id string
+	if withID, ok := req.(interface{ GetId() string }); ok {
+		id = withID.GetId()
+	}
+
+	principal := principalFrom(ctx)
+	if handlers.Authorized(principal, selfMethods[info.FullMethod], id) {
+		return handler(ctx, req)
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("authorization.denied", trace.WithAttributes(
+		attribute.String("auth.subject", principal.Subject),
+		attribute.StringSlice("auth.roles", principal.Roles),
+		attribute.String("rpc.method", info.FullMethod),
+	))
+	log.Ctx(ctx).Warn().Strs("roles", principal.Roles).Str("method", info.FullMethod).Msg("Forbidden call")
+	return nil, status.Error(codes.PermissionDenied, "Forbidden")
+}
+
+// rateLimit answers ResourceExhausted once the bucket for the call's key
+// is empty
+func rateLimit(scope string, limiter handlers.Limiter, key func(ctx context.Context) string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		allowed, wait := limiter.Allow(key(ctx))
+		if allowed {
+			return handler(ctx, req)
+		}
+
+		retryAfter := max(1, int(math.Ceil(wait.Seconds())))
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.Bool("ratelimit.exceeded", true),
+			attribute.String("ratelimit.scope", scope),
+		)
+		log.Ctx(ctx).Warn().Str("scope", scope).Int("retry_after", retryAfter).Msg("Rate limit exceeded")
+
+		_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(retryAfter)))
+		return nil, status.Error(codes.ResourceExhausted, "Too many requests")
+	}
+}
+
+// peerIP is the address the call came from; gRPC has no trusted proxies
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
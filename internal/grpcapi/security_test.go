@@ -0,0 +1,189 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"tracer/internal/config"
+	"tracer/internal/grpcapi/userspb"
+	"tracer/internal/service"
+	"tracer/internal/storage"
+	"tracer/internal/storage/storagemock"
+	"tracer/internal/telemetry"
+)
+
+var signingKey = strings.Repeat("k", 32)
+
+func TestMain(m *testing.M) {
+	// Interceptors log every rejected call; keep the test output readable
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// newTestClient serves the user API from a mocked repository over an
+// in-memory connection
+func newTestClient(t *testing.T, security Security) (userspb.UserServiceClient, *storagemock.MockUserRepository) {
+	t.Helper()
+	metrics, err := telemetry.NewMetrics(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+
+	repo := storagemock.NewMockUserRepository(gomock.NewController(t))
+	users := service.NewUserService(repo, noopAudit{}, nil, telemetry.NewTracer(), metrics, nil, nil)
+	srv := NewServer(users, 100, nil, security)
+
+	listener := bufconn.Listen(1 << 20)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return userspb.NewUserServiceClient(conn), repo
+}
+
+type noopAudit struct{}
+
+func (noopAudit) Write(context.Context, storage.ID, string, *storage.User, *storage.User) {}
+
+// signJWT returns an HS256 token with the given claims, valid until 2100
+func signJWT(t *testing.T, claims string) string {
+	t.Helper()
+	claims = `{"exp":4102444800,` + strings.TrimPrefix(claims, "{")
+	encode := base64.RawURLEncoding.EncodeToString
+	unsigned := encode([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encode([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + encode(mac.Sum(nil))
+}
+
+func withMetadata(pairs ...string) context.Context {
+	return metadata.NewOutgoingContext(context.Background(), metadata.Pairs(pairs...))
+}
+
+func TestCallsRequireCredentials(t *testing.T) {
+	security := Security{Auth: config.AuthConfig{Mode: config.AuthModeAPIKey, Credentials: []string{"secret"}}}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{name: "no key", ctx: context.Background(), want: codes.Unauthenticated},
+		{name: "wrong key", ctx: withMetadata("x-api-key", "guess"), want: codes.Unauthenticated},
+		{name: "valid key", ctx: withMetadata("x-api-key", "secret"), want: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, repo := newTestClient(t, security)
+			if tt.want == codes.OK {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(0), nil)
+			}
+
+			_, err := client.ListUsers(tt.ctx, &userspb.ListUsersRequest{})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("ListUsers() code = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCallsApplyRoles(t *testing.T) {
+	security := Security{Auth: config.AuthConfig{Mode: config.AuthModeJWT, JWT: config.JWTConfig{SigningKey: signingKey}}}
+	self := storage.NewID()
+	userToken := "Bearer " + signJWT(t, `{"sub":"`+self.Hex()+`","roles":["user"]}`)
+
+	t.Run("user reads itself", func(t *testing.T) {
+		client, repo := newTestClient(t, security)
+		repo.EXPECT().GetByID(gomock.Any(), self, false).Return(storage.User{ID: self}, nil)
+
+		_, err := client.GetUser(withMetadata("authorization", userToken), &userspb.GetUserRequest{Id: self.Hex()})
+		if err != nil {
+			t.Errorf("GetUser() error = %v", err)
+		}
+	})
+
+	t.Run("user reads someone else", func(t *testing.T) {
+		client, _ := newTestClient(t, security)
+
+		_, err := client.GetUser(withMetadata("authorization", userToken), &userspb.GetUserRequest{Id: storage.NewID().Hex()})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Errorf("GetUser() error = %v, want PermissionDenied", err)
+		}
+	})
+
+	t.Run("user deletes itself", func(t *testing.T) {
+		client, _ := newTestClient(t, security)
+
+		_, err := client.DeleteUser(withMetadata("authorization", userToken), &userspb.DeleteUserRequest{Id: self.Hex()})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Errorf("DeleteUser() error = %v, want PermissionDenied", err)
+		}
+	})
+}
+
+func TestCallsResolveTenant(t *testing.T) {
+	security := Security{
+		Auth:    config.AuthConfig{Mode: config.AuthModeJWT, JWT: config.JWTConfig{SigningKey: signingKey}},
+		Tenancy: config.TenancyConfig{Mode: config.TenancyFilter, Header: "X-Tenant-ID", Required: true},
+	}
+	token := "Bearer " + signJWT(t, `{"sub":"admin","roles":["admin"],"tenant":"acme"}`)
+
+	t.Run("metadata for another tenant", func(t *testing.T) {
+		client, _ := newTestClient(t, security)
+
+		_, err := client.ListUsers(withMetadata("authorization", token, "x-tenant-id", "globex"), &userspb.ListUsersRequest{})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Errorf("ListUsers() error = %v, want PermissionDenied", err)
+		}
+	})
+
+	t.Run("tenant from token", func(t *testing.T) {
+		client, repo := newTestClient(t, security)
+		repo.EXPECT().List(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ storage.UserQuery) ([]storage.User, int64, error) {
+			if tenant := telemetry.TenantFromContext(ctx); tenant != "acme" {
+				t.Errorf("tenant = %q, want acme", tenant)
+			}
+			return nil, 0, nil
+		})
+
+		if _, err := client.ListUsers(withMetadata("authorization", token), &userspb.ListUsersRequest{}); err != nil {
+			t.Errorf("ListUsers() error = %v", err)
+		}
+	})
+}
+
+func TestCallsAreRateLimited(t *testing.T) {
+	client, repo := newTestClient(t, Security{Auth: config.AuthConfig{Mode: config.AuthModeNone}, RateLimit: config.RateLimitConfig{PerIP: 0.001, Burst: 1}})
+	repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(0), nil)
+
+	if _, err := client.ListUsers(context.Background(), &userspb.ListUsersRequest{}); err != nil {
+		t.Fatalf("first ListUsers() error = %v", err)
+	}
+	_, err := client.ListUsers(context.Background(), &userspb.ListUsersRequest{})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second ListUsers() error = %v, want ResourceExhausted", err)
+	}
+}
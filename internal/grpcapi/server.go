@@ -0,0 +1,184 @@
+// Package grpcapi serves the user API over gRPC, sharing the service layer
+// with the HTTP handlers
+package grpcapi
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=tracer --go-grpc_out=../.. --go-grpc_opt=module=tracer users/v1/users.proto
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"tracer/internal/grpcapi/userspb"
+	"tracer/internal/service"
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+type userServer struct {
+	userspb.UnimplementedUserServiceServer
+
+	users       *service.UserService
+	maxPageSize int64
+}
+
+// NewServer returns a gRPC server exposing the user service. Every call is
+// traced by otelgrpc, gets a context logger bound to its span, carrying the
+// given baggage members, and goes through the same authentication, role,
+// tenant and rate limit checks as the REST API.
+func NewServer(users *service.UserService, maxPageSize int64, baggageKeys []string, security Security) *grpc.Server {
+	interceptors := append([]grpc.UnaryServerInterceptor{contextLogger(baggageKeys)}, security.interceptors()...)
+	srv := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(interceptors...),
+	)
+	userspb.RegisterUserServiceServer(srv, &userServer{users: users, maxPageSize: maxPageSize})
+	return srv
+}
+
+// contextLogger is the gRPC counterpart of telemetry.ContextLogger and
+// telemetry.Baggage
+func contextLogger(baggageKeys []string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = telemetry.WithBaggageFields(telemetry.WithLogger(ctx), baggageKeys)
+		log.Ctx(ctx).Debug().Str("method", info.FullMethod).Msg("gRPC call")
+		return handler(ctx, req)
+	}
+}
+
+func (s *userServer) CreateUser(ctx context.Context, req *userspb.CreateUserRequest) (*userspb.User, error) {
+	user := storage.User{Name: req.GetName(), Email: req.GetEmail()}
+	if err := s.users.Create(ctx, &user); err != nil {
+		return nil, toStatus(ctx, err, "Failed to create user")
+	}
+
+	log.Ctx(ctx).Info().Str("userId", user.ID.Hex()).Msg("User created")
+	return toProto(user), nil
+}
+
+func (s *userServer) GetUser(ctx context.Context, req *userspb.GetUserRequest) (*userspb.User, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.Get(ctx, id, req.GetIncludeDeleted())
+	if err != nil {
+		return nil, toStatus(ctx, err, "Failed to get user")
+	}
+	return toProto(user), nil
+}
+
+func (s *userServer) ListUsers(ctx context.Context, req *userspb.ListUsersRequest) (*userspb.ListUsersResponse, error) {
+	limit := req.GetLimit()
+	if limit <= 0 || limit > s.maxPageSize {
+		limit = s.maxPageSize
+	}
+	if req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+
+	users, total, err := s.users.List(ctx, storage.UserQuery{
+		Limit:          limit,
+		Offset:         req.GetOffset(),
+		IncludeDeleted: req.GetIncludeDeleted(),
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err, "Failed to list users")
+	}
+
+	resp := &userspb.ListUsersResponse{Total: total, Users: make([]*userspb.User, len(users))}
+	for i, user := range users {
+		resp.Users[i] = toProto(user)
+	}
+	return resp, nil
+}
+
+func (s *userServer) UpdateUser(ctx context.Context, req *userspb.UpdateUserRequest) (*userspb.User, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	// Proto3 strings can't be unset, so empty means unchanged
+	var update storage.UserUpdate
+	if name := req.GetName(); name != "" {
+		update.Name = storage.Some(name)
+	}
+	if email := req.GetEmail(); email != "" {
+		update.Email = storage.Some(email)
+	}
+
+	user, err := s.users.Update(ctx, id, update)
+	if err != nil {
+		return nil, toStatus(ctx, err, "Failed to update user")
+	}
+
+	log.Ctx(ctx).Info().Str("userId", id.Hex()).Msg("User updated")
+	return toProto(user), nil
+}
+
+func (s *userServer) DeleteUser(ctx context.Context, req *userspb.DeleteUserRequest) (*userspb.DeleteUserResponse, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.users.Delete(ctx, id); err != nil {
+		return nil, toStatus(ctx, err, "Failed to delete user")
+	}
+
+	log.Ctx(ctx).Info().Str("userId", id.Hex()).Msg("User deleted")
+	return &userspb.DeleteUserResponse{}, nil
+}
+
+func parseID(value string) (storage.ID, error) {
+	id, err := storage.ParseID(value)
+	if err != nil {
+		return id, status.Error(codes.InvalidArgument, "Invalid user ID")
+	}
+	return id, nil
+}
+
+// toStatus maps service and storage errors to gRPC status codes, matching
+// the HTTP statuses the REST handlers return for the same errors
+func toStatus(ctx context.Context, err error, message string) error {
+	var invalid service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return status.Error(codes.InvalidArgument, invalid.Message)
+	case errors.Is(err, service.ErrEmailTaken), storage.IsDuplicateKey(err):
+		return status.Error(codes.AlreadyExists, "A user with this email already exists")
+	case errors.Is(err, storage.ErrVersionConflict):
+		return status.Error(codes.Aborted, "User was modified by another request")
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, "User not found")
+	case storage.IsTimeout(err):
+		return status.Error(codes.DeadlineExceeded, "Database operation timed out")
+	case storage.IsUnavailable(err):
+		return status.Error(codes.Unavailable, "Database temporarily unavailable")
+	}
+
+	log.Ctx(ctx).Error().Err(err).Msg(message)
+	return status.Error(codes.Internal, message)
+}
+
+func toProto(user storage.User) *userspb.User {
+	out := &userspb.User{
+		Id:        user.ID.Hex(),
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		UpdatedAt: timestamppb.New(user.UpdatedAt),
+	}
+	if user.DeletedAt != nil {
+		out.DeletedAt = timestamppb.New(*user.DeletedAt)
+	}
+	return out
+}
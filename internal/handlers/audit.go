@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+
+	"tracer/internal/storage"
+)
+
+func (h *Handler) getUserHistory(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "getUserHistory")
+	defer span.End()
+
+	id, err := storage.ParseID(c.Param("id"))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid user ID")
+		respondError(c, codeInvalidID, "Invalid user ID")
+		return
+	}
+
+	span.SetAttributes(attribute.String("user.id", id.Hex()))
+
+	page, err := h.parsePageParams(c)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid page parameters")
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+
+	entries, total, err := h.audit.History(ctx, id, page.Limit, page.Offset)
+	if err != nil {
+		h.handleStorageError(ctx, c, span, err, "getUserHistory", "Failed to get user history")
+		return
+	}
+
+	log.Ctx(ctx).Info().Str("userId", id.Hex()).Int("entries", len(entries)).Msg("User history retrieved")
+	c.JSON(http.StatusOK, NewPagedResponse(entries, total, page.Limit, page.Offset, ""))
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/config"
+	"tracer/internal/storage"
+)
+
+// Paths reachable without credentials
+var publicPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/livez":   true,
+	"/metrics": true,
+	"/version": true,
+
+	"/docs":              true,
+	"/docs/openapi.yaml": true,
+}
+
+// Credentials are what a caller presented, whatever the transport
+type Credentials struct {
+	// Value of the X-API-Key header
+	APIKey string
+	// Value of the Authorization header
+	Authorization string
+}
+
+// Principal is the caller a set of credentials identified
+type Principal struct {
+	Subject string
+	// JWT callers are limited to their roles; other callers are not role-based
+	RoleBased bool
+	Roles     []string
+	// Tenant claim of a JWT caller, empty if it is not bound to one
+	Tenant string
+}
+
+// AuthError is returned by Authenticate for missing or invalid credentials.
+// Challenge is the WWW-Authenticate value to answer with.
+type AuthError struct {
+	Challenge string
+	Err       error
+}
+
+func (e *AuthError) Error() string {
+	return "unauthenticated: " + e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// Authenticate checks creds against the auth mode. On success it returns ctx
+// with the caller attached to its span, logger and audit actor. Other errors
+// than *AuthError mean the credentials could not be checked. When keys is
+// not nil, API keys are also looked up in it, except in JWT mode where
+// stored keys would carry no roles.
+func Authenticate(ctx context.Context, cfg config.AuthConfig, keys *storage.APIKeyStore, creds Credentials) (context.Context, Principal, error) {
+	// Static keys are checked first since they need no round trip
+	if presented := creds.APIKey; keys != nil && presented != "" && cfg.Mode != config.AuthModeJWT &&
+		!(cfg.Mode == config.AuthModeAPIKey && matchCredential(presented, cfg.Credentials)) {
+		return authenticateStoredKey(ctx, keys, presented)
+	}
+
+	if cfg.Mode == config.AuthModeJWT {
+		return authenticateJWT(ctx, cfg.JWT, creds.Authorization)
+	}
+
+	var presented string
+	switch cfg.Mode {
+	case config.AuthModeAPIKey:
+		presented = creds.APIKey
+	case config.AuthModeBearer:
+		if token, ok := strings.CutPrefix(creds.Authorization, "Bearer "); ok {
+			presented = strings.TrimSpace(token)
+		}
+	}
+
+	if presented == "" {
+		return ctx, Principal{}, &AuthError{Challenge: wwwAuthenticate(cfg.Mode), Err: errors.New("no credential")}
+	}
+	if !matchCredential(presented, cfg.Credentials) {
+		return ctx, Principal{}, &AuthError{Challenge: wwwAuthenticate(cfg.Mode), Err: errors.New("unknown credential")}
+	}
+
+	subject := credentialSubject(cfg.Mode, presented)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("auth.subject", subject))
+	return storage.WithActor(ctx, subject), Principal{Subject: subject}, nil
+}
+
+// AuthMiddleware rejects requests without a valid API key, bearer token or
+// JWT. Static credentials are identified on spans by a hash, never by value.
+func AuthMiddleware(cfg config.AuthConfig, keys *storage.APIKeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Mode == config.AuthModeNone || publicPaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		ctx, principal, err := Authenticate(c.Request.Context(), cfg, keys, Credentials{
+			APIKey:        c.GetHeader("X-API-Key"),
+			Authorization: c.GetHeader("Authorization"),
+		})
+		var authErr *AuthError
+		if errors.As(err, &authErr) {
+			log.Ctx(ctx).Warn().Err(err).Str("mode", cfg.Mode).Str("path", c.Request.URL.Path).Msg("Unauthorized request")
+			c.Header("WWW-Authenticate", authErr.Challenge)
+			abortWithError(c, codeUnauthorized, "Unauthorized")
+			return
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Failed to look up API key")
+			abortWithError(c, codeUnavailable, "Authentication temporarily unavailable")
+			return
+		}
+
+		c.Set("auth.subject", principal.Subject)
+		if principal.RoleBased {
+			c.Set(rolesKey, principal.Roles)
+			c.Set(tenantClaimKey, principal.Tenant)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// authenticateJWT validates the bearer JWT and makes its subject the end
+// user of the request: on the span as enduser.id, on every log line of the
+// request and as the actor of audit entries
+func authenticateJWT(ctx context.Context, cfg config.JWTConfig, authorization string) (context.Context, Principal, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return ctx, Principal{}, &AuthError{Challenge: "Bearer", Err: errors.New("no bearer token")}
+	}
+
+	claims, err := parseJWT(strings.TrimSpace(token), cfg, time.Now())
+	if err != nil {
+		return ctx, Principal{}, &AuthError{Challenge: `Bearer error="invalid_token"`, Err: err}
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		semconv.EnduserIDKey.String(claims.Subject),
+		semconv.EnduserRoleKey.String(strings.Join(claims.Roles, ",")),
+	)
+
+	logger := log.Ctx(ctx).With().Str("enduser.id", claims.Subject).Logger()
+	ctx = logger.WithContext(storage.WithActor(ctx, claims.Subject))
+
+	log.Ctx(ctx).Debug().Msg("Request authenticated")
+	return ctx, Principal{Subject: claims.Subject, RoleBased: true, Roles: claims.Roles, Tenant: claims.Tenant}, nil
+}
+
+func matchCredential(presented string, credentials []string) bool {
+	matched := false
+	for _, credential := range credentials {
+		// Compare against every credential to keep timing independent of position
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(credential)) == 1 {
+			matched = true
+		}
+	}
+	return matched
+}
+
+func credentialSubject(mode, credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return mode + ":" + hex.EncodeToString(sum[:])[:12]
+}
+
+func wwwAuthenticate(mode string) string {
+	if mode == config.AuthModeBearer {
+		return "Bearer"
+	}
+	return "APIKey"
+}
+
+// authenticateStoredKey accepts an API key found in the api_keys collection
+// and attaches the key's metadata to the span and the request logger
+func authenticateStoredKey(ctx context.Context, keys *storage.APIKeyStore, presented string) (context.Context, Principal, error) {
+	key, err := keys.Lookup(ctx, presented)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ctx, Principal{}, &AuthError{Challenge: "APIKey", Err: errors.New("unknown API key")}
+	}
+	if err != nil {
+		return ctx, Principal{}, err
+	}
+
+	subject := "apikey:" + key.ID.Hex()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("auth.subject", subject),
+		attribute.String("apikey.id", key.ID.Hex()),
+		attribute.String("apikey.name", key.Name),
+		attribute.String("apikey.owner", key.Owner),
+	)
+
+	logger := log.Ctx(ctx).With().
+		Str("apikey.id", key.ID.Hex()).
+		Str("apikey.name", key.Name).
+		Logger()
+	ctx = logger.WithContext(storage.WithActor(ctx, subject))
+	return ctx, Principal{Subject: subject}, nil
+}
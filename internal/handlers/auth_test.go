@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tracer/internal/config"
+	"tracer/internal/storage"
+)
+
+func TestAuthMiddlewareIgnoresAPIKeysInJWTMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.AuthConfig{
+		Mode: config.AuthModeJWT,
+		JWT:  config.JWTConfig{SigningKey: strings.Repeat("k", 32)},
+	}
+
+	router := gin.New()
+	// A store that was never connected: any lookup would panic
+	router.Use(AuthMiddleware(cfg, &storage.APIKeyStore{}))
+	router.DELETE("/users", authorize(false), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodDelete, "/users", nil)
+	req.Header.Set("X-API-Key", "stored-key")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body)
+	}
+}
+
+func TestLogLevelRoutesRequireAuthentication(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		key  string
+		want int
+	}{
+		{name: "auth off", mode: config.AuthModeNone, want: http.StatusUnauthorized},
+		{name: "valid key", mode: config.AuthModeAPIKey, key: "secret", want: http.StatusOK},
+		{name: "no key", mode: config.AuthModeAPIKey, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(AuthMiddleware(config.AuthConfig{Mode: tt.mode, Credentials: []string{"secret"}}, nil))
+			New(Options{}).Register(router)
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/log-level", nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
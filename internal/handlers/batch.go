@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/service"
+	"tracer/internal/storage"
+)
+
+// Largest number of users accepted by a single batch request
+const maxBatchSize = 1000
+
+const (
+	batchStatusCreated = "created"
+	batchStatusFailed  = "failed"
+	batchStatusSkipped = "skipped"
+)
+
+type batchItemResult struct {
+	Index  int          `json:"index"`
+	ID     string       `json:"id,omitempty"`
+	Status string       `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Fields []fieldError `json:"fields,omitempty"`
+}
+
+// createUsers inserts an array of users. With ?ordered=false every valid user
+// is attempted, otherwise insertion stops at the first invalid or failed user
+// and the rest are reported as skipped.
+func (h *Handler) createUsers(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "createUsers")
+	defer span.End()
+
+	ordered := true
+	if value := c.Query("ordered"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Invalid ordered parameter")
+			respondError(c, codeInvalidRequest, "ordered must be true or false")
+			return
+		}
+		ordered = parsed
+	}
+
+	// Decoded without binding validation so invalid users can be reported
+	// per item instead of failing the whole batch
+	var users []storage.User
+	if err := json.NewDecoder(c.Request.Body).Decode(&users); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Failed to bind JSON")
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+	if len(users) == 0 || len(users) > maxBatchSize {
+		respondError(c, codeInvalidRequest, fmt.Sprintf("batch must contain between 1 and %d users", maxBatchSize))
+		return
+	}
+
+	span.SetAttributes(
+		attribute.Int("batch.size", len(users)),
+		attribute.Bool("batch.ordered", ordered),
+	)
+
+	// Assign IDs up front so results can name every user, inserted or not
+	results := make([]batchItemResult, len(users))
+	pending := make([]storage.User, 0, len(users))
+	pendingIndex := make([]int, 0, len(users))
+	invalid := 0
+	for i := range users {
+		users[i].ID = storage.NewID()
+		results[i] = batchItemResult{Index: i, ID: users[i].ID.Hex(), Status: batchStatusSkipped}
+
+		if fields := validate(users[i]); len(fields) > 0 {
+			results[i].Status = batchStatusFailed
+			results[i].Error = codeInvalidRequest
+			results[i].Fields = fields
+			invalid++
+			continue
+		}
+		if ordered && invalid > 0 {
+			continue
+		}
+		pending = append(pending, users[i])
+		pendingIndex = append(pendingIndex, i)
+	}
+
+	if invalid > 0 {
+		span.AddEvent("validation.failed", trace.WithAttributes(attribute.Int("validation.invalid_items", invalid)))
+		log.Ctx(ctx).Warn().Int("invalid", invalid).Msg("Batch contains invalid users")
+	}
+
+	var created int64
+	for j, err := range h.users.CreateMany(ctx, pending, ordered) {
+		result := &results[pendingIndex[j]]
+		switch {
+		case err == nil:
+			result.Status = batchStatusCreated
+			created++
+		case errors.Is(err, service.ErrBatchSkipped):
+		default:
+			result.Status = batchStatusFailed
+			result.Error = serviceErrorCode(err)
+			log.Ctx(ctx).Warn().Err(err).Int("index", result.Index).Msg("User in batch not created")
+		}
+	}
+
+	span.SetAttributes(attribute.Int64("batch.created", created))
+
+	status := http.StatusCreated
+	if created < int64(len(users)) {
+		status = http.StatusMultiStatus
+	}
+
+	log.Ctx(ctx).Info().Int("size", len(users)).Int64("created", created).Msg("User batch processed")
+	c.JSON(status, NewPagedResponse(results, int64(len(results)), int64(len(results)), 0, ""))
+}
+
+// queryUsers returns every user whose ID is in the request body, fetched with
+// a single $in query. Unknown and soft-deleted IDs are left out of the result.
+func (h *Handler) queryUsers(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "queryUsers")
+	defer span.End()
+
+	var req idsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Failed to bind JSON")
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxBatchSize {
+		respondError(c, codeInvalidRequest, fmt.Sprintf("ids must contain between 1 and %d IDs", maxBatchSize))
+		return
+	}
+
+	ids, err := parseObjectIDs(req.IDs)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid user ID")
+		respondError(c, codeInvalidID, "Invalid user ID")
+		return
+	}
+
+	span.SetAttributes(attribute.Int("batch.size", len(ids)))
+
+	users, err := h.users.GetMany(ctx, ids)
+	if err != nil {
+		h.handleServiceError(ctx, c, span, err, "queryUsers", "Failed to query users")
+		return
+	}
+	if users == nil {
+		users = []storage.User{}
+	}
+
+	span.SetAttributes(attribute.Int("batch.found", len(users)))
+	total := int64(len(users))
+	c.JSON(http.StatusOK, NewPagedResponse(users, total, total, 0, ""))
+}
+
+// parseObjectIDs converts hex IDs, dropping duplicates.
+func parseObjectIDs(hexes []string) ([]storage.ID, error) {
+	seen := make(map[storage.ID]struct{}, len(hexes))
+	ids := make([]storage.ID, 0, len(hexes))
+	for _, hex := range hexes {
+		id, err := storage.ParseID(hex)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+type batchUpdateItem struct {
+	ID string `json:"id" binding:"required"`
+	storage.UserUpdate
+}
+
+type batchUpdateRequest struct {
+	Updates []batchUpdateItem `json:"updates" binding:"required,min=1,max=1000,dive"`
+}
+
+// updateUsers applies several user updates atomically in one MongoDB
+// transaction and returns the updated users in request order
+func (h *Handler) updateUsers(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "updateUsers")
+	defer span.End()
+
+	var req batchUpdateRequest
+	if !bindJSON(ctx, c, span, &req) {
+		return
+	}
+
+	changes := make([]service.UserChange, len(req.Updates))
+	for i, item := range req.Updates {
+		id, err := storage.ParseID(item.ID)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Int("index", i).Msg("Invalid user ID")
+			respondError(c, codeInvalidID, fmt.Sprintf("updates[%d]: Invalid user ID", i))
+			return
+		}
+		changes[i] = service.UserChange{ID: id, Update: item.UserUpdate}
+	}
+
+	span.SetAttributes(attribute.Int("batch.size", len(changes)))
+
+	users, err := h.users.UpdateMany(ctx, changes)
+	if err != nil {
+		h.handleServiceError(ctx, c, span, err, "updateUsers", "Failed to update users")
+		return
+	}
+
+	log.Ctx(ctx).Info().Int("count", len(users)).Msg("Users updated")
+	total := int64(len(users))
+	c.JSON(http.StatusOK, NewPagedResponse(users, total, total, 0, ""))
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"tracer/internal/storage"
+)
+
+func TestCreateUsersReportsEachUser(t *testing.T) {
+	s := newTestServer(t)
+	s.repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(0), nil)
+	s.repo.EXPECT().CreateMany(gomock.Any(), gomock.Len(2), false).Return(&storage.BatchInsertError{
+		Failed:    map[int]error{1: &storage.DuplicateKeyError{Field: "email"}},
+		Attempted: 2,
+	})
+
+	body := `[
+		{"name":"Alice","email":"alice@example.com"},
+		{"name":"","email":"bob@example.com"},
+		{"name":"Carol","email":"alice@example.com"}
+	]`
+	rec := s.do(http.MethodPost, "/users/batch?ordered=false", body)
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusMultiStatus, rec.Body)
+	}
+
+	var page PagedResponse[batchItemResult]
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	want := []struct{ status, code string }{
+		{batchStatusCreated, ""},
+		{batchStatusFailed, codeInvalidRequest},
+		{batchStatusFailed, codeConflict},
+	}
+	if len(page.Items) != len(want) {
+		t.Fatalf("results = %d, want %d", len(page.Items), len(want))
+	}
+	for i, result := range page.Items {
+		if result.Status != want[i].status || result.Error != want[i].code {
+			t.Errorf("results[%d] = %s %q, want %s %q", i, result.Status, result.Error, want[i].status, want[i].code)
+		}
+		if _, err := storage.ParseID(result.ID); err != nil {
+			t.Errorf("results[%d].id = %q, want an ObjectID", i, result.ID)
+		}
+	}
+	if ops := s.audit.operations(); len(ops) != 1 || ops[0] != "create" {
+		t.Errorf("audit entries = %v, want one create", ops)
+	}
+}
+
+func TestCreateUsersOrderedSkipsAfterFailure(t *testing.T) {
+	s := newTestServer(t)
+	s.repo.EXPECT().List(gomock.Any(), gomock.Any()).Return([]storage.User{{Email: "Taken@example.com"}}, int64(1), nil)
+	s.repo.EXPECT().CreateMany(gomock.Any(), gomock.Len(1), true).Return(nil)
+
+	body := `[
+		{"name":"Alice","email":"alice@example.com"},
+		{"name":"Bob","email":"taken@example.com"},
+		{"name":"Carol","email":"carol@example.com"}
+	]`
+	rec := s.do(http.MethodPost, "/users/batch", body)
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusMultiStatus, rec.Body)
+	}
+
+	var page PagedResponse[batchItemResult]
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	want := []string{batchStatusCreated, batchStatusFailed, batchStatusSkipped}
+	for i, result := range page.Items {
+		if result.Status != want[i] {
+			t.Errorf("results[%d].status = %s, want %s", i, result.Status, want[i])
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec documents every route registered by Register. Keep it in step
+// when routes, parameters or response bodies change.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// Swagger UI is loaded from a CDN so no assets have to be vendored
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Users API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "/docs/openapi.yaml", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`
+
+func serveSwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+func serveOpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml", openAPISpec)
+}
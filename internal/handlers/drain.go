@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Seconds clients are told to wait before retrying against another instance
+const drainRetryAfter = "5"
+
+// RejectWhenDraining answers new requests with 503 once draining is set.
+// Requests that got past it earlier are left to finish.
+func RejectWhenDraining(draining *atomic.Bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if draining.Load() {
+			c.Header("Connection", "close")
+			c.Header("Retry-After", drainRetryAfter)
+			abortWithError(c, codeUnavailable, "Server is shutting down")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRejectWhenDraining(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var draining atomic.Bool
+	started, finish := make(chan struct{}), make(chan struct{})
+
+	router := gin.New()
+	router.Use(RejectWhenDraining(&draining))
+	router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/slow", func(c *gin.Context) {
+		close(started)
+		<-finish
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := serve("/users"); rec.Code != http.StatusOK {
+		t.Fatalf("status before draining = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// A request already past the middleware is left to finish
+	inFlight := make(chan *httptest.ResponseRecorder)
+	go func() { inFlight <- serve("/slow") }()
+	<-started
+
+	draining.Store(true)
+	rec := serve("/users")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status while draining = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := rec.Header().Get("Connection"); got != "close" {
+		t.Errorf("Connection = %q, want close", got)
+	}
+	if got := rec.Header().Get("Retry-After"); got != drainRetryAfter {
+		t.Errorf("Retry-After = %q, want %q", got, drainRetryAfter)
+	}
+	if code := errorCode(t, rec); code != codeUnavailable {
+		t.Errorf("code = %q, want %q", code, codeUnavailable)
+	}
+
+	close(finish)
+	if rec := <-inFlight; rec.Code != http.StatusOK {
+		t.Errorf("in-flight status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,419 @@
+//go:build integration
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/mongodb"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"tracer/internal/config"
+	"tracer/internal/service"
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// startMongo runs MongoDB as a single-node replica set, so transactions
+// work, and returns its connection string
+func startMongo(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := mongodb.Run(ctx, "mongo:7", mongodb.WithReplicaSet("rs0"))
+	if err != nil {
+		t.Fatalf("start MongoDB: %v", err)
+	}
+	t.Cleanup(func() { container.Terminate(context.Background()) })
+
+	uri, err := container.ConnectionString(ctx)
+	if err != nil {
+		t.Fatalf("MongoDB connection string: %v", err)
+	}
+	return uri
+}
+
+// startJaeger runs Jaeger all-in-one and returns the host:port of its OTLP
+// gRPC receiver and the base URL of its query API
+func startJaeger(t *testing.T) (otlpEndpoint, queryURL string) {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "jaegertracing/all-in-one:1.60",
+			ExposedPorts: []string{"4317/tcp", "16686/tcp"},
+			WaitingFor:   wait.ForHTTP("/").WithPort("16686/tcp"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("start Jaeger: %v", err)
+	}
+	t.Cleanup(func() { container.Terminate(context.Background()) })
+
+	otlpEndpoint, err = container.PortEndpoint(ctx, "4317/tcp", "")
+	if err != nil {
+		t.Fatalf("Jaeger OTLP port: %v", err)
+	}
+	queryURL, err = container.PortEndpoint(ctx, "16686/tcp", "http")
+	if err != nil {
+		t.Fatalf("Jaeger query port: %v", err)
+	}
+	return otlpEndpoint, queryURL
+}
+
+// e2eServer serves the user routes from MongoDB and exports its spans over
+// OTLP, as main wires them
+type e2eServer struct {
+	router  *gin.Engine
+	service string
+	// Exports every span recorded so far and stops the tracer; call it once,
+	// after the last request
+	flush func(ctx context.Context) error
+}
+
+func newE2EServer(t *testing.T, mongoURI, otlpEndpoint string) *e2eServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	tracing := config.Default().Tracing
+	tracing.ServiceName = "users-" + strings.ToLower(strings.ReplaceAll(t.Name(), "/", "-"))
+	tracing.Exporter = config.TraceExporterOTLP
+	tracing.Endpoint = otlpEndpoint
+	tracing.Sampler = config.SamplerAlwaysOn
+
+	resources, err := telemetry.NewResource(tracing)
+	if err != nil {
+		t.Fatalf("NewResource() error = %v", err)
+	}
+	previous := otel.GetTracerProvider()
+	shutdownTracer, err := telemetry.InitTracer(tracing, config.ProfilingConfig{}, resources)
+	if err != nil {
+		t.Fatalf("InitTracer() error = %v", err)
+	}
+	t.Cleanup(func() {
+		shutdownTracer(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+
+	// Connect once the tracer provider is registered, since the monitor
+	// binds its tracer when it is created
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI(mongoURI).
+		SetDirect(true).
+		SetMonitor(otelmongo.NewMonitor()))
+	if err != nil {
+		t.Fatalf("connect to MongoDB: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	metrics, err := telemetry.NewMetrics(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+
+	tracer := telemetry.NewTracer()
+	db := client.Database(fmt.Sprintf("e2e_%d", time.Now().UnixNano()))
+	users := db.Collection("users")
+	if err := storage.EnsureIndexes(ctx, users, "en", false); err != nil {
+		t.Fatalf("EnsureIndexes() error = %v", err)
+	}
+	repo := storage.NewMongoUserRepository(users, tracer, 10*time.Second, "en", storage.RetryPolicy{}, nil)
+	audit := storage.NewAuditLog(db.Collection("audit_logs"), tracer, 10*time.Second, nil)
+
+	var draining atomic.Bool
+	h := New(Options{
+		Users:       service.NewUserService(repo, audit, storage.NewTransactor(client, tracer), tracer, metrics, nil, nil),
+		Audit:       audit,
+		Tracer:      tracer,
+		Metrics:     metrics,
+		Reporter:    telemetry.NoopReporter{},
+		Database:    repo,
+		Draining:    &draining,
+		Health:      config.HealthConfig{Timeout: time.Second},
+		MaxPageSize: 100,
+	})
+
+	router := gin.New()
+	router.Use(telemetry.Middleware(tracing.ServiceName, nil, false))
+	router.Use(telemetry.Recovery(telemetry.NoopReporter{}))
+	router.Use(ErrorHandler())
+	h.Register(router)
+
+	return &e2eServer{
+		router:  router,
+		service: tracing.ServiceName,
+		flush:   shutdownTracer,
+	}
+}
+
+// do sends a request with an optional JSON body and fails the test unless
+// it gets wantStatus
+func (s *e2eServer) do(t *testing.T, method, path, body string, wantStatus int, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != wantStatus {
+		t.Fatalf("%s %s: status = %d, want %d: %s", method, path, rec.Code, wantStatus, rec.Body)
+	}
+	return rec
+}
+
+// jaegerSpan is a span as Jaeger's query API returns it
+type jaegerSpan struct {
+	TraceID       string `json:"traceID"`
+	SpanID        string `json:"spanID"`
+	OperationName string `json:"operationName"`
+	References    []struct {
+		RefType string `json:"refType"`
+		SpanID  string `json:"spanID"`
+	} `json:"references"`
+	Tags []struct {
+		Key   string `json:"key"`
+		Value any    `json:"value"`
+	} `json:"tags"`
+}
+
+// tag returns the value of a span tag as a string, "" if it is not set
+func (s jaegerSpan) tag(key string) string {
+	for _, tag := range s.Tags {
+		if tag.Key == key {
+			return fmt.Sprint(tag.Value)
+		}
+	}
+	return ""
+}
+
+// findTraces polls Jaeger until it has a trace of service containing
+// operation, and returns the spans of every such trace. Spans are indexed
+// asynchronously, so they may take a moment to show up.
+func findTraces(t *testing.T, queryURL, service, operation string) [][]jaegerSpan {
+	t.Helper()
+	query := url.Values{"service": {service}, "operation": {operation}, "limit": {"20"}}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		var body struct {
+			Data []struct {
+				Spans []jaegerSpan `json:"spans"`
+			} `json:"data"`
+		}
+		resp, err := http.Get(queryURL + "/api/traces?" + query.Encode())
+		if err == nil {
+			err = json.NewDecoder(resp.Body).Decode(&body)
+			resp.Body.Close()
+		}
+		if err == nil && len(body.Data) > 0 {
+			traces := make([][]jaegerSpan, len(body.Data))
+			for i, trace := range body.Data {
+				traces[i] = trace.Spans
+			}
+			return traces
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s trace with %s in Jaeger (last error: %v)", service, operation, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// spanNamed returns the span of a trace with the given operation name
+func spanNamed(t *testing.T, spans []jaegerSpan, name string) jaegerSpan {
+	t.Helper()
+	for _, span := range spans {
+		if span.OperationName == name {
+			return span
+		}
+	}
+	t.Fatalf("trace has no span named %q", name)
+	return jaegerSpan{}
+}
+
+// childOf reports whether span has a CHILD_OF reference to parent
+func childOf(span, parent jaegerSpan) bool {
+	for _, ref := range span.References {
+		if ref.RefType == "CHILD_OF" && ref.SpanID == parent.SpanID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCreateUserSpansReachJaeger(t *testing.T) {
+	otlpEndpoint, queryURL := startJaeger(t)
+	s := newE2EServer(t, startMongo(t), otlpEndpoint)
+
+	rec := s.do(t, http.MethodPost, "/users", `{"name":"Alice","email":"alice@example.com"}`, http.StatusCreated)
+	var created storage.User
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.flush(ctx); err != nil {
+		t.Fatalf("ForceFlush() error = %v", err)
+	}
+
+	spans := findTraces(t, queryURL, s.service, "createUser")[0]
+	createSpan := spanNamed(t, spans, "createUser")
+	if id := createSpan.tag("user.id"); id != created.ID.Hex() {
+		t.Errorf("createUser user.id = %q, want %q", id, created.ID.Hex())
+	}
+	serviceSpan := spanNamed(t, spans, "UserService.Create")
+	if !childOf(serviceSpan, createSpan) {
+		t.Error("UserService.Create is not a child of createUser")
+	}
+	if audit := spanNamed(t, spans, "writeAudit"); !childOf(audit, serviceSpan) {
+		t.Error("writeAudit is not a child of UserService.Create")
+	}
+	repoSpan := spanNamed(t, spans, "UserRepository.Create")
+	insert := spanNamed(t, spans, "users.insert")
+	if !childOf(insert, repoSpan) {
+		t.Error("users.insert is not a child of UserRepository.Create")
+	}
+	if op := insert.tag("db.operation"); op != "insert" {
+		t.Errorf("users.insert db.operation = %q, want insert", op)
+	}
+}
+
+// parent returns the ID of the span s is a child of, "" for a root span
+func (s jaegerSpan) parent() string {
+	for _, ref := range s.References {
+		if ref.RefType == "CHILD_OF" {
+			return ref.SpanID
+		}
+	}
+	return ""
+}
+
+// descends reports whether span is below ancestor in the trace
+func descends(spans []jaegerSpan, span, ancestor jaegerSpan) bool {
+	byID := make(map[string]jaegerSpan, len(spans))
+	for _, s := range spans {
+		byID[s.SpanID] = s
+	}
+	for id := span.parent(); id != ""; id = byID[id].parent() {
+		if id == ancestor.SpanID {
+			return true
+		}
+		if _, ok := byID[id]; !ok {
+			return false
+		}
+	}
+	return false
+}
+
+func TestUserRoutesExportConnectedSpans(t *testing.T) {
+	otlpEndpoint, queryURL := startJaeger(t)
+	s := newE2EServer(t, startMongo(t), otlpEndpoint)
+
+	rec := s.do(t, http.MethodPost, "/users", `{"name":"Alice","email":"alice@example.com"}`, http.StatusCreated)
+	var created storage.User
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	id := created.ID.Hex()
+	put := fmt.Sprintf(`{"name":"Alice Smith","email":"alice@example.com","version":%d}`, created.Version)
+
+	s.do(t, http.MethodGet, "/users/"+id, "", http.StatusOK)
+	s.do(t, http.MethodGet, "/users?sort=name", "", http.StatusOK)
+	s.do(t, http.MethodPut, "/users/"+id, put, http.StatusOK)
+	s.do(t, http.MethodPatch, "/users/"+id, `{"name":"Alice Jones"}`, http.StatusOK)
+	s.do(t, http.MethodDelete, "/users/"+id, "", http.StatusOK)
+	s.do(t, http.MethodPost, "/users/"+id+"/restore", "", http.StatusOK)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.flush(ctx); err != nil {
+		t.Fatalf("flush spans: %v", err)
+	}
+
+	tests := []struct {
+		handler, service, repository string
+		operation                    string
+		// Attributes the handler span must carry
+		attributes map[string]string
+	}{
+		{"createUser", "UserService.Create", "UserRepository.Create", "insert", map[string]string{"user.id": id}},
+		{"getUser", "UserService.Get", "UserRepository.GetByID", "findOne", map[string]string{"user.id": id}},
+		{"listUsers", "UserService.List", "UserRepository.List", "find", map[string]string{"db.sort": "name", "page.total": "1"}},
+		{"updateUser", "UserService.Update", "UserRepository.Update", "findOneAndUpdate", map[string]string{"user.id": id}},
+		{"patchUser", "UserService.Update", "UserRepository.Update", "findOneAndUpdate", map[string]string{"user.id": id}},
+		{"deleteUser", "UserService.Delete", "UserRepository.Delete", "findOneAndUpdate", map[string]string{"user.id": id}},
+		{"restoreUser", "UserService.Restore", "UserRepository.Restore", "findOneAndUpdate", map[string]string{"user.id": id}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.handler, func(t *testing.T) {
+			traces := findTraces(t, queryURL, s.service, tt.handler)
+			if len(traces) != 1 {
+				t.Fatalf("traces with %s = %d, want 1", tt.handler, len(traces))
+			}
+			spans := traces[0]
+
+			handler := spanNamed(t, spans, tt.handler)
+			for key, want := range tt.attributes {
+				if got := handler.tag(key); got != want {
+					t.Errorf("%s %s = %q, want %q", tt.handler, key, got, want)
+				}
+			}
+
+			// The request span started by the middleware is the root
+			var server jaegerSpan
+			for _, span := range spans {
+				if span.tag("span.kind") == "server" {
+					server = span
+				}
+			}
+			if server.SpanID == "" || server.parent() != "" {
+				t.Fatalf("trace has no root server span")
+			}
+			if handler.parent() != server.SpanID {
+				t.Errorf("%s is not a child of the server span", tt.handler)
+			}
+
+			svc := spanNamed(t, spans, tt.service)
+			if !descends(spans, svc, handler) {
+				t.Errorf("%s is not below %s", tt.service, tt.handler)
+			}
+			repo := spanNamed(t, spans, tt.repository)
+			if !descends(spans, repo, svc) {
+				t.Errorf("%s is not below %s", tt.repository, tt.service)
+			}
+			if got := repo.tag("db.operation"); got != tt.operation {
+				t.Errorf("%s db.operation = %q, want %q", tt.repository, got, tt.operation)
+			}
+			if got := repo.tag("db.system"); got != "mongodb" {
+				t.Errorf("%s db.system = %q, want mongodb", tt.repository, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorHandler records every error attached to the request with c.Error on
+// the server span and marks the span as failed. Handlers write errors with
+// respondError or handleServiceError, which attach them; an error attached
+// without a response, such as one from middleware, is rendered here as the
+// error envelope. It must run inside the metrics middleware so the rendered
+// status is counted.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 {
+			return
+		}
+
+		span := trace.SpanFromContext(c.Request.Context())
+		for _, ginErr := range c.Errors {
+			span.RecordError(ginErr.Err)
+		}
+
+		last := asRequestError(c.Errors.Last().Err)
+		span.SetAttributes(attribute.String("error.code", last.code))
+		span.SetStatus(codes.Error, last.message)
+
+		if !c.Writer.Written() {
+			c.JSON(statusOf(last.code), newAPIError(c, last.code, last.message, last.details))
+		}
+	}
+}
+
+// asRequestError returns the response an error attached to the request is
+// answered with. Handlers attach a *requestError through writeError, which
+// carries its own code; anything else attached with c.Error is a fault.
+func asRequestError(err error) *requestError {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr
+	}
+	return &requestError{code: codeInternal, message: "Internal server error", cause: err}
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/service"
+	"tracer/internal/storage"
+)
+
+// Error codes returned in the code field of error responses. Clients
+// should branch on these rather than on messages, which may change.
+const (
+	codeInvalidRequest        = "invalid_request"
+	codeInvalidID             = "invalid_id"
+	codeUnauthorized          = "unauthorized"
+	codeForbidden             = "forbidden"
+	codeNotFound              = "not_found"
+	codeConflict              = "conflict"
+	codePayloadTooLarge       = "payload_too_large"
+	codeIdempotencyInProgress = "idempotency_in_progress"
+	codeIdempotencyMismatch   = "idempotency_mismatch"
+	codePreconditionFailed    = "precondition_failed"
+	codePreconditionRequired  = "precondition_required"
+	codeVersionConflict       = "version_conflict"
+	codeRateLimited           = "rate_limited"
+	codeUnavailable           = "unavailable"
+	codeTimeout               = "timeout"
+	codeInternal              = "internal"
+)
+
+// errorStatus is the HTTP status sent with each error code
+var errorStatus = map[string]int{
+	codeInvalidRequest:        http.StatusBadRequest,
+	codeInvalidID:             http.StatusBadRequest,
+	codeUnauthorized:          http.StatusUnauthorized,
+	codeForbidden:             http.StatusForbidden,
+	codeNotFound:              http.StatusNotFound,
+	codeConflict:              http.StatusConflict,
+	codePayloadTooLarge:       http.StatusRequestEntityTooLarge,
+	codeIdempotencyInProgress: http.StatusConflict,
+	codeIdempotencyMismatch:   http.StatusUnprocessableEntity,
+	codePreconditionFailed:    http.StatusPreconditionFailed,
+	codePreconditionRequired:  http.StatusPreconditionRequired,
+	codeVersionConflict:       http.StatusConflict,
+	codeRateLimited:           http.StatusTooManyRequests,
+	codeUnavailable:           http.StatusServiceUnavailable,
+	codeTimeout:               http.StatusGatewayTimeout,
+	codeInternal:              http.StatusInternalServerError,
+}
+
+func statusOf(code string) int {
+	if status, ok := errorStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// apiError is the body of every error response
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Structured context, such as the fields that failed validation
+	Details any `json:"details,omitempty"`
+	// Trace of the failed request, for looking it up in Jaeger
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+func newAPIError(c *gin.Context, code, message string, details any) apiError {
+	body := apiError{Code: code, Message: message, Details: details}
+	if sc := trace.SpanContextFromContext(c.Request.Context()); sc.IsValid() {
+		body.TraceID = sc.TraceID().String()
+	}
+	return body
+}
+
+// requestError is an error response attached to the request with c.Error,
+// so ErrorHandler can record it on the server span
+type requestError struct {
+	code    string
+	message string
+	details any
+	// What went wrong underneath, if anything
+	cause error
+}
+
+func (e *requestError) Error() string {
+	if e.cause != nil {
+		return e.message + ": " + e.cause.Error()
+	}
+	return e.message
+}
+
+func (e *requestError) Unwrap() error {
+	return e.cause
+}
+
+// respondError writes the error response for code with the status mapped to it
+func respondError(c *gin.Context, code, message string) {
+	writeError(c, &requestError{code: code, message: message})
+}
+
+func respondErrorDetails(c *gin.Context, code, message string, details any) {
+	writeError(c, &requestError{code: code, message: message, details: details})
+}
+
+// abortWithError is respondError for middleware that stops the chain
+func abortWithError(c *gin.Context, code, message string) {
+	c.Abort()
+	respondError(c, code, message)
+}
+
+// writeError attaches err to the request and writes it as the error envelope
+func writeError(c *gin.Context, err *requestError) {
+	_ = c.Error(err)
+	c.JSON(statusOf(err.code), newAPIError(c, err.code, err.message, err.details))
+}
+
+// Client-facing messages for mapped storage errors. Internal errors use the
+// message supplied by the handler.
+var storageErrorMessages = map[string]string{
+	codeNotFound:    "User not found",
+	codeConflict:    "User already exists",
+	codeUnavailable: "Database temporarily unavailable",
+	codeTimeout:     "Database operation timed out",
+}
+
+// mapStorageError translates a storage error into an error code
+func mapStorageError(err error) string {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return codeNotFound
+	case storage.IsDuplicateKey(err):
+		return codeConflict
+	case storage.IsTimeout(err):
+		return codeTimeout
+	case storage.IsUnavailable(err):
+		return codeUnavailable
+	default:
+		return codeInternal
+	}
+}
+
+// handleStorageError logs a failed storage operation, reports it when it is
+// a server fault and writes the mapped error response
+func (h *Handler) handleStorageError(ctx context.Context, c *gin.Context, span trace.Span, err error, handler, message string) {
+	storage.RecordTimeout(ctx, span, err)
+
+	code := mapStorageError(err)
+	status := statusOf(code)
+	h.metrics.MongoErrors.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("handler", handler),
+		attribute.String("error.code", code),
+	))
+	if mapped, ok := storageErrorMessages[code]; ok {
+		message = mapped
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, message)
+	if status >= http.StatusInternalServerError {
+		log.Ctx(ctx).Error().Err(err).Str("handler", handler).Int("status", status).Msg(message)
+		h.reporter.Report(ctx, err, map[string]string{"handler": handler})
+	} else {
+		log.Ctx(ctx).Warn().Err(err).Str("handler", handler).Int("status", status).Msg(message)
+	}
+
+	writeError(c, &requestError{code: code, message: message, cause: err})
+}
+
+// handleServiceError writes the response for an error returned by UserService.
+// Business rule violations map to 4xx; anything else came from storage.
+func (h *Handler) handleServiceError(ctx context.Context, c *gin.Context, span trace.Span, err error, handler, message string) {
+	var invalid service.ValidationError
+	var duplicate *storage.DuplicateKeyError
+	switch {
+	case errors.As(err, &invalid):
+		log.Ctx(ctx).Warn().Err(err).Str("handler", handler).Msg("Invalid user")
+		span.SetStatus(codes.Error, "invalid user")
+		respondError(c, codeInvalidRequest, invalid.Error())
+	case errors.Is(err, service.ErrEmailTaken):
+		respondConflict(ctx, c, span, err, handler, conflictField(err))
+	case errors.Is(err, storage.ErrVersionConflict):
+		log.Ctx(ctx).Warn().Err(err).Str("handler", handler).Msg("Stale user version")
+		span.SetStatus(codes.Error, "version conflict")
+		respondError(c, codeVersionConflict, versionConflictMessage)
+	case errors.As(err, &duplicate):
+		// Lost a race with a concurrent write that passed the same pre-check
+		h.metrics.MongoErrors.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("handler", handler),
+			attribute.String("error.code", codeConflict),
+		))
+		respondConflict(ctx, c, span, err, handler, duplicate.Field)
+	default:
+		h.handleStorageError(ctx, c, span, err, handler, message)
+	}
+}
+
+// serviceErrorCode is the error code handleServiceError would answer err
+// with, for reporting failures of single items in a batch
+func serviceErrorCode(err error) string {
+	var invalid service.ValidationError
+	var duplicate *storage.DuplicateKeyError
+	switch {
+	case errors.As(err, &invalid):
+		return codeInvalidRequest
+	case errors.Is(err, service.ErrEmailTaken), errors.As(err, &duplicate):
+		return codeConflict
+	case errors.Is(err, storage.ErrVersionConflict):
+		return codeVersionConflict
+	default:
+		return mapStorageError(err)
+	}
+}
+
+// serviceErrorMessage is the client-facing message for err, which
+// serviceErrorCode mapped to code. Internal errors get fallback, the message
+// supplied by the caller.
+func serviceErrorMessage(err error, code, fallback string) string {
+	var invalid service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return invalid.Error()
+	case code == codeConflict:
+		return conflictMessage(conflictField(err))
+	case code == codeVersionConflict:
+		return versionConflictMessage
+	}
+	if message, ok := storageErrorMessages[code]; ok {
+		return message
+	}
+	return fallback
+}
+
+const versionConflictMessage = "User was modified by another request"
+
+// conflictField is the field err says must be unique, "" when unknown
+func conflictField(err error) string {
+	var duplicate *storage.DuplicateKeyError
+	switch {
+	case errors.Is(err, service.ErrEmailTaken):
+		return "email"
+	case errors.As(err, &duplicate):
+		return duplicate.Field
+	default:
+		return ""
+	}
+}
+
+// conflictMessage names the field that must be unique, when it is known
+func conflictMessage(field string) string {
+	if field == "" {
+		return storageErrorMessages[codeConflict]
+	}
+	return fmt.Sprintf("A user with this %s already exists", field)
+}
+
+// respondConflict answers 409 naming the field that must be unique, and marks
+// the span as failed since the write did not happen
+func respondConflict(ctx context.Context, c *gin.Context, span trace.Span, err error, handler, field string) {
+	message := conflictMessage(field)
+	if field != "" {
+		span.SetAttributes(attribute.String("error.field", field))
+	}
+	span.SetStatus(codes.Error, message)
+
+	log.Ctx(ctx).Warn().Err(err).Str("handler", handler).Str("field", field).Msg(message)
+
+	var details any
+	if field != "" {
+		details = gin.H{"field": field}
+	}
+	writeError(c, &requestError{code: codeConflict, message: message, details: details, cause: err})
+}
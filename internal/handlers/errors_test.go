@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"tracer/internal/storage"
+)
+
+func TestMapStorageError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   string
+		wantStatus int
+	}{
+		{name: "not found", err: storage.ErrNotFound, wantCode: codeNotFound, wantStatus: http.StatusNotFound},
+		{name: "wrapped not found", err: fmt.Errorf("get user: %w", storage.ErrNotFound), wantCode: codeNotFound, wantStatus: http.StatusNotFound},
+		{name: "duplicate key", err: &storage.DuplicateKeyError{Field: "email"}, wantCode: codeConflict, wantStatus: http.StatusConflict},
+		{name: "circuit open", err: storage.ErrCircuitOpen, wantCode: codeUnavailable, wantStatus: http.StatusServiceUnavailable},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, wantCode: codeTimeout, wantStatus: http.StatusGatewayTimeout},
+		{name: "other", err: errors.New("boom"), wantCode: codeInternal, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := mapStorageError(tt.err)
+			if code != tt.wantCode {
+				t.Errorf("mapStorageError() = %q, want %q", code, tt.wantCode)
+			}
+			if status := statusOf(code); status != tt.wantStatus {
+				t.Errorf("statusOf(%q) = %d, want %d", code, status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/storage"
+)
+
+// userETag is a strong validator built from the user's version, which
+// changes on every write
+func userETag(user storage.User) string {
+	return `"v` + strconv.FormatInt(user.Version, 10) + `"`
+}
+
+// etagVersion returns the version named by an ETag issued by userETag
+func etagVersion(etag string) (int64, bool) {
+	etag = strings.TrimSpace(etag)
+	if !strings.HasPrefix(etag, `"v`) || !strings.HasSuffix(etag, `"`) || len(etag) < 4 {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(etag[2:len(etag)-1], 10, 64)
+	return version, err == nil
+}
+
+// etagMatches reports whether header, an If-Match or If-None-Match value,
+// is * or lists etag. Weak tags never match since only strong ones are issued.
+func etagMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// weakToStrong drops the W/ prefix from every tag in header, since
+// If-None-Match uses the weak comparison
+func weakToStrong(header string) string {
+	return strings.ReplaceAll(header, "W/", "")
+}
+
+// ifMatchVersion turns the If-Match header into the version an update must
+// find, so the check happens in the same write as the update. It returns
+// nil for * and ok=false, after answering 412, for a tag no user can have.
+func ifMatchVersion(ctx context.Context, c *gin.Context, span trace.Span, header string) (*int64, bool) {
+	if strings.TrimSpace(header) == "*" {
+		return nil, true
+	}
+	version, ok := etagVersion(header)
+	if !ok {
+		respondPreconditionFailed(ctx, c, span, "")
+		return nil, false
+	}
+	return &version, true
+}
+
+// checkIfMatch compares the client's If-Match header with the current version
+// of the user, so deletes based on a stale copy are rejected. Requests
+// without the header are refused. On failure the error response has already
+// been written.
+func (h *Handler) checkIfMatch(ctx context.Context, c *gin.Context, span trace.Span, id storage.ID, handler string) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		respondPreconditionRequired(ctx, c, handler)
+		return false
+	}
+
+	current, err := h.users.Get(ctx, id, false)
+	if err != nil {
+		h.handleServiceError(ctx, c, span, err, handler, "Failed to get user")
+		return false
+	}
+
+	if etag := userETag(current); !etagMatches(header, etag) {
+		respondPreconditionFailed(ctx, c, span, etag)
+		return false
+	}
+	return true
+}
+
+func respondPreconditionRequired(ctx context.Context, c *gin.Context, handler string) {
+	log.Ctx(ctx).Warn().Str("handler", handler).Msg("Missing If-Match header")
+	respondError(c, codePreconditionRequired, "If-Match header is required")
+}
+
+// respondPreconditionFailed answers 412, including the current ETag when known
+func respondPreconditionFailed(ctx context.Context, c *gin.Context, span trace.Span, etag string) {
+	span.SetAttributes(attribute.Bool("http.precondition_failed", true))
+	log.Ctx(ctx).Warn().Msg("User was modified since it was retrieved")
+	if etag != "" {
+		c.Header("ETag", etag)
+	}
+	respondError(c, codePreconditionFailed, "User was modified since it was retrieved")
+}
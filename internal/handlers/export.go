@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+
+	"tracer/internal/storage"
+)
+
+// Number of documents written between flushes of the response
+const streamFlushInterval = 100
+
+// streamUsers writes every active user as a JSON array, one document at a time,
+// without loading the whole collection into memory. Clients asking for
+// text/event-stream get the live change feed from watchUsers instead.
+func (h *Handler) streamUsers(c *gin.Context) {
+	if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		h.watchUsers(c)
+		return
+	}
+
+	ctx, span := h.tracer.Start(c.Request.Context(), "streamUsers")
+	defer span.End()
+
+	var emitted int64
+	defer func() {
+		span.SetAttributes(attribute.Int64("stream.documents", emitted))
+	}()
+
+	// The response starts with the first user, so a query that fails up
+	// front still gets a proper error response
+	started := false
+	start := func() error {
+		started = true
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusOK)
+		_, err := c.Writer.WriteString("[")
+		return err
+	}
+
+	err := h.users.Export(ctx, func(user storage.User) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(user)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Failed to encode user")
+			return err
+		}
+
+		if emitted > 0 {
+			data = append([]byte(","), data...)
+		}
+		if _, err := c.Writer.Write(data); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Int64("emitted", emitted).Msg("Client went away during stream")
+			return err
+		}
+
+		emitted++
+		if emitted%streamFlushInterval == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil && !started {
+		h.handleServiceError(ctx, c, span, err, "streamUsers", "Failed to stream users")
+		return
+	}
+	// Leave the array unterminated on failure so the client can tell the
+	// export is incomplete
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Int64("emitted", emitted).Msg("User stream failed")
+		return
+	}
+	if !started && start() != nil {
+		return
+	}
+
+	c.Writer.WriteString("]")
+	c.Writer.Flush()
+
+	log.Ctx(ctx).Info().Int64("emitted", emitted).Msg("Users streamed")
+}
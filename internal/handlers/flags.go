@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/flags"
+	"tracer/internal/telemetry"
+)
+
+// FeatureFlags lets handlers call flags.IsEnabled with the request context.
+// Callers are bucketed by tenant, else credential subject, else client IP,
+// so it must run after authentication and tenant resolution. The flags
+// evaluated while serving the request are recorded on the server span.
+func FeatureFlags(provider flags.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := flags.WithProvider(c.Request.Context(), provider, rolloutKey(c))
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if evaluated := flags.Evaluated(ctx); len(evaluated) > 0 {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.StringSlice("feature_flag.evaluated", evaluated))
+		}
+	}
+}
+
+func rolloutKey(c *gin.Context) string {
+	if tenant := telemetry.TenantFromContext(c.Request.Context()); tenant != "" {
+		return "tenant:" + tenant
+	}
+	if subject := c.GetString("auth.subject"); subject != "" {
+		return "subject:" + subject
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -0,0 +1,6 @@
+// Package graph is the gqlgen executable schema for the /graphql endpoint.
+// Edit schema.graphqls and regenerate; the resolvers live in the handlers
+// package.
+package graph
+
+//go:generate go run github.com/99designs/gqlgen@v0.17.49 generate
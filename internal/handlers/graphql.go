@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/99designs/gqlgen/graphql"
+	gqlhandler "github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"tracer/internal/handlers/graph"
+	"tracer/internal/handlers/graph/model"
+	"tracer/internal/storage"
+)
+
+// graphQLResolver resolves the queries and mutations in
+// graph/schema.graphqls over the user service
+type graphQLResolver struct {
+	h *Handler
+}
+
+// graphqlHandler serves GraphQL queries and mutations over the user service.
+// Every resolver runs in its own span named after the field it resolves.
+func (h *Handler) graphqlHandler() gin.HandlerFunc {
+	srv := gqlhandler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graphQLResolver{h: h}}))
+	srv.AddTransport(transport.POST{})
+	srv.Use(extension.Introspection{})
+	srv.AroundFields(h.traceResolver)
+	srv.AroundResponses(func(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+		resp := next(ctx)
+		if resp != nil && len(resp.Errors) > 0 {
+			operation := ""
+			if graphql.HasOperationContext(ctx) {
+				operation = graphql.GetOperationContext(ctx).OperationName
+			}
+			log.Ctx(ctx).Warn().Int("errors", len(resp.Errors)).Str("operation", operation).Msg("GraphQL request had errors")
+		}
+		return resp
+	})
+
+	return gin.WrapH(srv)
+}
+
+// traceResolver runs each resolver in a span named after the resolved
+// field, e.g. "Query.users", so slow fields stand out in Jaeger. Fields
+// read straight off a resolved object get no span.
+func (h *Handler) traceResolver(ctx context.Context, next graphql.Resolver) (any, error) {
+	field := graphql.GetFieldContext(ctx)
+	if !field.IsResolver {
+		return next(ctx)
+	}
+
+	ctx, span := h.tracer.Start(ctx, field.Object+"."+field.Field.Name)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("graphql.field.name", field.Field.Name),
+		attribute.String("graphql.field.parent", field.Object),
+	)
+
+	result, err := next(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return result, err
+}
+
+// graphQLError is a resolver error carrying the same code as the REST API
+// in its extensions
+func graphQLError(code, message string) *gqlerror.Error {
+	return &gqlerror.Error{
+		Message:    message,
+		Extensions: map[string]any{"code": code},
+	}
+}
+
+// graphQLServiceError is the GraphQL counterpart of handleServiceError,
+// answering with the same code and message as the REST API
+func (h *Handler) graphQLServiceError(ctx context.Context, err error, message string) error {
+	code := serviceErrorCode(err)
+	message = serviceErrorMessage(err, code, message)
+	if statusOf(code) >= http.StatusInternalServerError {
+		log.Ctx(ctx).Error().Err(err).Msg(message)
+		h.reporter.Report(ctx, err, map[string]string{"handler": "graphql"})
+	}
+	return graphQLError(code, message)
+}
+
+func graphQLID(raw string) (storage.ID, error) {
+	id, err := storage.ParseID(raw)
+	if err != nil {
+		return id, graphQLError(codeInvalidID, "Invalid user ID")
+	}
+	return id, nil
+}
+
+func graphQLUser(user storage.User) *model.User {
+	return &model.User{
+		ID:        user.ID.Hex(),
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		DeletedAt: user.DeletedAt,
+		Version:   user.Version,
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.49
+
+import (
+	"context"
+	"errors"
+	"tracer/internal/handlers/graph"
+	"tracer/internal/handlers/graph/model"
+	"tracer/internal/storage"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CreateUser is the resolver for the createUser field.
+func (r *mutationGraphQLResolver) CreateUser(ctx context.Context, name string, email string) (*model.User, error) {
+	user := storage.User{Name: name, Email: email}
+	if err := r.h.users.Create(ctx, &user); err != nil {
+		return nil, r.h.graphQLServiceError(ctx, err, "Failed to create user")
+	}
+
+	log.Ctx(ctx).Info().Str("userId", user.ID.Hex()).Msg("User created")
+	return graphQLUser(user), nil
+}
+
+// UpdateUser is the resolver for the updateUser field.
+func (r *mutationGraphQLResolver) UpdateUser(ctx context.Context, id string, name *string, email *string, version *int64) (*model.User, error) {
+	userID, err := graphQLID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	update := storage.UserUpdate{Version: version}
+	if name != nil {
+		update.Name = storage.Some(*name)
+	}
+	if email != nil {
+		update.Email = storage.Some(*email)
+	}
+
+	user, err := r.h.users.Update(ctx, userID, update)
+	if err != nil {
+		return nil, r.h.graphQLServiceError(ctx, err, "Failed to update user")
+	}
+
+	log.Ctx(ctx).Info().Str("userId", id).Msg("User updated")
+	return graphQLUser(user), nil
+}
+
+// DeleteUser is the resolver for the deleteUser field.
+func (r *mutationGraphQLResolver) DeleteUser(ctx context.Context, id string) (bool, error) {
+	userID, err := graphQLID(id)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.h.users.Delete(ctx, userID); err != nil {
+		return false, r.h.graphQLServiceError(ctx, err, "Failed to delete user")
+	}
+
+	log.Ctx(ctx).Info().Str("userId", id).Msg("User deleted")
+	return true, nil
+}
+
+// RestoreUser is the resolver for the restoreUser field.
+func (r *mutationGraphQLResolver) RestoreUser(ctx context.Context, id string) (*model.User, error) {
+	userID, err := graphQLID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := r.h.users.Restore(ctx, userID)
+	if err != nil {
+		return nil, r.h.graphQLServiceError(ctx, err, "Failed to restore user")
+	}
+
+	log.Ctx(ctx).Info().Str("userId", id).Msg("User restored")
+	return graphQLUser(user), nil
+}
+
+// User is the resolver for the user field.
+func (r *queryGraphQLResolver) User(ctx context.Context, id string, includeDeleted *bool) (*model.User, error) {
+	userID, err := graphQLID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := r.h.users.Get(ctx, userID, includeDeleted != nil && *includeDeleted)
+	if errors.Is(err, storage.ErrNotFound) {
+		// A missing user is null rather than an error, as usual in GraphQL
+		return nil, nil
+	}
+	if err != nil {
+		return nil, r.h.graphQLServiceError(ctx, err, "Failed to get user")
+	}
+	return graphQLUser(user), nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryGraphQLResolver) Users(ctx context.Context, limit *int64, offset *int64, includeDeleted *bool) (*model.UserPage, error) {
+	pageLimit := r.h.maxPageSize
+	if limit != nil && *limit < pageLimit {
+		pageLimit = *limit
+	}
+	var pageOffset int64
+	if offset != nil {
+		pageOffset = *offset
+	}
+	if pageLimit < 1 || pageOffset < 0 {
+		return nil, graphQLError(codeInvalidRequest, "limit must be positive and offset must not be negative")
+	}
+
+	users, total, err := r.h.users.List(ctx, storage.UserQuery{
+		Sort:           userSorts[defaultSort],
+		Limit:          pageLimit,
+		Offset:         pageOffset,
+		IncludeDeleted: includeDeleted != nil && *includeDeleted,
+	})
+	if err != nil {
+		return nil, r.h.graphQLServiceError(ctx, err, "Failed to list users")
+	}
+
+	items := make([]*model.User, len(users))
+	for i, user := range users {
+		items[i] = graphQLUser(user)
+	}
+	return &model.UserPage{Items: items, Total: total}, nil
+}
+
+// Mutation returns graph.MutationResolver implementation.
+func (r *graphQLResolver) Mutation() graph.MutationResolver { return &mutationGraphQLResolver{r} }
+
+// Query returns graph.QueryResolver implementation.
+func (r *graphQLResolver) Query() graph.QueryResolver { return &queryGraphQLResolver{r} }
+
+type mutationGraphQLResolver struct{ *graphQLResolver }
+type queryGraphQLResolver struct{ *graphQLResolver }
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/mock/gomock"
+
+	"tracer/internal/service"
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+type graphQLResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func (s *testServer) graphql(t *testing.T, query string) graphQLResponse {
+	t.Helper()
+	body, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		t.Fatalf("encode query: %v", err)
+	}
+
+	rec := s.do(http.MethodPost, "/graphql", string(body))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var resp graphQLResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode body %q: %v", rec.Body.String(), err)
+	}
+	return resp
+}
+
+func TestGraphQLMissingUserIsNull(t *testing.T) {
+	s := newTestServer(t)
+	id := primitive.NewObjectID()
+	s.repo.EXPECT().GetByID(gomock.Any(), id, false).Return(storage.User{}, storage.ErrNotFound)
+
+	resp := s.graphql(t, `{ user(id: "`+id.Hex()+`") { id name } }`)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("errors = %+v, want none", resp.Errors)
+	}
+	if user := string(resp.Data["user"]); user != "null" {
+		t.Errorf("user = %s, want null", user)
+	}
+	s.span(t, "Query.user")
+}
+
+func TestGraphQLResolverErrorCarriesCode(t *testing.T) {
+	s := newTestServer(t)
+
+	resp := s.graphql(t, `mutation { createUser(name: "", email: "alice@example.com") { id } }`)
+	if len(resp.Errors) != 1 {
+		t.Fatalf("errors = %+v, want one", resp.Errors)
+	}
+	if code := resp.Errors[0].Extensions["code"]; code != codeInvalidRequest {
+		t.Errorf("extensions.code = %v, want %q", code, codeInvalidRequest)
+	}
+	if status := s.span(t, "Mutation.createUser").Status().Code; status != codes.Error {
+		t.Errorf("Mutation.createUser status = %v, want Error", status)
+	}
+}
+
+func TestGraphQLServiceErrorMatchesREST(t *testing.T) {
+	h := &Handler{reporter: telemetry.NoopReporter{}}
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    string
+		wantMessage string
+	}{
+		{name: "invalid", err: service.ValidationError{Message: "name is required"}, wantCode: codeInvalidRequest, wantMessage: "name is required"},
+		{name: "email taken", err: service.ErrEmailTaken, wantCode: codeConflict, wantMessage: "A user with this email already exists"},
+		{name: "duplicate key", err: &storage.DuplicateKeyError{Field: "email"}, wantCode: codeConflict, wantMessage: "A user with this email already exists"},
+		{name: "unnamed duplicate key", err: &storage.DuplicateKeyError{}, wantCode: codeConflict, wantMessage: "User already exists"},
+		{name: "stale version", err: storage.ErrVersionConflict, wantCode: codeVersionConflict, wantMessage: "User was modified by another request"},
+		{name: "internal", err: errors.New("boom"), wantCode: codeInternal, wantMessage: "Failed to create user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gqlErr *gqlerror.Error
+			if !errors.As(h.graphQLServiceError(context.Background(), tt.err, "Failed to create user"), &gqlErr) {
+				t.Fatal("graphQLServiceError() did not return a *gqlerror.Error")
+			}
+			if code := gqlErr.Extensions["code"]; code != tt.wantCode {
+				t.Errorf("code = %v, want %q", code, tt.wantCode)
+			}
+			if gqlErr.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", gqlErr.Message, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"tracer/internal/config"
+	"tracer/internal/service"
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// Options are the dependencies and settings shared by the HTTP handlers
+type Options struct {
+	Users    *service.UserService
+	Audit    *storage.AuditLog
+	Tracer   telemetry.Tracer
+	Metrics  *telemetry.Metrics
+	Reporter telemetry.ErrorReporter
+
+	// Pinged by /readyz
+	Database Pinger
+	// Replays responses to retried creates; nil disables Idempotency-Key
+	Idempotency *storage.IdempotencyStore
+	// Fans out user changes to WebSocket clients; /ws is not served when nil
+	Hub *Hub
+
+	// Set once shutdown begins
+	Draining *atomic.Bool
+
+	Health            config.HealthConfig
+	CollectorEndpoint string
+
+	// Serve the Swagger UI and OpenAPI spec under /docs
+	Docs bool
+
+	// Largest page a client may request
+	MaxPageSize int64
+}
+
+// Pinger reports whether a dependency answers
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type Handler struct {
+	users       *service.UserService
+	audit       *storage.AuditLog
+	tracer      telemetry.Tracer
+	metrics     *telemetry.Metrics
+	reporter    telemetry.ErrorReporter
+	database    Pinger
+	hub         *Hub
+	idempotency *storage.IdempotencyStore
+	draining    *atomic.Bool
+
+	// Canceled by CloseStreams to end open change streams
+	streams      context.Context
+	closeStreams context.CancelFunc
+
+	health            config.HealthConfig
+	collectorEndpoint string
+	docs              bool
+	maxPageSize       int64
+}
+
+func New(opts Options) *Handler {
+	useJSONFieldNames()
+
+	streams, closeStreams := context.WithCancel(context.Background())
+	return &Handler{
+		users:             opts.Users,
+		audit:             opts.Audit,
+		tracer:            opts.Tracer,
+		metrics:           opts.Metrics,
+		reporter:          opts.Reporter,
+		database:          opts.Database,
+		hub:               opts.Hub,
+		idempotency:       opts.Idempotency,
+		draining:          opts.Draining,
+		health:            opts.Health,
+		collectorEndpoint: opts.CollectorEndpoint,
+		docs:              opts.Docs,
+		maxPageSize:       opts.MaxPageSize,
+		streams:           streams,
+		closeStreams:      closeStreams,
+	}
+}
+
+// CloseStreams ends the open /users/watch and /users/stream change streams,
+// which would otherwise hold up a graceful shutdown until it times out
+func (h *Handler) CloseStreams() {
+	h.closeStreams()
+}
+
+// Register adds the health and user routes to r
+func (h *Handler) Register(r gin.IRouter) {
+	r.GET("/healthz", h.livez)
+	r.GET("/livez", h.livez)
+	r.GET("/readyz", h.readyz)
+	r.GET("/version", h.version)
+
+	if h.docs {
+		r.GET("/docs", serveSwaggerUI)
+		r.GET("/docs/openapi.yaml", serveOpenAPISpec)
+	}
+
+	// JWT callers need the admin role, except on routes for their own user
+	admin, self := authorize(false), authorize(true)
+
+	r.POST("/users", admin, h.idempotent(), h.createUser)
+	r.POST("/users/batch", admin, h.createUsers)
+	r.POST("/users/query", admin, h.queryUsers)
+	r.GET("/users", admin, h.listUsers)
+	r.GET("/users/:id", self, h.getUser)
+	r.PUT("/users/:id", self, h.updateUser)
+	r.PATCH("/users/:id", self, h.patchUser)
+	r.DELETE("/users/:id", admin, h.deleteUser)
+	r.PATCH("/users", admin, h.updateUsers)
+	r.DELETE("/users", admin, h.deleteUsers)
+	r.POST("/users/:id/restore", admin, h.restoreUser)
+	r.GET("/users/watch", admin, h.watchUsers)
+	r.GET("/users/stream", admin, h.streamUsers)
+	if h.hub != nil {
+		r.GET("/ws", admin, h.serveWebSocket)
+	}
+	r.GET("/users/:id/audit", self, h.getUserHistory)
+	r.GET("/users/:id/history", self, h.getUserHistory)
+
+	r.POST("/graphql", admin, h.graphqlHandler())
+
+	// Unlike the user routes these stay closed when authentication is off
+	r.GET("/admin/log-level", authenticated(), admin, h.getLogLevel)
+	r.PUT("/admin/log-level", authenticated(), admin, h.setLogLevel)
+}
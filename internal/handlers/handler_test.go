@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/mock/gomock"
+
+	"tracer/internal/config"
+	"tracer/internal/service"
+	"tracer/internal/storage"
+	"tracer/internal/storage/storagemock"
+	"tracer/internal/telemetry"
+)
+
+type mockRepo = storagemock.MockUserRepository
+
+func TestMain(m *testing.M) {
+	// Handlers log every failure; keep the test output readable
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+// testServer serves the user routes from a mocked repository and records
+// the spans they produce in memory
+type testServer struct {
+	router   *gin.Engine
+	repo     *mockRepo
+	audit    *auditRecorder
+	spans    *tracetest.SpanRecorder
+	draining *atomic.Bool
+	database *fakePinger
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	spans := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	metrics, err := telemetry.NewMetrics(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+
+	tracer := telemetry.NewTracer()
+	repo := storagemock.NewMockUserRepository(gomock.NewController(t))
+	audit := &auditRecorder{}
+	var draining atomic.Bool
+	database := &fakePinger{}
+
+	h := New(Options{
+		Users:       service.NewUserService(repo, audit, nil, tracer, metrics, nil, nil),
+		Tracer:      tracer,
+		Metrics:     metrics,
+		Reporter:    telemetry.NoopReporter{},
+		Draining:    &draining,
+		Database:    database,
+		Health:      config.HealthConfig{Timeout: time.Second},
+		MaxPageSize: 100,
+	})
+
+	router := gin.New()
+	router.Use(telemetry.Middleware("test", nil, false))
+	router.Use(ErrorHandler())
+	h.Register(router)
+
+	return &testServer{router: router, repo: repo, audit: audit, spans: spans, draining: &draining, database: database}
+}
+
+// do sends a request with an optional JSON body and returns the response
+func (s *testServer) do(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// span returns the ended span with the given name, failing the test if
+// there is none
+func (s *testServer) span(t *testing.T, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range s.spans.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q", name)
+	return nil
+}
+
+// serverSpan returns the span the telemetry middleware started for the request
+func (s *testServer) serverSpan(t *testing.T) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range s.spans.Ended() {
+		if span.SpanKind() == trace.SpanKindServer {
+			return span
+		}
+	}
+	t.Fatal("no server span")
+	return nil
+}
+
+// errorCode decodes the code of an error response
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error body %q: %v", rec.Body.String(), err)
+	}
+	return body.Code
+}
+
+// auditRecorder keeps the audit entries written through the service
+type auditRecorder struct {
+	mu      sync.Mutex
+	entries []storage.AuditEntry
+}
+
+func (a *auditRecorder) Write(_ context.Context, userID storage.ID, operation string, oldValue, newValue *storage.User) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, storage.AuditEntry{UserID: userID, Operation: operation, OldValue: oldValue, NewValue: newValue})
+}
+
+func (a *auditRecorder) operations() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	operations := make([]string, len(a.entries))
+	for i, entry := range a.entries {
+		operations[i] = entry.Operation
+	}
+	return operations
+}
+
+// fakePinger answers readiness pings with err
+type fakePinger struct {
+	err error
+}
+
+func (p *fakePinger) Ping(context.Context) error {
+	return p.err
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"tracer/internal/buildinfo"
+)
+
+// livez reports that the process is up and serving requests
+func (h *Handler) livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// version reports the build of the running binary
+func (h *Handler) version(c *gin.Context) {
+	c.JSON(http.StatusOK, buildinfo.Get())
+}
+
+// readyz reports whether the service can take traffic: it is not shutting
+// down, MongoDB answers a ping and, optionally, the OTLP collector accepts
+// connections
+func (h *Handler) readyz(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.health.Timeout)
+	defer cancel()
+
+	checks := gin.H{}
+	ready := true
+
+	if err := h.database.Ping(ctx); err != nil {
+		log.Warn().Err(err).Msg("Readiness check failed: MongoDB")
+		checks["mongo"] = err.Error()
+		ready = false
+	} else {
+		checks["mongo"] = "ok"
+	}
+
+	if h.health.CheckCollector {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", h.collectorEndpoint)
+		if err != nil {
+			log.Warn().Err(err).Msg("Readiness check failed: OTLP collector")
+			checks["collector"] = err.Error()
+			ready = false
+		} else {
+			conn.Close()
+			checks["collector"] = "ok"
+		}
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+}
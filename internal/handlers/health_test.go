@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		draining   bool
+		pingErr    error
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "ready", wantStatus: http.StatusOK, wantBody: "ok"},
+		{name: "mongo down", pingErr: errors.New("no reachable servers"), wantStatus: http.StatusServiceUnavailable, wantBody: "unavailable"},
+		{name: "draining", draining: true, wantStatus: http.StatusServiceUnavailable, wantBody: "draining"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.database.err = tt.pingErr
+			s.draining.Store(tt.draining)
+
+			rec := s.do(http.MethodGet, "/readyz", "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var body struct {
+				Status string `json:"status"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body %q: %v", rec.Body.String(), err)
+			}
+			if body.Status != tt.wantBody {
+				t.Errorf("status field = %q, want %q", body.Status, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// Delay before a failed change stream is reopened
+const hubRetryDelay = 5 * time.Second
+
+// Hub tails the users change stream once on behalf of every connected
+// WebSocket client. The stream only runs while at least one client is
+// connected, and resumes after the last event it broadcast when restarted.
+// Clients only receive the changes of their own tenant.
+type Hub struct {
+	feed    *storage.UserFeed
+	tracer  telemetry.Tracer
+	tenancy *storage.Tenancy
+
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+	closed  bool
+	// Stops the running change stream; nil when none is running
+	cancel context.CancelFunc
+	// Closed once the most recently started change stream has stopped
+	done        chan struct{}
+	resumeToken string
+}
+
+func NewHub(feed *storage.UserFeed, tracer telemetry.Tracer, tenancy *storage.Tenancy) *Hub {
+	return &Hub{
+		feed:    feed,
+		tracer:  tracer,
+		tenancy: tenancy,
+		clients: make(map[*wsClient]struct{}),
+	}
+}
+
+// wsMessage is one encoded user event queued for a client
+type wsMessage struct {
+	eventType string
+	data      []byte
+}
+
+type wsClient struct {
+	send chan wsMessage
+	// Tenant the client connected as; "" when it has none
+	tenant string
+	// Event types the client subscribed to; nil means all of them
+	types map[string]bool
+	// Why the hub closed send, if it did
+	closeReason string
+}
+
+func (c *wsClient) wants(eventType string) bool {
+	return c.types == nil || c.types[eventType]
+}
+
+// subscribe adds client to the hub, starting the change stream for the
+// first one. It returns false once the hub is closed.
+func (h *Hub) subscribe(client *wsClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return false
+	}
+	h.clients[client] = struct{}{}
+
+	if h.cancel == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		previous, done := h.done, make(chan struct{})
+		h.cancel, h.done = cancel, done
+		go h.run(ctx, previous, done)
+	}
+	return true
+}
+
+// unsubscribe removes client, stopping the change stream after the last one
+func (h *Hub) unsubscribe(client *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.drop(client, "")
+}
+
+// setTypes limits the events sent to client; no types means all of them
+func (h *Hub) setTypes(client *wsClient, types []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(types) == 0 {
+		client.types = nil
+		return
+	}
+	client.types = make(map[string]bool, len(types))
+	for _, t := range types {
+		client.types[t] = true
+	}
+}
+
+// drop must be called with mu held
+func (h *Hub) drop(client *wsClient, reason string) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	client.closeReason = reason
+	close(client.send)
+
+	if len(h.clients) == 0 && h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+	}
+}
+
+// Close disconnects every client and waits for the change stream to stop
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	for client := range h.clients {
+		h.drop(client, "server shutting down")
+	}
+	done := h.done
+	h.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// run keeps a change stream open until ctx is canceled. It waits for the
+// previous stream to stop first, so no event is broadcast twice.
+func (h *Hub) run(ctx context.Context, previous <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	if previous != nil {
+		<-previous
+	}
+
+	for {
+		err := h.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Error().Err(err).Msg("WebSocket change stream failed")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(hubRetryDelay):
+		}
+	}
+}
+
+func (h *Hub) watch(ctx context.Context) error {
+	h.mu.Lock()
+	resumeAfter := h.resumeToken
+	h.mu.Unlock()
+
+	stream, err := h.feed.Open(ctx, resumeAfter)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		h.broadcast(ctx, stream)
+	}
+	if err := stream.Err(); err != nil {
+		return err
+	}
+	return errors.New("change stream closed")
+}
+
+// broadcast queues the stream's current event for every subscribed client.
+// Clients whose queue is full are dropped rather than holding up the rest.
+func (h *Hub) broadcast(ctx context.Context, stream storage.ChangeStream) {
+	ctx, span := h.tracer.Start(ctx, "hub.broadcast",
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+	)
+	defer span.End()
+
+	h.mu.Lock()
+	h.resumeToken = stream.ResumeToken()
+	h.mu.Unlock()
+
+	change, err := stream.Event()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "decode failed")
+		log.Ctx(ctx).Error().Err(err).Msg("Failed to decode change event")
+		return
+	}
+
+	event := newUserEvent(change)
+	data, err := json.Marshal(event)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "encode failed")
+		log.Ctx(ctx).Error().Err(err).Msg("Failed to encode change event")
+		return
+	}
+	msg := wsMessage{eventType: event.Type, data: data}
+	tenant := h.tenancy.TenantOf(change.Namespace.DB, change.FullDocument)
+	if h.tenancy != nil && !h.tenancy.PerDatabase() && change.FullDocument == nil {
+		// Hard deletes carry no tenantId, so nobody can be told about them
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var delivered, dropped int
+	for client := range h.clients {
+		if client.tenant != tenant || !client.wants(event.Type) {
+			continue
+		}
+		select {
+		case client.send <- msg:
+			delivered++
+		default:
+			h.drop(client, "client too slow")
+			dropped++
+		}
+	}
+
+	span.SetAttributes(
+		attribute.String("change_stream.operation", change.OperationType),
+		attribute.String("change_stream.event_type", event.Type),
+		attribute.String("user.id", event.UserID),
+		attribute.String(telemetry.TenantAttribute, tenant),
+		attribute.Int("hub.delivered", delivered),
+		attribute.Int("hub.dropped", dropped),
+	)
+	if dropped > 0 {
+		log.Ctx(ctx).Warn().Int("dropped", dropped).Msg("Dropped slow WebSocket clients")
+	}
+}
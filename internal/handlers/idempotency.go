@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/telemetry"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// Bodies are buffered whole to be fingerprinted, so they are capped
+	maxIdempotentBodyBytes = 1 << 20
+)
+
+// replayedHeaders are the response headers stored with an idempotent
+// response, so a replayed create still gives the client the ETag it needs
+// for a conditional update
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotent makes a route safe to retry when the client sends an
+// Idempotency-Key. The first response for a key is stored and replayed for
+// retries with the same request body. Server errors are not stored, so a
+// retry after one runs the request again.
+func (h *Handler) idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if h.idempotency == nil || key == "" {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		span := trace.SpanFromContext(ctx)
+
+		if len(key) > maxIdempotencyKeyLength {
+			respondError(c, codeInvalidRequest, "Idempotency-Key is too long")
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			respondError(c, codePayloadTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", tooLarge.Limit))
+			c.Abort()
+			return
+		case err != nil:
+			respondError(c, codeInvalidRequest, "Failed to read request body")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Keys are scoped to the caller and tenant so clients cannot replay
+		// each other's responses
+		scopedKey := telemetry.TenantFromContext(ctx) + ":" + c.GetString("auth.subject") + ":" + key
+		fingerprint := requestFingerprint(c, body)
+
+		record, err := h.idempotency.Begin(ctx, scopedKey, fingerprint)
+		if err != nil {
+			h.handleStorageError(ctx, c, span, err, "idempotency", "Failed to check idempotency key")
+			c.Abort()
+			return
+		}
+
+		if record != nil {
+			span.SetAttributes(attribute.Bool("idempotency.replayed", record.Status != 0 && record.Fingerprint == fingerprint))
+			switch {
+			case record.Fingerprint != fingerprint:
+				log.Ctx(ctx).Warn().Msg("Idempotency key reused with a different request")
+				respondError(c, codeIdempotencyMismatch, "Idempotency-Key was already used for a different request")
+			case record.Status == 0:
+				respondError(c, codeIdempotencyInProgress, "A request with this Idempotency-Key is still in progress")
+			default:
+				log.Ctx(ctx).Info().Int("status", record.Status).Msg("Replaying idempotent response")
+				for name, value := range record.Headers {
+					c.Header(name, value)
+				}
+				c.Header(idempotentReplayedHeader, "true")
+				contentType := record.Headers["Content-Type"]
+				if contentType == "" {
+					contentType = "application/json; charset=utf-8"
+				}
+				c.Data(record.Status, contentType, record.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		span.SetAttributes(attribute.Bool("idempotency.replayed", false))
+		writer := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		// Stored with a fresh context so a client disconnect does not leave
+		// the key claimed until it expires
+		storeCtx := context.WithoutCancel(ctx)
+		// Errors left for ErrorHandler to render have not been written yet
+		// and are not stored either
+		if status := writer.Status(); status >= http.StatusInternalServerError || !writer.Written() {
+			err = h.idempotency.Release(storeCtx, scopedKey)
+		} else {
+			err = h.idempotency.Complete(storeCtx, scopedKey, status, storedHeaders(writer.Header()), writer.body.Bytes())
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Failed to store idempotent response")
+		}
+	}
+}
+
+// storedHeaders picks the replayed headers out of a response
+func storedHeaders(header http.Header) map[string]string {
+	stored := make(map[string]string, len(replayedHeaders))
+	for _, name := range replayedHeaders {
+		if value := header.Get(name); value != "" {
+			stored[name] = value
+		}
+	}
+	return stored
+}
+
+// requestFingerprint identifies a request by its method, route and body
+func requestFingerprint(c *gin.Context, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.Method + " " + c.FullPath() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tracer/internal/storage"
+)
+
+func TestIdempotentRejectsOversizedBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{idempotency: &storage.IdempotencyStore{}}
+
+	router := gin.New()
+	router.Use(ErrorHandler())
+	router.POST("/users", h.idempotent(), func(c *gin.Context) {
+		t.Error("handler ran for an oversized body")
+	})
+
+	body := `{"name":"` + strings.Repeat("a", maxIdempotentBodyBytes) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+	req.Header.Set(idempotencyKeyHeader, "retry-1")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	if code := errorCode(t, rec); code != codePayloadTooLarge {
+		t.Errorf("code = %q, want %q", code, codePayloadTooLarge)
+	}
+}
+
+func TestStoredHeadersKeepTheETag(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("ETag", `"abc-1"`)
+	header.Set("X-Request-ID", "req-1")
+
+	stored := storedHeaders(header)
+	if stored["ETag"] != `"abc-1"` {
+		t.Errorf("ETag = %q, want %q", stored["ETag"], `"abc-1"`)
+	}
+	if _, ok := stored["X-Request-ID"]; ok {
+		t.Error("X-Request-ID was stored, want only the replayed headers")
+	}
+}
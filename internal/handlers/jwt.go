@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"tracer/internal/config"
+)
+
+// jwtClaims are the claims checked on incoming tokens
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Roles     []string `json:"roles"`
+	Tenant    string   `json:"tenant"`
+}
+
+// parseJWT verifies an HS256 token and its time and issuer claims. Only
+// HS256 is accepted, so a token cannot pick a weaker algorithm for itself.
+func parseJWT(token string, cfg config.JWTConfig, now time.Time) (jwtClaims, error) {
+	var claims jwtClaims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, fmt.Errorf("malformed header: %w", err)
+	}
+	if header.Alg != "HS256" {
+		return claims, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errors.New("malformed signature")
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.SigningKey))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return claims, errors.New("invalid signature")
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, fmt.Errorf("malformed claims: %w", err)
+	}
+
+	if claims.ExpiresAt == nil {
+		return claims, errors.New("missing exp claim")
+	}
+	if now.After(numericDate(*claims.ExpiresAt).Add(cfg.Leeway)) {
+		return claims, errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Add(cfg.Leeway).Before(numericDate(*claims.NotBefore)) {
+		return claims, errors.New("token not valid yet")
+	}
+	if cfg.Issuer != "" && claims.Issuer != cfg.Issuer {
+		return claims, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return claims, errors.New("missing sub claim")
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, target any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// numericDate converts a JWT NumericDate, seconds since the epoch
+func numericDate(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+
+	"tracer/internal/telemetry"
+)
+
+type logLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+func (h *Handler) getLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"level": telemetry.LogLevel()})
+}
+
+// setLogLevel changes the log level of the whole process until the next
+// restart, e.g. to turn on debug logging during an incident
+func (h *Handler) setLogLevel(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "setLogLevel")
+	defer span.End()
+
+	var req logLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+
+	previous, err := telemetry.SetLogLevel(req.Level)
+	if err != nil {
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("log.level", req.Level),
+		attribute.String("log.previous_level", previous),
+	)
+	// Logged at warn so the change is visible whatever the new level is
+	log.Ctx(ctx).Warn().
+		Str("level", req.Level).
+		Str("previousLevel", previous).
+		Str("subject", c.GetString("auth.subject")).
+		Msg("Log level changed")
+	c.JSON(http.StatusOK, gin.H{"level": req.Level, "previousLevel": previous})
+}
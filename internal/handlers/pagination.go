@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"tracer/internal/storage"
+)
+
+const (
+	defaultPageSize = 20
+
+	// Deep offsets force MongoDB to walk and discard every skipped document
+	maxOffset = 10000
+)
+
+// PagedResponse is the envelope returned by endpoints that return lists of items
+type PagedResponse[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	Limit      int64  `json:"limit"`
+	Offset     int64  `json:"offset"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+func NewPagedResponse[T any](items []T, total, limit, offset int64, nextCursor string) PagedResponse[T] {
+	// Serialize an empty page as [] rather than null
+	if items == nil {
+		items = []T{}
+	}
+
+	return PagedResponse[T]{
+		Items:      items,
+		Total:      total,
+		Limit:      limit,
+		Offset:     offset,
+		NextCursor: nextCursor,
+	}
+}
+
+type pageParams struct {
+	Limit  int64
+	Offset int64
+}
+
+// parsePageParams reads limit and offset from the query string. Limits above
+// maxPageSize are clamped down, offsets beyond maxOffset are rejected.
+func (h *Handler) parsePageParams(c *gin.Context) (pageParams, error) {
+	page := pageParams{Limit: defaultPageSize}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 {
+			return page, fmt.Errorf("invalid limit %q", value)
+		}
+		page.Limit = limit
+	}
+	if page.Limit > h.maxPageSize {
+		page.Limit = h.maxPageSize
+	}
+
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || offset < 0 {
+			return page, fmt.Errorf("invalid offset %q", value)
+		}
+		if offset > maxOffset {
+			return page, fmt.Errorf("offset must not exceed %d, use cursor pagination instead", maxOffset)
+		}
+		page.Offset = offset
+	}
+
+	return page, nil
+}
+
+// encodeCursor turns a cursor into the opaque string handed to clients
+func encodeCursor(cursor storage.Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (storage.Cursor, error) {
+	var cursor storage.Cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, errors.New("malformed cursor")
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID.IsZero() {
+		return cursor, errors.New("malformed cursor")
+	}
+	return cursor, nil
+}
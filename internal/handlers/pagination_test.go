@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"tracer/internal/storage"
+)
+
+// decodeEnvelope returns the top-level fields of a JSON response and their
+// names, sorted
+func decodeEnvelope(t *testing.T, rec *httptest.ResponseRecorder) (map[string]json.RawMessage, []string) {
+	t.Helper()
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body %q: %v", rec.Body.String(), err)
+	}
+	keys := make([]string, 0, len(body))
+	for key := range body {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return body, keys
+}
+
+func TestPagedResponseEnvelope(t *testing.T) {
+	users := []storage.User{
+		{ID: storage.NewID(), Name: "Alice", Email: "alice@example.com"},
+		{ID: storage.NewID(), Name: "Bob", Email: "bob@example.com"},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path, body string
+		expect     func(repo *mockRepo)
+		wantItems  string
+		wantTotal  int64
+		wantLimit  int64
+		wantCursor bool
+	}{
+		{
+			name: "empty list", method: http.MethodGet, path: "/users?limit=2",
+			expect: func(repo *mockRepo) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(0), nil)
+			},
+			wantItems: "[]", wantLimit: 2,
+		},
+		{
+			name: "full list page", method: http.MethodGet, path: "/users?limit=2",
+			expect: func(repo *mockRepo) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(users, int64(5), nil)
+			},
+			wantTotal: 5, wantLimit: 2, wantCursor: true,
+		},
+		{
+			name: "query", method: http.MethodPost, path: "/users/query",
+			body: `{"ids":["` + users[0].ID.Hex() + `","` + users[1].ID.Hex() + `"]}`,
+			expect: func(repo *mockRepo) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(users, int64(2), nil)
+			},
+			wantTotal: 2, wantLimit: 2,
+		},
+		{
+			name: "empty query", method: http.MethodPost, path: "/users/query",
+			body: `{"ids":["` + users[0].ID.Hex() + `"]}`,
+			expect: func(repo *mockRepo) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(0), nil)
+			},
+			wantItems: "[]",
+		},
+		{
+			name: "batch", method: http.MethodPost, path: "/users/batch",
+			body: `[{"name":"Alice","email":"alice@example.com"},{"name":"Bob","email":"bob@example.com"}]`,
+			expect: func(repo *mockRepo) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(0), nil)
+				repo.EXPECT().CreateMany(gomock.Any(), gomock.Len(2), true).Return(nil)
+			},
+			wantTotal: 2, wantLimit: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			tt.expect(s.repo)
+
+			rec := s.do(tt.method, tt.path, tt.body)
+			if rec.Code >= 300 {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+
+			want := []string{"items", "limit", "offset", "total"}
+			if tt.wantCursor {
+				want = []string{"items", "limit", "nextCursor", "offset", "total"}
+			}
+			fields, keys := decodeEnvelope(t, rec)
+			if strings.Join(keys, ",") != strings.Join(want, ",") {
+				t.Errorf("keys = %v, want %v", keys, want)
+			}
+
+			var page PagedResponse[json.RawMessage]
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if page.Total != tt.wantTotal || page.Limit != tt.wantLimit || page.Offset != 0 {
+				t.Errorf("total, limit, offset = %d, %d, %d, want %d, %d, 0", page.Total, page.Limit, page.Offset, tt.wantTotal, tt.wantLimit)
+			}
+			if tt.wantItems != "" {
+				if got := string(fields["items"]); got != tt.wantItems {
+					t.Errorf("items = %s, want %s", got, tt.wantItems)
+				}
+			} else if int64(len(page.Items)) != tt.wantLimit {
+				t.Errorf("items = %d, want %d", len(page.Items), tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestListUsersClampsPageSize(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantLimit int64
+	}{
+		{query: "", wantLimit: defaultPageSize},
+		{query: "?limit=50", wantLimit: 50},
+		{query: "?limit=100", wantLimit: 100},
+		{query: "?limit=1000000", wantLimit: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			s := newTestServer(t)
+			s.repo.EXPECT().List(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, query storage.UserQuery) ([]storage.User, int64, error) {
+				if query.Limit != tt.wantLimit {
+					t.Errorf("repository limit = %d, want %d", query.Limit, tt.wantLimit)
+				}
+				return nil, 0, nil
+			})
+
+			rec := s.do(http.MethodGet, "/users"+tt.query, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var page PagedResponse[storage.User]
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if page.Limit != tt.wantLimit {
+				t.Errorf("response limit = %d, want %d", page.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestListUsersCapsOffset(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantStatus int
+	}{
+		{query: "?offset=10000", wantStatus: http.StatusOK},
+		{query: "?offset=10001", wantStatus: http.StatusBadRequest},
+		{query: "?offset=-1", wantStatus: http.StatusBadRequest},
+		{query: "?limit=0", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			// The mock fails the test if a rejected request reaches the repository
+			s := newTestServer(t)
+			if tt.wantStatus == http.StatusOK {
+				s.repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(0), nil)
+			}
+
+			rec := s.do(http.MethodGet, "/users"+tt.query, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				if code := errorCode(t, rec); code != codeInvalidRequest {
+					t.Errorf("code = %q, want %q", code, codeInvalidRequest)
+				}
+			}
+		})
+	}
+}
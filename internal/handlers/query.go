@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"tracer/internal/storage"
+)
+
+const defaultSort = "_id"
+
+// Sorts accepted by ?sort=. Users that tie on the sort field are ordered by
+// ID, so they keep a stable order between pages. IDs embed their creation
+// time, so sorting by ID doubles as the createdAt ordering.
+var userSorts = map[string]storage.UserSort{
+	defaultSort:  {Field: storage.SortByID},
+	"name":       {Field: storage.SortByName},
+	"-name":      {Field: storage.SortByName, Descending: true},
+	"email":      {Field: storage.SortByEmail},
+	"createdAt":  {Field: storage.SortByID},
+	"-createdAt": {Field: storage.SortByID, Descending: true},
+}
+
+// parseSort maps the ?sort= value to a sort, defaulting to ID ascending.
+// It also returns the effective sort name for span attributes.
+func parseSort(value string) (string, storage.UserSort, error) {
+	if value == "" {
+		value = defaultSort
+	}
+
+	sort, ok := userSorts[value]
+	if !ok {
+		return "", storage.UserSort{}, fmt.Errorf("unsupported sort %q", value)
+	}
+	return value, sort, nil
+}
+
+// Longest value accepted for a filter parameter
+const maxFilterLength = 200
+
+// parseUserFilter reads the name, email and q query parameters into a user
+// filter
+func parseUserFilter(c *gin.Context) (storage.UserFilter, error) {
+	var filter storage.UserFilter
+
+	params := map[string]string{
+		"name":  strings.TrimSpace(c.Query("name")),
+		"email": strings.TrimSpace(c.Query("email")),
+		"q":     strings.TrimSpace(c.Query("q")),
+	}
+	for param, value := range params {
+		if len(value) > maxFilterLength {
+			return storage.UserFilter{}, fmt.Errorf("%s must be at most %d characters", param, maxFilterLength)
+		}
+	}
+
+	// Name and email matches are case-insensitive through the query collation
+	filter.Name = params["name"]
+	if email := params["email"]; email != "" {
+		filter.Emails = []string{email}
+	}
+	filter.Search = params["q"]
+
+	return filter, nil
+}
+
+// parseIncludeDeleted reads the includeDeleted admin flag, which makes reads
+// return soft-deleted users as well
+func parseIncludeDeleted(c *gin.Context) (bool, error) {
+	value := c.Query("includeDeleted")
+	if value == "" {
+		return false, nil
+	}
+
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid includeDeleted %q", value)
+	}
+	return include, nil
+}
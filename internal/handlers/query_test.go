@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"tracer/internal/storage"
+)
+
+func TestListUsersSorts(t *testing.T) {
+	tests := []struct {
+		query    string
+		wantName string
+		wantSort storage.UserSort
+	}{
+		{query: "", wantName: "_id", wantSort: storage.UserSort{Field: storage.SortByID}},
+		{query: "?sort=name", wantName: "name", wantSort: storage.UserSort{Field: storage.SortByName}},
+		{query: "?sort=-name", wantName: "-name", wantSort: storage.UserSort{Field: storage.SortByName, Descending: true}},
+		{query: "?sort=email", wantName: "email", wantSort: storage.UserSort{Field: storage.SortByEmail}},
+		{query: "?sort=createdAt", wantName: "createdAt", wantSort: storage.UserSort{Field: storage.SortByID}},
+		{query: "?sort=-createdAt", wantName: "-createdAt", wantSort: storage.UserSort{Field: storage.SortByID, Descending: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantName, func(t *testing.T) {
+			s := newTestServer(t)
+			s.repo.EXPECT().List(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, query storage.UserQuery) ([]storage.User, int64, error) {
+				if !reflect.DeepEqual(query.Sort, tt.wantSort) {
+					t.Errorf("sort = %v, want %v", query.Sort, tt.wantSort)
+				}
+				return nil, 0, nil
+			})
+
+			rec := s.do(http.MethodGet, "/users"+tt.query, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+
+			var got string
+			for _, attr := range s.span(t, "listUsers").Attributes() {
+				if attr.Key == "db.sort" {
+					got = attr.Value.AsString()
+				}
+			}
+			if got != tt.wantName {
+				t.Errorf("db.sort = %q, want %q", got, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestListUsersRejectsUnknownSort(t *testing.T) {
+	// The mock fails the test if the request reaches the repository
+	s := newTestServer(t)
+
+	rec := s.do(http.MethodGet, "/users?sort=password", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+	if code := errorCode(t, rec); code != codeInvalidRequest {
+		t.Errorf("code = %q, want %q", code, codeInvalidRequest)
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/config"
+)
+
+// How often buckets that have refilled completely are dropped
+const bucketSweepInterval = time.Minute
+
+// RateLimitByIP throttles clients by IP address. It runs before
+// authentication so floods are turned away without checking credentials.
+func RateLimitByIP(cfg config.RateLimitConfig) gin.HandlerFunc {
+	limiter := newTokenBucketLimiter(cfg.PerIP, cfg.Burst)
+	return rateLimit("ip", limiter, func(c *gin.Context) string {
+		if publicPaths[c.Request.URL.Path] {
+			return ""
+		}
+		return c.ClientIP()
+	})
+}
+
+// RateLimitByKey throttles authenticated callers by their subject, which is
+// derived from the API key for key-based callers. It must run after
+// AuthMiddleware; unauthenticated requests are not limited here.
+func RateLimitByKey(cfg config.RateLimitConfig) gin.HandlerFunc {
+	limiter := newTokenBucketLimiter(cfg.PerKey, cfg.Burst)
+	return rateLimit("key", limiter, func(c *gin.Context) string {
+		return c.GetString("auth.subject")
+	})
+}
+
+// Limiter applies the same token buckets outside gin, such as to gRPC calls
+type Limiter struct {
+	limiter *tokenBucketLimiter
+}
+
+// NewLimiter allows rate calls per second per key, in bursts of up to
+// burst. A rate of 0 allows everything.
+func NewLimiter(rate float64, burst int) Limiter {
+	return Limiter{limiter: newTokenBucketLimiter(rate, burst)}
+}
+
+// Allow takes a token from key's bucket, or reports how long until one is
+// available. Empty keys are not limited.
+func (l Limiter) Allow(key string) (bool, time.Duration) {
+	if l.limiter == nil || key == "" {
+		return true, 0
+	}
+	return l.limiter.allow(key, time.Now())
+}
+
+// rateLimit answers with 429 once the bucket for the request's key is empty
+// and marks the span so throttled requests stand out in traces
+func rateLimit(scope string, limiter *tokenBucketLimiter, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+
+		allowed, wait := limiter.allow(k, time.Now())
+		if allowed {
+			c.Next()
+			return
+		}
+
+		retryAfter := max(1, int(math.Ceil(wait.Seconds())))
+		ctx := c.Request.Context()
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.Bool("ratelimit.exceeded", true),
+			attribute.String("ratelimit.scope", scope),
+		)
+		log.Ctx(ctx).Warn().Str("scope", scope).Int("retry_after", retryAfter).Msg("Rate limit exceeded")
+
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		abortWithError(c, codeRateLimited, "Too many requests")
+	}
+}
+
+// tokenBucketLimiter keeps one token bucket per key. Buckets start full and
+// refill at rate tokens per second up to burst.
+type tokenBucketLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucketLimiter returns nil when rate is 0, meaning no limit
+func newTokenBucketLimiter(rate float64, burst int) *tokenBucketLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucketLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from the key's bucket, or reports how long until one
+// is available
+func (l *tokenBucketLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= bucketSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	missing := 1 - b.tokens
+	return false, time.Duration(missing / l.rate * float64(time.Second))
+}
+
+func (l *tokenBucketLimiter) refill(b *tokenBucket, now time.Time) float64 {
+	return min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+}
+
+// sweep drops full buckets, which behave exactly like missing ones
+func (l *tokenBucketLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
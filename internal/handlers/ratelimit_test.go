@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tracer/internal/config"
+)
+
+func TestRateLimitByIPIgnoresForwardedForFromUntrustedPeers(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		wantSecond     int
+	}{
+		// Each request claims a different client, but comes from the same peer
+		{name: "no trusted proxies", wantSecond: http.StatusTooManyRequests},
+		{name: "peer is a trusted proxy", trustedProxies: []string{"192.0.2.0/24"}, wantSecond: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			if err := router.SetTrustedProxies(tt.trustedProxies); err != nil {
+				t.Fatalf("SetTrustedProxies() error = %v", err)
+			}
+			router.Use(RateLimitByIP(config.RateLimitConfig{PerIP: 0.001, Burst: 1}))
+			router.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			var codes []int
+			for _, client := range []string{"203.0.113.1", "203.0.113.2"} {
+				req := httptest.NewRequest(http.MethodGet, "/users", nil)
+				req.RemoteAddr = "192.0.2.10:1234"
+				req.Header.Set("X-Forwarded-For", client)
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				codes = append(codes, rec.Code)
+			}
+
+			if codes[0] != http.StatusOK || codes[1] != tt.wantSecond {
+				t.Errorf("statuses = %v, want [200 %d]", codes, tt.wantSecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Roles carried in the JWT roles claim
+const (
+	roleAdmin = "admin"
+	roleUser  = "user"
+)
+
+// Context key holding the roles of a JWT caller
+const rolesKey = "auth.roles"
+
+// Authorized reports whether p may use a route. Admins may use every
+// route; with self, callers with the user role may act on the user whose ID
+// matches their subject. Callers that are not role-based are not restricted.
+func Authorized(p Principal, self bool, id string) bool {
+	if !p.RoleBased || slices.Contains(p.Roles, roleAdmin) {
+		return true
+	}
+	return self && slices.Contains(p.Roles, roleUser) && id == p.Subject
+}
+
+// authorize enforces Authorized on a route, taking the ID from its :id
+// parameter
+func authorize(self bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, roleBased := c.Get(rolesKey)
+		roles, _ := value.([]string)
+		principal := Principal{Subject: c.GetString("auth.subject"), RoleBased: roleBased, Roles: roles}
+		if Authorized(principal, self, c.Param("id")) {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		trace.SpanFromContext(ctx).AddEvent("authorization.denied", trace.WithAttributes(
+			attribute.String("auth.subject", principal.Subject),
+			attribute.StringSlice("auth.roles", roles),
+			attribute.String("http.route", c.FullPath()),
+		))
+		log.Ctx(ctx).Warn().Strs("roles", roles).Str("route", c.FullPath()).Msg("Forbidden request")
+		abortWithError(c, codeForbidden, "Forbidden")
+	}
+}
+
+// authenticated rejects requests that no credential vouched for, which is
+// every request when authentication is off. It keeps operational routes
+// closed unless the server runs with auth.
+func authenticated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth.subject") != "" {
+			c.Next()
+			return
+		}
+
+		log.Ctx(c.Request.Context()).Warn().Str("route", c.FullPath()).Msg("Unauthenticated request to a protected route")
+		abortWithError(c, codeUnauthorized, "Unauthorized")
+	}
+}
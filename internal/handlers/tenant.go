@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/config"
+	"tracer/internal/telemetry"
+)
+
+// Context key holding the tenant claim of a JWT caller
+const tenantClaimKey = "auth.tenant"
+
+// Tenant IDs end up in database names, so they are kept short and plain
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,48}$`)
+
+// Reasons ResolveTenant refuses a request
+var (
+	ErrTenantMismatch = errors.New("token is not valid for this tenant")
+	ErrTenantRequired = errors.New("tenant is required")
+	ErrTenantInvalid  = errors.New("invalid tenant ID")
+	ErrTenantUnknown  = errors.New("tenant is not allowed")
+)
+
+// ResolveTenant picks the tenant a request acts for, from the JWT tenant
+// claim, the tenant header or the tenant.id baggage member of ctx, in that
+// order, and reports which one it used. A JWT caller bound to a tenant
+// cannot pick another one with the header, and tenants from the header or
+// baggage must be in cfg.Allowed. The tenant is empty when none was given
+// and none is required.
+func ResolveTenant(ctx context.Context, cfg config.TenancyConfig, claimed, header string) (tenant, source string, err error) {
+	if claimed != "" && header != "" && header != claimed {
+		return "", "", ErrTenantMismatch
+	}
+
+	tenant, source = claimed, "token"
+	if tenant == "" {
+		tenant, source = header, "header"
+	}
+	if tenant == "" {
+		tenant, source = telemetry.TenantID(ctx), "baggage"
+	}
+
+	if tenant == "" {
+		if cfg.Required {
+			return "", "", ErrTenantRequired
+		}
+		return "", "", nil
+	}
+	if !tenantPattern.MatchString(tenant) {
+		return "", "", ErrTenantInvalid
+	}
+	if source != "token" && !slices.Contains(cfg.Allowed, tenant) {
+		return "", "", ErrTenantUnknown
+	}
+	return tenant, source, nil
+}
+
+// Tenant puts the tenant ResolveTenant picks on the request context
+func Tenant(cfg config.TenancyConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Mode == config.TenancyOff || publicPaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		header := c.GetHeader(cfg.Header)
+		tenant, source, err := ResolveTenant(ctx, cfg, c.GetString(tenantClaimKey), header)
+		switch {
+		case errors.Is(err, ErrTenantMismatch):
+			log.Ctx(ctx).Warn().Str("tenant", header).Msg("Tenant header does not match token")
+			abortWithError(c, codeForbidden, "Token is not valid for this tenant")
+			return
+		case errors.Is(err, ErrTenantUnknown):
+			log.Ctx(ctx).Warn().Str("tenant", header).Msg("Tenant is not allowed")
+			abortWithError(c, codeForbidden, "Tenant is not allowed")
+			return
+		case errors.Is(err, ErrTenantRequired):
+			abortWithError(c, codeInvalidRequest, cfg.Header+" header is required")
+			return
+		case err != nil:
+			abortWithError(c, codeInvalidRequest, "Invalid tenant ID")
+			return
+		case tenant == "":
+			c.Next()
+			return
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("tenant.source", source))
+		c.Request = c.Request.WithContext(telemetry.WithTenant(ctx, tenant))
+		c.Next()
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+
+	"tracer/internal/config"
+	"tracer/internal/telemetry"
+)
+
+func TestResolveTenantOnlyAcceptsAllowedTenantsFromHeaderAndBaggage(t *testing.T) {
+	cfg := config.TenancyConfig{Mode: config.TenancyDatabase, Header: "X-Tenant-ID", Allowed: []string{"acme"}}
+
+	member, err := baggage.NewMember(telemetry.BaggageTenantID, "globex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withBaggage := baggage.ContextWithBaggage(context.Background(), bag)
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		claimed    string
+		header     string
+		wantTenant string
+		wantErr    error
+	}{
+		{name: "allowed header", ctx: context.Background(), header: "acme", wantTenant: "acme"},
+		{name: "unlisted header", ctx: context.Background(), header: "globex", wantErr: ErrTenantUnknown},
+		{name: "unlisted baggage", ctx: withBaggage, wantErr: ErrTenantUnknown},
+		{name: "token claim needs no listing", ctx: context.Background(), claimed: "globex", wantTenant: "globex"},
+		{name: "header must match claim", ctx: context.Background(), claimed: "globex", header: "acme", wantErr: ErrTenantMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant, _, err := ResolveTenant(tt.ctx, cfg, tt.claimed, tt.header)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ResolveTenant() error = %v, want %v", err, tt.wantErr)
+			}
+			if tenant != tt.wantTenant {
+				t.Errorf("ResolveTenant() tenant = %q, want %q", tenant, tt.wantTenant)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Routes that stay open for as long as the client listens
+var streamingRoutes = map[string]bool{
+	"/users/watch":  true,
+	"/users/stream": true,
+	"/ws":           true,
+}
+
+// Timeout cancels the request context after timeout, which also cancels the
+// MongoDB calls made with it. Requests that were still running get 504
+// unless they already answered. Streaming routes get no deadline, and the
+// server's write timeout is lifted for them.
+func Timeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if streamingRoutes[c.FullPath()] {
+			if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+				log.Ctx(c.Request.Context()).Warn().Err(err).Msg("Failed to lift write deadline for stream")
+			}
+			c.Next()
+			return
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return
+		}
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.Bool("http.request.timeout", true),
+			attribute.Int64("http.request.timeout_ms", timeout.Milliseconds()),
+		)
+		log.Ctx(ctx).Warn().Dur("timeout", timeout).Str("route", c.FullPath()).Msg("Request timed out")
+		if !c.Writer.Written() {
+			abortWithError(c, codeTimeout, "Request timed out")
+		}
+	}
+}
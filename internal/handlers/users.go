@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/storage"
+)
+
+func (h *Handler) createUser(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "createUser")
+	defer span.End()
+
+	var user storage.User
+	if !bindJSON(ctx, c, span, &user) {
+		return
+	}
+
+	if err := h.users.Create(ctx, &user); err != nil {
+		h.handleServiceError(ctx, c, span, err, "createUser", "Failed to create user")
+		return
+	}
+
+	span.SetAttributes(attribute.String("user.id", user.ID.Hex()))
+
+	log.Ctx(ctx).Info().Str("userId", user.ID.Hex()).Msg("User created")
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusCreated, user)
+}
+
+func (h *Handler) getUser(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "getUser")
+	defer span.End()
+
+	id, err := storage.ParseID(c.Param("id"))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid user ID")
+		respondError(c, codeInvalidID, "Invalid user ID")
+		return
+	}
+
+	includeDeleted, err := parseIncludeDeleted(c)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid includeDeleted flag")
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+
+	span.SetAttributes(attribute.String("user.id", id.Hex()))
+
+	user, err := h.users.Get(ctx, id, includeDeleted)
+	if err != nil {
+		h.handleServiceError(ctx, c, span, err, "getUser", "Failed to get user")
+		return
+	}
+
+	etag := userETag(user)
+	c.Header("ETag", etag)
+	// Documents written before timestamps were tracked have no updatedAt
+	if !user.UpdatedAt.IsZero() {
+		c.Header("Last-Modified", user.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	notModified := false
+	if header := c.GetHeader("If-None-Match"); header != "" {
+		notModified = etagMatches(weakToStrong(header), etag)
+	} else if !user.UpdatedAt.IsZero() {
+		notModified = notModifiedSince(c, user.UpdatedAt)
+	}
+	if notModified {
+		span.SetAttributes(attribute.Bool("http.not_modified", true))
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	log.Ctx(ctx).Info().Str("userId", id.Hex()).Msg("User retrieved")
+	c.JSON(http.StatusOK, user)
+}
+
+// notModifiedSince reports whether the client's If-Modified-Since header is
+// at or after modified. HTTP dates have second precision, so modified is
+// truncated before comparing.
+func notModifiedSince(c *gin.Context, modified time.Time) bool {
+	header := c.GetHeader("If-Modified-Since")
+	if header == "" {
+		return false
+	}
+
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+func (h *Handler) listUsers(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "listUsers")
+	defer span.End()
+
+	page, err := h.parsePageParams(c)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid page parameters")
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+
+	sortName, sort, err := parseSort(c.Query("sort"))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid sort")
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+
+	filter, err := parseUserFilter(c)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid filter")
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+
+	includeDeleted, err := parseIncludeDeleted(c)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid includeDeleted flag")
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+
+	span.SetAttributes(
+		attribute.Int64("page.limit", page.Limit),
+		attribute.Int64("page.offset", page.Offset),
+		attribute.String("db.sort", sortName),
+		attribute.String("db.filter", filter.String()),
+		attribute.Bool("db.include_deleted", includeDeleted),
+	)
+
+	query := storage.UserQuery{
+		Filter:         filter,
+		Sort:           sort,
+		Limit:          page.Limit,
+		Offset:         page.Offset,
+		IncludeDeleted: includeDeleted,
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		after, err := decodeCursor(raw)
+		if err == nil && after.Sort != sortName {
+			err = fmt.Errorf("cursor was issued for sort %q", after.Sort)
+		}
+		if err == nil && page.Offset > 0 {
+			err = errors.New("cursor and offset cannot be combined")
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Invalid cursor")
+			respondError(c, codeInvalidRequest, err.Error())
+			return
+		}
+
+		span.SetAttributes(
+			attribute.String("page.cursor", raw),
+			attribute.String("page.cursor.id", after.ID.Hex()),
+		)
+		query.After = &after
+	}
+
+	users, total, err := h.users.List(ctx, query)
+	if err != nil {
+		h.handleServiceError(ctx, c, span, err, "listUsers", "Failed to list users")
+		return
+	}
+
+	// A full page means there may be more to fetch
+	var nextCursor string
+	if int64(len(users)) == page.Limit {
+		nextCursor = encodeCursor(storage.CursorAfter(sortName, sort, users[len(users)-1]))
+	}
+
+	span.SetAttributes(attribute.Int64("page.total", total))
+
+	log.Ctx(ctx).Info().Int("count", len(users)).Int64("total", total).Msg("Users listed")
+	c.JSON(http.StatusOK, NewPagedResponse(users, total, page.Limit, page.Offset, nextCursor))
+}
+
+func (h *Handler) updateUser(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "updateUser")
+	defer span.End()
+
+	if _, ok := h.applyUserUpdate(ctx, c, span, "updateUser", true); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+}
+
+// patchUser applies a partial update and returns the updated document
+func (h *Handler) patchUser(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "patchUser")
+	defer span.End()
+
+	user, ok := h.applyUserUpdate(ctx, c, span, "patchUser", false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// applyUserUpdate sets the fields present in the request body on the user
+// named in the path. The expected version comes from If-Match or, failing
+// that, the version field of the body; requireVersion refuses requests
+// with neither. On failure the error response has already been written.
+func (h *Handler) applyUserUpdate(ctx context.Context, c *gin.Context, span trace.Span, handler string, requireVersion bool) (storage.User, bool) {
+	id, err := storage.ParseID(c.Param("id"))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid user ID")
+		respondError(c, codeInvalidID, "Invalid user ID")
+		return storage.User{}, false
+	}
+
+	span.SetAttributes(attribute.String("user.id", id.Hex()))
+
+	var payload storage.UserUpdate
+	if !bindJSON(ctx, c, span, &payload) {
+		return storage.User{}, false
+	}
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch != "" {
+		version, ok := ifMatchVersion(ctx, c, span, ifMatch)
+		if !ok {
+			return storage.User{}, false
+		}
+		payload.Version = version
+	} else if requireVersion && payload.Version == nil {
+		respondPreconditionRequired(ctx, c, handler)
+		return storage.User{}, false
+	}
+
+	after, err := h.users.Update(ctx, id, payload)
+	if ifMatch != "" && errors.Is(err, storage.ErrVersionConflict) {
+		respondPreconditionFailed(ctx, c, span, "")
+		return storage.User{}, false
+	}
+	if err != nil {
+		h.handleServiceError(ctx, c, span, err, handler, "Failed to update user")
+		return storage.User{}, false
+	}
+
+	log.Ctx(ctx).Info().Str("userId", id.Hex()).Msg("User updated")
+	c.Header("ETag", userETag(after))
+	return after, true
+}
+
+func (h *Handler) deleteUser(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "deleteUser")
+	defer span.End()
+
+	id, err := storage.ParseID(c.Param("id"))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid user ID")
+		respondError(c, codeInvalidID, "Invalid user ID")
+		return
+	}
+
+	span.SetAttributes(attribute.String("user.id", id.Hex()))
+
+	if !h.checkIfMatch(ctx, c, span, id, "deleteUser") {
+		return
+	}
+
+	if err := h.users.Delete(ctx, id); err != nil {
+		h.handleServiceError(ctx, c, span, err, "deleteUser", "Failed to delete user")
+		return
+	}
+
+	log.Ctx(ctx).Info().Str("userId", id.Hex()).Msg("User deleted")
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+type idsRequest struct {
+	IDs []string `json:"ids"`
+}
+
+func (h *Handler) deleteUsers(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "deleteUsers")
+	defer span.End()
+
+	var filter storage.UserFilter
+	if email := c.Query("email"); email != "" {
+		filter.Emails = []string{email}
+	}
+
+	// The IDs body is optional, so an empty body is not an error
+	var req idsRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		log.Ctx(ctx).Error().Err(err).Msg("Failed to bind JSON")
+		respondError(c, codeInvalidRequest, err.Error())
+		return
+	}
+
+	if len(req.IDs) > 0 {
+		ids, err := parseObjectIDs(req.IDs)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Invalid user ID")
+			respondError(c, codeInvalidID, "Invalid user ID")
+			return
+		}
+		filter.IDs = ids
+	}
+
+	// Guard against wiping the whole collection by accident
+	if len(filter.Emails) == 0 && len(filter.IDs) == 0 && c.Query("confirm") != "all" {
+		log.Ctx(ctx).Warn().Msg("Refusing bulk delete without a filter")
+		respondError(c, codeInvalidRequest, "A filter is required, or pass confirm=all to delete all users")
+		return
+	}
+
+	deleted, err := h.users.DeleteMany(ctx, filter)
+	if err != nil {
+		h.handleServiceError(ctx, c, span, err, "deleteUsers", "Failed to delete users")
+		return
+	}
+
+	span.SetAttributes(attribute.Int64("db.deleted_count", deleted))
+	log.Ctx(ctx).Warn().Int64("deletedCount", deleted).Stringer("filter", filter).Msg("Users deleted")
+	c.JSON(http.StatusOK, gin.H{"deletedCount": deleted})
+}
+
+// restoreUser undoes a soft delete and returns the restored user
+func (h *Handler) restoreUser(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "restoreUser")
+	defer span.End()
+
+	id, err := storage.ParseID(c.Param("id"))
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Invalid user ID")
+		respondError(c, codeInvalidID, "Invalid user ID")
+		return
+	}
+
+	span.SetAttributes(attribute.String("user.id", id.Hex()))
+
+	user, err := h.users.Restore(ctx, id)
+	if err != nil {
+		h.handleServiceError(ctx, c, span, err, "restoreUser", "Failed to restore user")
+		return
+	}
+
+	log.Ctx(ctx).Info().Str("userId", id.Hex()).Msg("User restored")
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/mock/gomock"
+
+	"tracer/internal/storage"
+)
+
+func TestUserRoutesRejectBadObjectIDs(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+	}{
+		{method: http.MethodGet, path: "/users/not-an-id"},
+		{method: http.MethodPut, path: "/users/not-an-id", body: `{"name":"Alice","version":1}`},
+		{method: http.MethodPatch, path: "/users/not-an-id", body: `{"name":"Alice"}`},
+		{method: http.MethodDelete, path: "/users/not-an-id"},
+		{method: http.MethodPost, path: "/users/not-an-id/restore"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			// The mock fails the test on any repository call
+			s := newTestServer(t)
+
+			rec := s.do(tt.method, tt.path, tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+			if code := errorCode(t, rec); code != codeInvalidID {
+				t.Errorf("code = %q, want %q", code, codeInvalidID)
+			}
+			if status := s.serverSpan(t).Status(); status.Code != codes.Error {
+				t.Errorf("server span status = %v, want Error", status.Code)
+			}
+		})
+	}
+}
+
+func TestUserRoutesMapRepositoryErrors(t *testing.T) {
+	id := storage.NewID()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "not found", err: storage.ErrNotFound, wantStatus: http.StatusNotFound, wantCode: codeNotFound},
+		{name: "circuit open", err: storage.ErrCircuitOpen, wantStatus: http.StatusServiceUnavailable, wantCode: codeUnavailable},
+		{name: "timeout", err: context.DeadlineExceeded, wantStatus: http.StatusGatewayTimeout, wantCode: codeTimeout},
+		{name: "other", err: errors.New("boom"), wantStatus: http.StatusInternalServerError, wantCode: codeInternal},
+	}
+
+	routes := []struct {
+		method, path, body, span string
+		expect                   func(repo *mockRepo, err error)
+		headers                  []string
+	}{
+		{
+			method: http.MethodGet, path: "/users/" + id.Hex(), span: "getUser",
+			expect: func(repo *mockRepo, err error) {
+				repo.EXPECT().GetByID(gomock.Any(), id, false).Return(storage.User{}, err)
+			},
+		},
+		{
+			method: http.MethodPatch, path: "/users/" + id.Hex(), body: `{"name":"Alice"}`, span: "patchUser",
+			expect: func(repo *mockRepo, err error) {
+				repo.EXPECT().Update(gomock.Any(), id, gomock.Any()).Return(storage.User{}, storage.User{}, err)
+			},
+		},
+		{
+			method: http.MethodDelete, path: "/users/" + id.Hex(), span: "deleteUser", headers: []string{"If-Match", "*"},
+			expect: func(repo *mockRepo, err error) {
+				repo.EXPECT().GetByID(gomock.Any(), id, false).Return(storage.User{ID: id, Version: 1}, nil)
+				repo.EXPECT().Delete(gomock.Any(), id).Return(storage.User{}, err)
+			},
+		},
+		{
+			method: http.MethodPost, path: "/users/" + id.Hex() + "/restore", span: "restoreUser",
+			expect: func(repo *mockRepo, err error) {
+				repo.EXPECT().Restore(gomock.Any(), id).Return(storage.User{}, err)
+			},
+		},
+	}
+
+	for _, route := range routes {
+		for _, tt := range tests {
+			t.Run(route.span+"/"+tt.name, func(t *testing.T) {
+				s := newTestServer(t)
+				route.expect(s.repo, tt.err)
+
+				rec := s.do(route.method, route.path, route.body, route.headers...)
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+				}
+				if code := errorCode(t, rec); code != tt.wantCode {
+					t.Errorf("code = %q, want %q", code, tt.wantCode)
+				}
+				if status := s.span(t, route.span).Status(); status.Code != codes.Error {
+					t.Errorf("%s span status = %v, want Error", route.span, status.Code)
+				}
+			})
+		}
+	}
+}
+
+func TestUserRoutesRejectDuplicateEmail(t *testing.T) {
+	id := storage.NewID()
+
+	tests := []struct {
+		name, method, path, body, span string
+		expect                         func(repo *mockRepo)
+	}{
+		{
+			name: "create, caught by the pre-check", method: http.MethodPost, path: "/users",
+			body: `{"name":"Alice","email":"alice@example.com"}`, span: "createUser",
+			expect: func(repo *mockRepo) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(1), nil)
+			},
+		},
+		{
+			name: "create, caught by the unique index", method: http.MethodPost, path: "/users",
+			body: `{"name":"Alice","email":"alice@example.com"}`, span: "createUser",
+			expect: func(repo *mockRepo) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(0), nil)
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(&storage.DuplicateKeyError{Field: "email"})
+			},
+		},
+		{
+			name: "update", method: http.MethodPatch, path: "/users/" + id.Hex(),
+			body: `{"email":"alice@example.com"}`, span: "patchUser",
+			expect: func(repo *mockRepo) {
+				repo.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			tt.expect(s.repo)
+
+			rec := s.do(tt.method, tt.path, tt.body)
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+			}
+			if code := errorCode(t, rec); code != codeConflict {
+				t.Errorf("code = %q, want %q", code, codeConflict)
+			}
+			if status := s.span(t, tt.span).Status(); status.Code != codes.Error {
+				t.Errorf("%s span status = %v, want Error", tt.span, status.Code)
+			}
+			if ops := s.audit.operations(); len(ops) != 0 {
+				t.Errorf("audit entries = %v, want none", ops)
+			}
+		})
+	}
+}
+
+func TestDeleteUsersAuditsEachUser(t *testing.T) {
+	s := newTestServer(t)
+	deleted := []storage.User{{ID: storage.NewID()}, {ID: storage.NewID()}}
+	s.repo.EXPECT().DeleteMany(gomock.Any(), storage.UserFilter{Emails: []string{"shared@example.com"}}, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ storage.UserFilter, fn func([]storage.User)) (int64, error) {
+			fn(deleted)
+			return int64(len(deleted)), nil
+		})
+
+	rec := s.do(http.MethodDelete, "/users?email=shared@example.com", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"deletedCount":2`) {
+		t.Errorf("body = %s, want deletedCount 2", rec.Body)
+	}
+	if ops := s.audit.operations(); strings.Join(ops, ",") != "delete,delete" {
+		t.Errorf("audit entries = %v, want one delete per user", ops)
+	}
+}
+
+func TestDeleteUsersRequiresFilter(t *testing.T) {
+	// The mock fails the test if anything reaches the repository
+	s := newTestServer(t)
+
+	rec := s.do(http.MethodDelete, "/users", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+	}
+}
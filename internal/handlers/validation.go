@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/storage"
+)
+
+// fieldError describes one invalid field of a request body
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var registerFieldNames sync.Once
+
+// useJSONFieldNames makes validation errors name fields as they appear in
+// the JSON body rather than by their Go struct field name. It also lets
+// binding tags check the value of optional fields; fields left out or sent
+// as null are skipped by omitempty and judged by UserUpdate.SetDocument.
+func useJSONFieldNames() {
+	registerFieldNames.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				return field.Name
+			}
+			return name
+		})
+		v.RegisterCustomTypeFunc(func(field reflect.Value) any {
+			optional := field.Interface().(storage.Optional[string])
+			if !optional.Present() {
+				return nil
+			}
+			return optional.Value
+		}, storage.Optional[string]{})
+	})
+}
+
+// bindJSON decodes the request body into obj and validates its binding tags.
+// On failure the 400 response has already been written.
+func bindJSON(ctx context.Context, c *gin.Context, span trace.Span, obj any) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+
+	fields, ok := validationErrors(err)
+	if !ok {
+		log.Ctx(ctx).Error().Err(err).Msg("Failed to bind JSON")
+		respondError(c, codeInvalidRequest, err.Error())
+		return false
+	}
+
+	recordValidationFailure(ctx, span, fields)
+	respondErrorDetails(c, codeInvalidRequest, "Validation failed", gin.H{"fields": fields})
+	return false
+}
+
+// validate checks obj against its binding tags, returning the invalid fields
+func validate(obj any) []fieldError {
+	fields, _ := validationErrors(binding.Validator.ValidateStruct(obj))
+	return fields
+}
+
+// validationErrors formats the field-level errors reported by the validator.
+// It returns false if err is not a validation error.
+func validationErrors(err error) ([]fieldError, bool) {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return nil, false
+	}
+
+	fields := make([]fieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		fields = append(fields, fieldError{Field: fe.Field(), Message: validationMessage(fe)})
+	}
+	return fields, true
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s characters", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters", fe.Param())
+	default:
+		return fmt.Sprintf("failed %q validation", fe.Tag())
+	}
+}
+
+// recordValidationFailure logs the invalid fields and adds them to the span
+// as an event, so rejected requests can be told apart in traces
+func recordValidationFailure(ctx context.Context, span trace.Span, fields []fieldError) {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.Field
+	}
+
+	span.AddEvent("validation.failed", trace.WithAttributes(
+		attribute.StringSlice("validation.fields", names),
+	))
+	log.Ctx(ctx).Warn().Strs("fields", names).Msg("Request validation failed")
+}
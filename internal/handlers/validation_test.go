@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"tracer/internal/storage"
+)
+
+func TestValidateChecksOptionalFieldValues(t *testing.T) {
+	useJSONFieldNames()
+
+	tests := []struct {
+		name   string
+		update storage.UserUpdate
+		want   []string
+	}{
+		{name: "omitted", update: storage.UserUpdate{}},
+		// Null and empty values are rejected by SetDocument, not the binding tags
+		{name: "null", update: storage.UserUpdate{Name: storage.Optional[string]{Set: true, Null: true}}},
+		{name: "empty", update: storage.UserUpdate{Email: storage.Some("")}},
+		{name: "valid", update: storage.UserUpdate{Name: storage.Some("Alice"), Email: storage.Some("alice@example.com")}},
+		{name: "name too long", update: storage.UserUpdate{Name: storage.Some(strings.Repeat("a", 101))}, want: []string{"name"}},
+		{name: "email invalid", update: storage.UserUpdate{Email: storage.Some("not-an-address")}, want: []string{"email"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := validate(tt.update)
+
+			var got []string
+			for _, field := range fields {
+				got = append(got, field.Field)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("validate() fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
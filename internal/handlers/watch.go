@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/storage"
+)
+
+type userEvent struct {
+	Type      string        `json:"type"`
+	Operation string        `json:"operation"`
+	UserID    string        `json:"userId"`
+	User      *storage.User `json:"user,omitempty"`
+}
+
+// eventType maps a change to created, updated or deleted. Users are soft
+// deleted, so an update that leaves deletedAt set counts as a delete.
+func eventType(change storage.ChangeEvent) string {
+	switch change.OperationType {
+	case "insert":
+		return "created"
+	case "delete":
+		return "deleted"
+	}
+	if change.FullDocument != nil && change.FullDocument.DeletedAt != nil {
+		return "deleted"
+	}
+	return "updated"
+}
+
+// newUserEvent is the form in which a change is sent to clients
+func newUserEvent(change storage.ChangeEvent) userEvent {
+	return userEvent{
+		Type:      eventType(change),
+		Operation: change.OperationType,
+		UserID:    change.DocumentKey.ID.Hex(),
+		User:      change.FullDocument,
+	}
+}
+
+// watchUsers streams user changes as Server-Sent Events until the client
+// disconnects or the server shuts down. Change streams require MongoDB to
+// run as a replica set.
+func (h *Handler) watchUsers(c *gin.Context) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	defer context.AfterFunc(h.streams, cancel)()
+
+	ctx, span := h.tracer.Start(ctx, "watchUsers")
+	defer span.End()
+
+	// EventSource clients send back the last event ID when they reconnect,
+	// which is the resume token of the last event they received
+	stream, err := h.users.Watch(ctx, c.GetHeader("Last-Event-ID"))
+	if err != nil {
+		h.handleServiceError(ctx, c, span, err, "watchUsers", "Failed to watch users")
+		return
+	}
+	defer stream.Close(context.Background())
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	var events int64
+	defer func() {
+		span.SetAttributes(attribute.Int64("change_stream.events", events))
+	}()
+
+	for stream.Next(ctx) {
+		change, err := stream.Event()
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Failed to decode change event")
+			continue
+		}
+
+		event := newUserEvent(change)
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msg("Failed to encode change event")
+			continue
+		}
+
+		if _, err := fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", stream.ResumeToken(), event.Type, data); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("Failed to write change event")
+			return
+		}
+		c.Writer.Flush()
+		span.AddEvent("change_stream.event", trace.WithAttributes(
+			attribute.String("change_stream.operation", change.OperationType),
+			attribute.String("change_stream.event_type", event.Type),
+		))
+		events++
+	}
+
+	if err := stream.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		log.Ctx(ctx).Error().Err(err).Msg("Change stream failed")
+		return
+	}
+
+	log.Ctx(ctx).Info().Int64("events", events).Msg("Change stream closed")
+}
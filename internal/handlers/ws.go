@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/telemetry"
+)
+
+const (
+	// Events queued per client before it is dropped as too slow
+	wsSendBuffer = 64
+	// Longest a single write to a client may take
+	wsWriteWait = 10 * time.Second
+	// Longest a client may stay silent, pongs included
+	wsPongWait = 60 * time.Second
+	// Must be shorter than wsPongWait so pongs arrive in time
+	wsPingPeriod = wsPongWait * 9 / 10
+	// Largest message accepted from a client
+	wsMaxMessageSize = 1024
+)
+
+// The default origin check only accepts same-origin browser connections
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// wsRequest is a message sent by a client
+type wsRequest struct {
+	Action string   `json:"action"`
+	Types  []string `json:"types"`
+}
+
+// serveWebSocket upgrades the connection and forwards user events from the
+// hub until either side closes it. Clients receive every event type unless
+// they send {"action":"subscribe","types":["deleted"]} to narrow it down.
+func (h *Handler) serveWebSocket(c *gin.Context) {
+	ctx, span := h.tracer.Start(c.Request.Context(), "websocket.connection")
+	defer span.End()
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already answered with an error status
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "upgrade failed")
+		log.Ctx(ctx).Warn().Err(err).Msg("WebSocket upgrade failed")
+		return
+	}
+	defer conn.Close()
+
+	client := &wsClient{
+		send:   make(chan wsMessage, wsSendBuffer),
+		tenant: telemetry.TenantFromContext(ctx),
+	}
+	if !h.hub.subscribe(client) {
+		closeWebSocket(conn, websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	span.AddEvent("websocket.opened")
+	log.Ctx(ctx).Info().Msg("WebSocket client connected")
+
+	var received int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		received = h.readWebSocket(ctx, span, conn, client)
+	}()
+
+	sent := writeWebSocket(ctx, span, conn, client, done)
+	h.hub.unsubscribe(client)
+	// Unblocks the reader if the writer stopped first
+	conn.Close()
+	<-done
+
+	span.AddEvent("websocket.closed", trace.WithAttributes(attribute.String("websocket.close_reason", client.closeReason)))
+	span.SetAttributes(
+		attribute.Int64("websocket.messages_sent", sent),
+		attribute.Int64("websocket.messages_received", received),
+	)
+	log.Ctx(ctx).Info().Int64("sent", sent).Int64("received", received).Str("reason", client.closeReason).Msg("WebSocket client disconnected")
+}
+
+// readWebSocket handles client messages until the connection fails or the
+// client goes quiet for longer than wsPongWait
+func (h *Handler) readWebSocket(ctx context.Context, span trace.Span, conn *websocket.Conn, client *wsClient) int64 {
+	conn.SetReadLimit(wsMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	var received int64
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Ctx(ctx).Warn().Err(err).Msg("WebSocket read failed")
+			}
+			return received
+		}
+		received++
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil || req.Action != "subscribe" {
+			span.AddEvent("websocket.message.received", trace.WithAttributes(attribute.Bool("websocket.message.invalid", true)))
+			log.Ctx(ctx).Debug().Int("bytes", len(data)).Msg("Ignored WebSocket message")
+			continue
+		}
+
+		h.hub.setTypes(client, req.Types)
+		span.AddEvent("websocket.message.received", trace.WithAttributes(
+			attribute.String("websocket.action", req.Action),
+			attribute.StringSlice("websocket.types", req.Types),
+		))
+	}
+}
+
+// writeWebSocket sends queued events and keepalive pings until the hub drops
+// the client, a write fails or the reader stops
+func writeWebSocket(ctx context.Context, span trace.Span, conn *websocket.Conn, client *wsClient, readerDone <-chan struct{}) int64 {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	var sent int64
+	for {
+		select {
+		case msg, ok := <-client.send:
+			if !ok {
+				closeWebSocket(conn, websocket.CloseGoingAway, client.closeReason)
+				return sent
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, msg.data); err != nil {
+				log.Ctx(ctx).Warn().Err(err).Msg("WebSocket write failed")
+				return sent
+			}
+			span.AddEvent("websocket.message.sent", trace.WithAttributes(attribute.String("change_stream.event_type", msg.eventType)))
+			sent++
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return sent
+			}
+		case <-readerDone:
+			return sent
+		}
+	}
+}
+
+func closeWebSocket(conn *websocket.Conn, code int, reason string) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+}
@@ -0,0 +1,133 @@
+// Package jobs runs deferred work, such as welcome emails, outside the
+// request that asked for it. Each job runs in a trace of its own, linked to
+// the span that enqueued it.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+var (
+	// ErrQueueFull is returned by the in-process queue when no slot is free
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrQueueClosed is returned for jobs enqueued during shutdown
+	ErrQueueClosed = errors.New("job queue is closed")
+)
+
+// Handler does the work for one job type. Returning an error retries the
+// job until its attempts run out.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Queue accepts jobs and runs them with the handler registered for their type
+type Queue interface {
+	Register(jobType string, handler Handler)
+	Enqueue(ctx context.Context, jobType string, payload any) error
+	// Close stops taking jobs and waits for running ones until ctx is done
+	Close(ctx context.Context)
+}
+
+// Job is a unit of deferred work. Trace holds the propagation headers of
+// the span that enqueued it.
+type Job struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Type       string             `bson:"type"`
+	Payload    json.RawMessage    `bson:"payload"`
+	Trace      map[string]string  `bson:"trace,omitempty"`
+	Attempts   int                `bson:"attempts"`
+	EnqueuedAt time.Time          `bson:"enqueuedAt"`
+}
+
+// newJob captures the caller's trace context so the job can link back to it
+func newJob(ctx context.Context, jobType string, payload any) (Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, fmt.Errorf("encode %s payload: %w", jobType, err)
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	job := Job{
+		ID:         primitive.NewObjectID(),
+		Type:       jobType,
+		Payload:    data,
+		Trace:      carrier,
+		EnqueuedAt: storage.Now(),
+	}
+	trace.SpanFromContext(ctx).AddEvent("job.enqueued", trace.WithAttributes(
+		attribute.String("job.id", job.ID.Hex()),
+		attribute.String("job.type", jobType),
+	))
+	return job, nil
+}
+
+// registry maps job types to handlers and runs jobs, shared by the queues
+type registry struct {
+	tracer telemetry.Tracer
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func newRegistry(tracer telemetry.Tracer) registry {
+	return registry{tracer: tracer, handlers: make(map[string]Handler)}
+}
+
+func (r *registry) Register(jobType string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[jobType] = handler
+}
+
+// execute runs one attempt of job under ctx, in a new root span linked to
+// the span that enqueued it, since the job outlives that request
+func (r *registry) execute(ctx context.Context, job Job) error {
+	origin := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(job.Trace))
+	ctx, span := r.tracer.Start(ctx, "job "+job.Type,
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.Link{SpanContext: trace.SpanContextFromContext(origin)}),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+	)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("job.id", job.ID.Hex()),
+		attribute.String("job.type", job.Type),
+		attribute.Int("job.attempt", job.Attempts),
+		attribute.Int64("job.queued_ms", time.Since(job.EnqueuedAt).Milliseconds()),
+	)
+
+	r.mu.RLock()
+	handler, ok := r.handlers[job.Type]
+	r.mu.RUnlock()
+	if !ok {
+		err := fmt.Errorf("no handler for job type %q", job.Type)
+		span.SetStatus(codes.Error, err.Error())
+		log.Ctx(ctx).Error().Err(err).Str("jobId", job.ID.Hex()).Msg("Job failed")
+		return err
+	}
+
+	if err := handler(ctx, job.Payload); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Ctx(ctx).Warn().Err(err).Str("jobId", job.ID.Hex()).Str("type", job.Type).Int("attempt", job.Attempts).Msg("Job failed")
+		return err
+	}
+	return nil
+}
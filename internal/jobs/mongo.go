@@ -0,0 +1,203 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"tracer/internal/config"
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// States of a job document
+const (
+	statusPending = "pending"
+	statusRunning = "running"
+	statusDone    = "done"
+	statusFailed  = "failed"
+)
+
+// How long a claimed job is reserved before another worker may take it
+// over, covering workers that died mid-job
+const leaseDuration = 5 * time.Minute
+
+// jobDocument is a Job as stored in the jobs collection
+type jobDocument struct {
+	Job         `bson:",inline"`
+	Status      string     `bson:"status"`
+	RunAt       time.Time  `bson:"runAt"`
+	LastError   string     `bson:"lastError,omitempty"`
+	CompletedAt *time.Time `bson:"completedAt,omitempty"`
+}
+
+// MongoQueue keeps jobs in a MongoDB collection, so they survive restarts
+// and are shared by every instance. A single poller claims due jobs and
+// hands them to up to Workers goroutines.
+type MongoQueue struct {
+	registry
+	collection   *mongo.Collection
+	pollInterval time.Duration
+	maxAttempts  int
+	retryDelay   time.Duration
+
+	slots chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func NewMongoQueue(collection *mongo.Collection, cfg config.JobsConfig, tracer telemetry.Tracer) *MongoQueue {
+	q := &MongoQueue{
+		registry:     newRegistry(tracer),
+		collection:   collection,
+		pollInterval: cfg.PollInterval,
+		maxAttempts:  cfg.MaxAttempts,
+		retryDelay:   cfg.RetryDelay,
+		slots:        make(chan struct{}, cfg.Workers),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go q.poll()
+	return q
+}
+
+// EnsureJobIndexes supports claiming the next due job
+func EnsureJobIndexes(ctx context.Context, collection *mongo.Collection) error {
+	model := mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "runAt", Value: 1}},
+		Options: options.Index().SetName("jobs_due"),
+	}
+
+	name, err := collection.Indexes().CreateOne(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("index", name).Msg("Job index ensured")
+	return nil
+}
+
+func (q *MongoQueue) Enqueue(ctx context.Context, jobType string, payload any) error {
+	select {
+	case <-q.stop:
+		return ErrQueueClosed
+	default:
+	}
+
+	job, err := newJob(ctx, jobType, payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.collection.InsertOne(ctx, jobDocument{Job: job, Status: statusPending, RunAt: job.EnqueuedAt})
+	return err
+}
+
+// poll claims due jobs while a worker slot is free, and sleeps for
+// pollInterval when there are none
+func (q *MongoQueue) poll() {
+	defer close(q.done)
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case q.slots <- struct{}{}:
+		}
+
+		doc, err := q.claim()
+		if err != nil {
+			<-q.slots
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				log.Error().Err(err).Msg("Failed to claim job")
+			}
+
+			select {
+			case <-q.stop:
+				return
+			case <-time.After(q.pollInterval):
+			}
+			continue
+		}
+
+		go func() {
+			defer func() { <-q.slots }()
+			q.run(doc)
+		}()
+	}
+}
+
+// claim reserves the oldest due job: a pending one whose retry time has
+// come, or a running one whose lease has expired
+func (q *MongoQueue) claim() (jobDocument, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), q.pollInterval)
+	defer cancel()
+
+	now := storage.Now()
+	filter := bson.M{
+		"status": bson.M{"$in": bson.A{statusPending, statusRunning}},
+		"runAt":  bson.M{"$lte": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"status": statusRunning, "runAt": now.Add(leaseDuration)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "runAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var doc jobDocument
+	err := q.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	return doc, err
+}
+
+// run executes a claimed job and records the outcome, scheduling a retry
+// retryDelay times the attempt number later while attempts remain
+func (q *MongoQueue) run(doc jobDocument) {
+	err := q.execute(context.Background(), doc.Job)
+
+	now := storage.Now()
+	set := bson.M{}
+	switch {
+	case err == nil:
+		set["status"] = statusDone
+		set["completedAt"] = now
+	case doc.Attempts >= q.maxAttempts:
+		set["status"] = statusFailed
+		set["lastError"] = err.Error()
+		set["completedAt"] = now
+	default:
+		set["status"] = statusPending
+		set["lastError"] = err.Error()
+		set["runAt"] = now.Add(q.retryDelay * time.Duration(doc.Attempts))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), q.pollInterval)
+	defer cancel()
+	if _, err := q.collection.UpdateByID(ctx, doc.ID, bson.M{"$set": set}); err != nil {
+		log.Error().Err(err).Str("jobId", doc.ID.Hex()).Msg("Failed to record job outcome")
+	}
+}
+
+// Close stops claiming jobs and waits for running ones until ctx is done.
+// Unfinished jobs are picked up again once their lease expires.
+func (q *MongoQueue) Close(ctx context.Context) {
+	close(q.stop)
+	<-q.done
+
+	// Every slot is free once the running jobs have finished
+	for i := 0; i < cap(q.slots); i++ {
+		select {
+		case q.slots <- struct{}{}:
+		case <-ctx.Done():
+			log.Warn().Msg("Timed out waiting for running jobs")
+			return
+		}
+	}
+	log.Info().Msg("Job queue stopped")
+}
@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tracer/internal/config"
+	"tracer/internal/telemetry"
+)
+
+// Pool runs jobs on in-process workers. Queued jobs are lost if the process
+// exits before they run; use MongoQueue when that matters.
+type Pool struct {
+	registry
+	maxAttempts int
+	retryDelay  time.Duration
+
+	jobs chan Job
+	wg   sync.WaitGroup
+
+	// Canceled by Close once its deadline passes, to stop running handlers
+	// and pending retries
+	stopCtx context.Context
+	stop    context.CancelFunc
+
+	// Guards jobs against sends after Close
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewPool(cfg config.JobsConfig, tracer telemetry.Tracer) *Pool {
+	stopCtx, stop := context.WithCancel(context.Background())
+	p := &Pool{
+		registry:    newRegistry(tracer),
+		maxAttempts: cfg.MaxAttempts,
+		retryDelay:  cfg.RetryDelay,
+		jobs:        make(chan Job, cfg.QueueSize),
+		stopCtx:     stopCtx,
+		stop:        stop,
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				if p.stopCtx.Err() == nil {
+					p.run(job)
+				}
+			}
+		}()
+	}
+	return p
+}
+
+func (p *Pool) Enqueue(ctx context.Context, jobType string, payload any) error {
+	job, err := newJob(ctx, jobType, payload)
+	if err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case p.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// run retries a failing job in place, waiting retryDelay times the attempt
+// number between attempts. It gives up once the pool is stopped.
+func (p *Pool) run(job Job) {
+	for attempt := 1; attempt <= p.maxAttempts; attempt++ {
+		job.Attempts = attempt
+		if p.execute(p.stopCtx, job) == nil {
+			return
+		}
+		if attempt == p.maxAttempts {
+			return
+		}
+
+		select {
+		case <-time.After(p.retryDelay * time.Duration(attempt)):
+		case <-p.stopCtx.Done():
+			log.Warn().Str("jobId", job.ID.Hex()).Str("type", job.Type).Int("attempts", attempt).Msg("Job abandoned at shutdown")
+			return
+		}
+	}
+}
+
+// Close stops taking jobs and waits for queued ones to run until ctx is
+// done. It then cancels the running handlers, drops the queued jobs and
+// waits for the workers to exit.
+func (p *Pool) Close(ctx context.Context) {
+	p.mu.Lock()
+	p.closed = true
+	close(p.jobs)
+	p.mu.Unlock()
+	defer p.stop()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info().Msg("Job pool stopped")
+		return
+	case <-ctx.Done():
+	}
+
+	pending := len(p.jobs)
+	p.stop()
+	<-done
+	log.Warn().Int("pending", pending).Msg("Timed out running queued jobs")
+}
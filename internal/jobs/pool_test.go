@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tracer/internal/config"
+	"tracer/internal/telemetry"
+)
+
+func TestPoolCloseCancelsRunningJobs(t *testing.T) {
+	pool := NewPool(config.JobsConfig{Workers: 1, QueueSize: 4, MaxAttempts: 3, RetryDelay: time.Hour}, telemetry.NewTracer())
+
+	var attempts atomic.Int32
+	started := make(chan struct{}, 1)
+	pool.Register("block", func(ctx context.Context, _ json.RawMessage) error {
+		attempts.Add(1)
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := pool.Enqueue(context.Background(), "block", nil); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	closed := make(chan struct{})
+	go func() {
+		pool.Close(ctx)
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() did not return after its deadline")
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("attempts = %d, want 1 with the retry cut short", got)
+	}
+}
+
+func TestPoolCloseStopsRetryWait(t *testing.T) {
+	pool := NewPool(config.JobsConfig{Workers: 1, QueueSize: 4, MaxAttempts: 3, RetryDelay: time.Hour}, telemetry.NewTracer())
+
+	failed := make(chan struct{}, 1)
+	pool.Register("fail", func(context.Context, json.RawMessage) error {
+		failed <- struct{}{}
+		return errors.New("boom")
+	})
+	if err := pool.Enqueue(context.Background(), "fail", nil); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	<-failed
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	pool.Close(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Close() took %s waiting out the retry delay", elapsed)
+	}
+}
@@ -0,0 +1,55 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/service"
+)
+
+// TypeWelcomeEmail greets newly created users
+const TypeWelcomeEmail = "welcome_email"
+
+type welcomeEmail struct {
+	UserID string `json:"userId"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+}
+
+// SendWelcomeEmail stands in for a mail provider call; it only logs the
+// message that would be sent
+func SendWelcomeEmail(ctx context.Context, payload json.RawMessage) error {
+	var msg welcomeEmail
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return err
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("user.id", msg.UserID))
+	log.Ctx(ctx).Info().Str("userId", msg.UserID).Msg("Sending welcome email")
+	return nil
+}
+
+// WelcomeEmails is an event publisher that enqueues a welcome email for
+// every created user
+type WelcomeEmails struct {
+	Queue Queue
+}
+
+func (w WelcomeEmails) Publish(ctx context.Context, event service.UserEvent) {
+	if event.Type != service.EventUserCreated {
+		return
+	}
+
+	err := w.Queue.Enqueue(ctx, TypeWelcomeEmail, welcomeEmail{
+		UserID: event.User.ID.Hex(),
+		Name:   event.User.Name,
+		Email:  event.User.Email,
+	})
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("userId", event.User.ID.Hex()).Msg("Failed to enqueue welcome email")
+	}
+}
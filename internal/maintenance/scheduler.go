@@ -0,0 +1,84 @@
+// Package maintenance runs periodic housekeeping on a cron schedule. Every
+// run is a trace of its own.
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/telemetry"
+)
+
+// Task does one run of a job and reports how many documents it touched
+type Task func(ctx context.Context) (affected int64, err error)
+
+// Scheduler runs tasks on cron schedules. A run that is still going when
+// its next one is due makes that one skip.
+type Scheduler struct {
+	cron    *cron.Cron
+	tracer  telemetry.Tracer
+	timeout time.Duration
+}
+
+// NewScheduler bounds every run by timeout
+func NewScheduler(tracer telemetry.Tracer, timeout time.Duration) *Scheduler {
+	return &Scheduler{
+		cron:    cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger))),
+		tracer:  tracer,
+		timeout: timeout,
+	}
+}
+
+// Add schedules task under name. Schedules use the standard five cron
+// fields or descriptors such as @daily and @every 5m.
+func (s *Scheduler) Add(name, schedule string, task Task) error {
+	_, err := s.cron.AddFunc(schedule, func() {
+		s.run(name, schedule, task)
+	})
+	return err
+}
+
+func (s *Scheduler) run(name, schedule string, task Task) {
+	ctx, span := s.tracer.Start(context.Background(), "cron "+name, trace.WithNewRoot())
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("cron.job", name),
+		attribute.String("cron.schedule", schedule),
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	affected, err := task(ctx)
+	span.SetAttributes(attribute.Int64("cron.affected", affected))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Ctx(ctx).Error().Err(err).Str("job", name).Msg("Maintenance job failed")
+		return
+	}
+
+	log.Ctx(ctx).Info().Str("job", name).Int64("affected", affected).Dur("duration", time.Since(start)).Msg("Maintenance job finished")
+}
+
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop prevents new runs and waits for running ones until ctx is done
+func (s *Scheduler) Stop(ctx context.Context) {
+	select {
+	case <-s.cron.Stop().Done():
+		log.Info().Msg("Maintenance scheduler stopped")
+	case <-ctx.Done():
+		log.Warn().Msg("Timed out waiting for maintenance jobs")
+	}
+}
@@ -0,0 +1,138 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// Users is the part of the user service the jobs run through. Every call
+// is scoped to the tenant in the context, like a request's would be.
+type Users interface {
+	Tenants(ctx context.Context) ([]string, error)
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	Count(ctx context.Context) (storage.UserCounts, error)
+}
+
+// forEachTenant calls fn once per tenant, each under a span of its own with
+// the tenant set on the context. A failing tenant does not hold up the
+// others; their errors are returned together.
+func forEachTenant(ctx context.Context, users Users, tracer telemetry.Tracer, fn func(ctx context.Context, tenant string) error) error {
+	tenants, err := users.Tenants(ctx)
+	if err != nil {
+		return fmt.Errorf("list tenants: %w", err)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("tenant.count", len(tenants)))
+
+	var errs []error
+	for _, tenant := range tenants {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		tenantCtx, span := tracer.Start(ctx, "cron tenant")
+		if tenant != "" {
+			tenantCtx = telemetry.WithTenant(tenantCtx, tenant)
+		}
+		if err := fn(tenantCtx, tenant); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			errs = append(errs, fmt.Errorf("tenant %q: %w", tenant, err))
+		}
+		span.End()
+	}
+	return errors.Join(errs...)
+}
+
+// PurgeDeletedUsers removes users that were soft-deleted more than
+// retention ago, tenant by tenant. They can no longer be restored
+// afterwards.
+func PurgeDeletedUsers(users Users, tracer telemetry.Tracer, retention time.Duration) Task {
+	return func(ctx context.Context) (int64, error) {
+		cutoff := storage.Now().Add(-retention)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("purge.cutoff", cutoff.Format(time.RFC3339)))
+
+		var purged int64
+		err := forEachTenant(ctx, users, tracer, func(ctx context.Context, _ string) error {
+			count, err := users.Purge(ctx, cutoff)
+			purged += count
+			return err
+		})
+		return purged, err
+	}
+}
+
+// RefreshUserStats counts every tenant's active and soft-deleted users and
+// exports the counts as the users.count gauge, labeled by user.state and
+// tenant.id. The gauge reports the last refresh, so the counts never hit
+// MongoDB on a metrics scrape. A tenant whose count fails keeps its last
+// one.
+func RefreshUserStats(users Users, tracer telemetry.Tracer, meter metric.Meter) (Task, error) {
+	var mu sync.Mutex
+	counts := make(map[string]storage.UserCounts)
+
+	_, err := meter.Int64ObservableGauge("users.count",
+		metric.WithDescription("Number of users, by active or deleted state, as of the last stats refresh"),
+		metric.WithUnit("{user}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for tenant, count := range counts {
+				attrs := []attribute.KeyValue{}
+				if tenant != "" {
+					attrs = append(attrs, attribute.String(telemetry.TenantAttribute, tenant))
+				}
+				o.Observe(count.Active, metric.WithAttributes(append(attrs, attribute.String("user.state", "active"))...))
+				o.Observe(count.Deleted, metric.WithAttributes(append(attrs, attribute.String("user.state", "deleted"))...))
+			}
+			return nil
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("create users.count gauge: %w", err)
+	}
+
+	return func(ctx context.Context) (int64, error) {
+		mu.Lock()
+		previous := counts
+		mu.Unlock()
+
+		refreshed := make(map[string]storage.UserCounts)
+		var total int64
+		err := forEachTenant(ctx, users, tracer, func(ctx context.Context, tenant string) error {
+			count, err := users.Count(ctx)
+			if err != nil {
+				if last, ok := previous[tenant]; ok {
+					refreshed[tenant] = last
+				}
+				return err
+			}
+
+			refreshed[tenant] = count
+			total += count.Active + count.Deleted
+			trace.SpanFromContext(ctx).SetAttributes(
+				attribute.Int64("users.active", count.Active),
+				attribute.Int64("users.deleted", count.Deleted),
+			)
+			return nil
+		})
+
+		// If the tenants could not be listed, the last counts stay
+		if len(refreshed) > 0 || err == nil {
+			mu.Lock()
+			counts = refreshed
+			mu.Unlock()
+		}
+		return total, err
+	}, nil
+}
@@ -0,0 +1,57 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// tenantUsers answers for a fixed set of tenants, failing the ones in fail
+type tenantUsers struct {
+	tenants []string
+	fail    map[string]bool
+	purged  []string
+}
+
+func (u *tenantUsers) Tenants(context.Context) ([]string, error) {
+	return u.tenants, nil
+}
+
+func (u *tenantUsers) Purge(ctx context.Context, _ time.Time) (int64, error) {
+	tenant := telemetry.TenantFromContext(ctx)
+	if u.fail[tenant] {
+		return 0, errors.New("boom")
+	}
+	u.purged = append(u.purged, tenant)
+	return 2, nil
+}
+
+func (u *tenantUsers) Count(context.Context) (storage.UserCounts, error) {
+	return storage.UserCounts{}, nil
+}
+
+func TestPurgeDeletedUsersVisitsEveryTenant(t *testing.T) {
+	users := &tenantUsers{tenants: []string{"", "acme", "globex", "initech"}, fail: map[string]bool{"globex": true}}
+
+	purged, err := PurgeDeletedUsers(users, telemetry.NewTracer(), time.Hour)(context.Background())
+	if err == nil {
+		t.Fatal("PurgeDeletedUsers() error = nil, want the failing tenant's error")
+	}
+	if purged != 6 {
+		t.Errorf("purged = %d, want 6", purged)
+	}
+	want := []string{"", "acme", "initech"}
+	if len(users.purged) != len(want) {
+		t.Fatalf("purged tenants = %q, want %q", users.purged, want)
+	}
+	for i := range want {
+		if users.purged[i] != want[i] {
+			t.Errorf("purged tenants = %q, want %q", users.purged, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Package migrations applies versioned changes to a MongoDB database, such
+// as new indexes and backfills, once per database. Applied versions are
+// recorded in the migrations collection. Every run is traced, with a child
+// span per migration.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// Migration moves a database to Version. Up must be safe to run again after
+// a failed attempt, and reports how many documents it touched.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) (affected int64, err error)
+}
+
+// record is kept in the migrations collection for every applied migration
+type record struct {
+	Version    int       `bson:"_id"`
+	Name       string    `bson:"name"`
+	AppliedAt  time.Time `bson:"appliedAt"`
+	DurationMs int64     `bson:"durationMs"`
+	Affected   int64     `bson:"affected"`
+}
+
+// The lock shares the collection with the records, under a string _id
+const lockID = "lock"
+
+// How often a migrator waiting for the lock tries again
+const lockRetryInterval = time.Second
+
+// Migrator applies migrations to one database
+type Migrator struct {
+	db         *mongo.Database
+	collection *mongo.Collection
+	tracer     telemetry.Tracer
+	migrations []Migration
+
+	// How long a lock is honoured if its holder dies without releasing it
+	lockTTL time.Duration
+}
+
+// NewMigrator sorts migrations by version. lockTTL must exceed the longest
+// run, or a second migrator may start while the first is still going.
+func NewMigrator(db *mongo.Database, tracer telemetry.Tracer, migrations []Migration, lockTTL time.Duration) *Migrator {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	return &Migrator{
+		db:         db,
+		collection: db.Collection("migrations"),
+		tracer:     tracer,
+		migrations: sorted,
+		lockTTL:    lockTTL,
+	}
+}
+
+// Pending returns the migrations not applied yet, in version order
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]bool, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]bool, len(records))
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+	return applied, nil
+}
+
+// Up applies the pending migrations in version order and stops at the first
+// failure. It holds a lock meanwhile, so replicas starting together wait for
+// each other instead of applying a migration twice.
+func (m *Migrator) Up(ctx context.Context) (applied int, err error) {
+	ctx, span := m.tracer.Start(ctx, "migrations.Up")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("db.name", m.db.Name()))
+	defer func() {
+		span.SetAttributes(attribute.Int("migration.applied", applied))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}()
+
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer unlock()
+
+	// Read after locking, so migrations another replica just applied are seen
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+	span.SetAttributes(attribute.Int("migration.pending", len(pending)))
+
+	for _, migration := range pending {
+		if err := m.apply(ctx, migration); err != nil {
+			return applied, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		applied++
+	}
+
+	if applied == 0 {
+		log.Ctx(ctx).Debug().Str("database", m.db.Name()).Msg("No pending migrations")
+	}
+	return applied, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	ctx, span := m.tracer.Start(ctx, "migration "+migration.Name)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("migration.version", migration.Version),
+		attribute.String("migration.name", migration.Name),
+	)
+
+	start := time.Now()
+	affected, err := migration.Up(ctx, m.db)
+	span.SetAttributes(attribute.Int64("migration.affected", affected))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Ctx(ctx).Error().Err(err).Int("version", migration.Version).Str("migration", migration.Name).Msg("Migration failed")
+		return err
+	}
+
+	duration := time.Since(start)
+	_, err = m.collection.InsertOne(ctx, record{
+		Version:    migration.Version,
+		Name:       migration.Name,
+		AppliedAt:  storage.Now(),
+		DurationMs: duration.Milliseconds(),
+		Affected:   affected,
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("record migration: %w", err)
+	}
+
+	log.Ctx(ctx).Info().Int("version", migration.Version).Str("migration", migration.Name).
+		Str("database", m.db.Name()).Int64("affected", affected).Dur("duration", duration).Msg("Migration applied")
+	return nil
+}
+
+// lock waits until no other migrator holds the lock or its lease ran out,
+// then takes it. The returned function releases it.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	owner := primitive.NewObjectID()
+	for {
+		now := storage.Now()
+		// Matches nothing while another migrator holds a live lock, and the
+		// upsert then fails on the duplicate _id
+		_, err := m.collection.UpdateOne(ctx,
+			bson.M{"_id": lockID, "expiresAt": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{"owner": owner, "expiresAt": now.Add(m.lockTTL)}},
+			options.Update().SetUpsert(true))
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		log.Ctx(ctx).Debug().Str("database", m.db.Name()).Msg("Waiting for the migration lock")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	return func() {
+		// Released even when ctx has already ended
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		_, err := m.collection.DeleteOne(ctx, bson.M{"_id": lockID, "owner": owner})
+		if err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("Failed to release the migration lock; it expires on its own")
+		}
+	}, nil
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All is every migration. Append new ones with the next version; never
+// change or renumber one that has been released.
+var All = []Migration{
+	{Version: 1, Name: "backfill_user_timestamps", Up: backfillUserTimestamps},
+	{Version: 2, Name: "index_users_deleted_at", Up: indexUsersDeletedAt},
+}
+
+// backfillUserTimestamps gives users written before timestamps were tracked
+// a createdAt taken from their ObjectID, and an updatedAt equal to it.
+// Such users have no field at all, or the zero time.
+func backfillUserTimestamps(ctx context.Context, db *mongo.Database) (int64, error) {
+	users := db.Collection("users")
+	missing := func(field string) bson.M {
+		return bson.M{"$or": bson.A{
+			bson.M{field: bson.M{"$exists": false}},
+			bson.M{field: time.Time{}},
+		}}
+	}
+
+	created, err := users.UpdateMany(ctx, missing("createdAt"),
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"createdAt": bson.M{"$toDate": "$_id"}}}}})
+	if err != nil {
+		return 0, err
+	}
+
+	updated, err := users.UpdateMany(ctx, missing("updatedAt"),
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"updatedAt": "$createdAt"}}}})
+	if err != nil {
+		return created.ModifiedCount, err
+	}
+	return created.ModifiedCount + updated.ModifiedCount, nil
+}
+
+// indexUsersDeletedAt backs the purge of soft-deleted users. Partial, so
+// active users take no space in it.
+func indexUsersDeletedAt(ctx context.Context, db *mongo.Database) (int64, error) {
+	_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "deletedAt", Value: 1}},
+		Options: options.Index().
+			SetName("users_deleted_at").
+			SetPartialFilterExpression(bson.M{"deletedAt": bson.M{"$exists": true}}),
+	})
+	return 0, err
+}
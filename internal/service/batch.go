@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/storage"
+)
+
+// Users sent to the repository per CreateMany call
+const batchChunkSize = 100
+
+// ErrBatchSkipped marks users of an ordered batch that were not attempted
+// because an earlier user failed
+var ErrBatchSkipped = errors.New("skipped after an earlier failure")
+
+// CreateMany creates users in chunks, checking each one like Create does.
+// It returns one error per user, nil for those created, and fills in the
+// stored fields of every user it attempted. Ordered batches stop at the
+// first failure and report the users after it as ErrBatchSkipped.
+func (s *UserService) CreateMany(ctx context.Context, users []storage.User, ordered bool) []error {
+	ctx, span := s.tracer.Start(ctx, "UserService.CreateMany")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.operation", "create_many"),
+		attribute.Int("batch.size", len(users)),
+		attribute.Bool("batch.ordered", ordered),
+	)
+
+	errs := make([]error, len(users))
+	taken, err := s.takenEmails(ctx, users)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	pending := make([]int, 0, len(users))
+	failed := false
+	for i := range users {
+		if ordered && failed {
+			errs[i] = ErrBatchSkipped
+			continue
+		}
+
+		// New users always start out active
+		users[i].DeletedAt = nil
+		if err := s.checkNewUser(ctx, users[i], taken); err != nil {
+			errs[i] = err
+			failed = true
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for start := 0; start < len(pending); start += batchChunkSize {
+		chunk := pending[start:min(start+batchChunkSize, len(pending))]
+		err := s.insertChunk(ctx, users, chunk, errs, start/batchChunkSize, ordered)
+		if err != nil && ordered {
+			for _, i := range pending[start+len(chunk):] {
+				errs[i] = ErrBatchSkipped
+			}
+			break
+		}
+	}
+
+	var created int64
+	for i, err := range errs {
+		if err == nil {
+			created++
+			s.audit.Write(ctx, users[i].ID, "create", nil, &users[i])
+			s.Notify(ctx, EventUserCreated, users[i])
+		}
+	}
+
+	s.metrics.UsersCreated.Add(ctx, created)
+	span.SetAttributes(attribute.Int64("batch.created", created))
+	return errs
+}
+
+// checkNewUser applies the checks of Create, with the addresses already in
+// use looked up once for the whole batch
+func (s *UserService) checkNewUser(ctx context.Context, user storage.User, taken map[string]bool) error {
+	if err := validateUser(user); err != nil {
+		trace.SpanFromContext(ctx).AddEvent("user.invalid", trace.WithAttributes(attribute.String("error.message", err.Error())))
+		return err
+	}
+	if taken[strings.ToLower(user.Email)] {
+		trace.SpanFromContext(ctx).AddEvent("user.email_taken")
+		return ErrEmailTaken
+	}
+	return s.ensureDeliverable(ctx, user.Email)
+}
+
+// takenEmails returns the lowercased addresses of the batch that existing
+// users already have. Duplicates within the batch are left to the unique
+// index.
+func (s *UserService) takenEmails(ctx context.Context, users []storage.User) (map[string]bool, error) {
+	emails := make([]string, 0, len(users))
+	for _, user := range users {
+		if user.Email != "" {
+			emails = append(emails, user.Email)
+		}
+	}
+	if len(emails) == 0 {
+		return nil, nil
+	}
+
+	existing, _, err := s.repo.List(ctx, storage.UserQuery{
+		Filter:         storage.UserFilter{Emails: emails},
+		Limit:          int64(len(emails)),
+		IncludeDeleted: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make(map[string]bool, len(existing))
+	for _, user := range existing {
+		taken[strings.ToLower(user.Email)] = true
+	}
+	return taken, nil
+}
+
+// insertChunk creates the users at the given indexes in its own span and
+// records the outcome of each in errs. The returned error is non-nil if
+// any of them was not created.
+func (s *UserService) insertChunk(ctx context.Context, users []storage.User, chunk []int, errs []error, n int, ordered bool) error {
+	ctx, span := s.tracer.Start(ctx, "UserService.insertChunk")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("batch.chunk", n),
+		attribute.Int("batch.chunk_size", len(chunk)),
+	)
+
+	batch := make([]storage.User, len(chunk))
+	for j, i := range chunk {
+		batch[j] = users[i]
+	}
+
+	err := s.repo.CreateMany(ctx, batch, ordered)
+	var batchErr *storage.BatchInsertError
+	partial := errors.As(err, &batchErr)
+
+	inserted := 0
+	for j, i := range chunk {
+		// Picks up the ID, timestamps and version the repository set
+		users[i] = batch[j]
+		switch {
+		case err == nil, partial && batchErr.Inserted(j):
+			inserted++
+		case partial && j >= batchErr.Attempted:
+			errs[i] = ErrBatchSkipped
+		case partial:
+			errs[i] = batchErr.Failed[j]
+		default:
+			// Nothing is known to have been written, so the whole chunk failed
+			errs[i] = err
+		}
+	}
+
+	span.SetAttributes(attribute.Int("batch.chunk_inserted", inserted))
+	return err
+}
+
+// GetMany returns the active users with the given IDs in a single query.
+// Unknown and soft-deleted IDs are left out.
+func (s *UserService) GetMany(ctx context.Context, ids []primitive.ObjectID) ([]storage.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.GetMany")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.operation", "get_many"),
+		attribute.Int("batch.size", len(ids)),
+	)
+
+	users, _, err := s.repo.List(ctx, storage.UserQuery{
+		Filter: storage.UserFilter{IDs: ids},
+		Limit:  int64(len(ids)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("batch.found", len(users)))
+	return users, nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// Types of user lifecycle events
+const (
+	EventUserCreated  = "user.created"
+	EventUserUpdated  = "user.updated"
+	EventUserDeleted  = "user.deleted"
+	EventUserRestored = "user.restored"
+)
+
+// UserEvent describes a user change that has been stored. Deleted events
+// carry the user as it was before the delete.
+type UserEvent struct {
+	ID         string       `json:"id"`
+	Type       string       `json:"type"`
+	OccurredAt time.Time    `json:"occurredAt"`
+	User       storage.User `json:"user"`
+	// Tenant the change was made for; empty when tenancy is off
+	TenantID string `json:"tenantId,omitempty"`
+}
+
+// EventPublisher is told about every stored user change. Publish must not
+// wait for delivery; ctx is the request's and ends with it.
+type EventPublisher interface {
+	Publish(ctx context.Context, event UserEvent)
+}
+
+// Notify publishes an event for user. The service calls it for its own
+// changes; handlers that write in bulk call it themselves.
+func (s *UserService) Notify(ctx context.Context, eventType string, user storage.User) {
+	if s.events == nil {
+		return
+	}
+	s.events.Publish(ctx, UserEvent{
+		ID:         primitive.NewObjectID().Hex(),
+		Type:       eventType,
+		OccurredAt: storage.Now(),
+		User:       user,
+		TenantID:   telemetry.TenantFromContext(ctx),
+	})
+}
+
+// MultiPublisher hands every event to each of its publishers
+type MultiPublisher []EventPublisher
+
+func (m MultiPublisher) Publish(ctx context.Context, event UserEvent) {
+	for _, publisher := range m {
+		publisher.Publish(ctx, event)
+	}
+}
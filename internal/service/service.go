@@ -0,0 +1,408 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// ErrEmailTaken is returned when another user already has the email address
+var ErrEmailTaken = errors.New("email is already in use")
+
+// ValidationError is returned for input the service refuses to store
+type ValidationError struct {
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Message
+}
+
+// AuditLog records user mutations. Writes are best-effort and never fail
+// the change being audited.
+type AuditLog interface {
+	Write(ctx context.Context, userID primitive.ObjectID, operation string, oldValue, newValue *storage.User)
+}
+
+// Transactor runs fn in a transaction that repository calls made with the
+// context passed to fn join. fn may run more than once.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// EmailVerifier reports whether an address can receive mail
+type EmailVerifier interface {
+	Verify(ctx context.Context, email string) (bool, error)
+}
+
+// UserService holds the user business rules: validation, email uniqueness
+// and the audit and metric events emitted for each change. Handlers only
+// translate between HTTP and these methods.
+type UserService struct {
+	repo         storage.UserRepository
+	audit        AuditLog
+	transactions Transactor
+	tracer       telemetry.Tracer
+	metrics      *telemetry.Metrics
+
+	// Optional, nil skips the deliverability check
+	verifier EmailVerifier
+	// Optional, nil publishes no events
+	events EventPublisher
+}
+
+// UserChange is one entry of a batch update
+type UserChange struct {
+	ID     primitive.ObjectID
+	Update storage.UserUpdate
+}
+
+func NewUserService(repo storage.UserRepository, audit AuditLog, transactions Transactor, tracer telemetry.Tracer, metrics *telemetry.Metrics, verifier EmailVerifier, events EventPublisher) *UserService {
+	return &UserService{
+		repo:         repo,
+		audit:        audit,
+		transactions: transactions,
+		tracer:       tracer,
+		metrics:      metrics,
+		verifier:     verifier,
+		events:       events,
+	}
+}
+
+func (s *UserService) Create(ctx context.Context, user *storage.User) error {
+	ctx, span := s.tracer.Start(ctx, "UserService.Create")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.operation", "create"))
+
+	if err := validateUser(*user); err != nil {
+		span.AddEvent("user.invalid", trace.WithAttributes(attribute.String("error.message", err.Error())))
+		return err
+	}
+	if err := s.ensureEmailAvailable(ctx, user.Email, primitive.NilObjectID); err != nil {
+		return err
+	}
+	if err := s.ensureDeliverable(ctx, user.Email); err != nil {
+		return err
+	}
+
+	// New users always start out active
+	user.DeletedAt = nil
+
+	if err := s.repo.Create(ctx, user); err != nil {
+		return err
+	}
+
+	span.SetAttributes(attribute.String("user.id", user.ID.Hex()))
+	span.AddEvent("user.created")
+	s.audit.Write(ctx, user.ID, "create", nil, user)
+	s.metrics.UsersCreated.Add(ctx, 1)
+	s.Notify(ctx, EventUserCreated, *user)
+	return nil
+}
+
+// Get returns a user. Soft-deleted users are only found with includeDeleted.
+func (s *UserService) Get(ctx context.Context, id primitive.ObjectID, includeDeleted bool) (storage.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Get")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.operation", "get"),
+		attribute.String("user.id", id.Hex()),
+	)
+	return s.repo.GetByID(ctx, id, includeDeleted)
+}
+
+func (s *UserService) List(ctx context.Context, query storage.UserQuery) ([]storage.User, int64, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.List")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.operation", "list"))
+
+	users, total, err := s.repo.List(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	span.SetAttributes(attribute.Int64("page.total", total))
+	return users, total, nil
+}
+
+// Export calls fn with every active user, one at a time, and stops at the
+// first error fn returns
+func (s *UserService) Export(ctx context.Context, fn func(storage.User) error) error {
+	ctx, span := s.tracer.Start(ctx, "UserService.Export")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.operation", "export"))
+	return s.repo.Each(ctx, fn)
+}
+
+// Watch opens the feed of user changes, resuming after the given token
+// unless it is empty
+func (s *UserService) Watch(ctx context.Context, resumeAfter string) (storage.ChangeStream, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Watch")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.operation", "watch"))
+	return s.repo.Watch(ctx, resumeAfter)
+}
+
+// Update applies the provided fields and returns the updated user
+func (s *UserService) Update(ctx context.Context, id primitive.ObjectID, update storage.UserUpdate) (storage.User, error) {
+	before, after, err := s.update(ctx, id, update)
+	if err != nil {
+		return storage.User{}, err
+	}
+
+	s.audit.Write(ctx, id, "update", &before, &after)
+	s.Notify(ctx, EventUserUpdated, after)
+	return after, nil
+}
+
+// update is Update without the audit entry and event, so batches can write
+// them once their transaction has committed
+func (s *UserService) update(ctx context.Context, id primitive.ObjectID, update storage.UserUpdate) (before, after storage.User, err error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Update")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.operation", "update"),
+		attribute.String("user.id", id.Hex()),
+	)
+
+	if _, err := update.SetDocument(); err != nil {
+		span.AddEvent("user.invalid", trace.WithAttributes(attribute.String("error.message", err.Error())))
+		return storage.User{}, storage.User{}, ValidationError{Message: err.Error()}
+	}
+	if update.Email.Present() {
+		if err := s.ensureEmailAvailable(ctx, update.Email.Value, id); err != nil {
+			return storage.User{}, storage.User{}, err
+		}
+		if err := s.ensureDeliverable(ctx, update.Email.Value); err != nil {
+			return storage.User{}, storage.User{}, err
+		}
+	}
+
+	before, after, err = s.repo.Update(ctx, id, update)
+	if err != nil {
+		return storage.User{}, storage.User{}, err
+	}
+
+	span.AddEvent("user.updated")
+	return before, after, nil
+}
+
+// UpdateMany applies every change in a single transaction, so either all
+// users are updated or none are. Audit entries and events follow the
+// commit, so neither can abort the batch nor describe a rolled back change.
+// Errors name the index of the change that failed.
+func (s *UserService) UpdateMany(ctx context.Context, changes []UserChange) ([]storage.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.UpdateMany")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.operation", "update_many"),
+		attribute.Int("batch.size", len(changes)),
+	)
+
+	var before, updated []storage.User
+	err := s.transactions.WithTransaction(ctx, func(ctx context.Context) error {
+		// The transaction may be retried, so start from scratch every time
+		before = make([]storage.User, 0, len(changes))
+		updated = make([]storage.User, 0, len(changes))
+		for i, change := range changes {
+			old, after, err := s.update(ctx, change.ID, change.Update)
+			var invalid ValidationError
+			if errors.As(err, &invalid) {
+				return ValidationError{Message: fmt.Sprintf("updates[%d]: %s", i, invalid.Message)}
+			}
+			if err != nil {
+				span.SetAttributes(attribute.Int("batch.failed_index", i))
+				return fmt.Errorf("updates[%d]: %w", i, err)
+			}
+			before = append(before, old)
+			updated = append(updated, after)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	span.AddEvent("users.updated")
+	for i := range updated {
+		s.audit.Write(ctx, updated[i].ID, "update", &before[i], &updated[i])
+		s.Notify(ctx, EventUserUpdated, updated[i])
+	}
+	return updated, nil
+}
+
+func (s *UserService) Delete(ctx context.Context, id primitive.ObjectID) error {
+	ctx, span := s.tracer.Start(ctx, "UserService.Delete")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.operation", "delete"),
+		attribute.String("user.id", id.Hex()),
+	)
+
+	deleted, err := s.repo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	span.AddEvent("user.deleted")
+	s.audit.Write(ctx, id, "delete", &deleted, nil)
+	s.metrics.UsersDeleted.Add(ctx, 1)
+	s.Notify(ctx, EventUserDeleted, deleted)
+	return nil
+}
+
+// DeleteMany soft-deletes every active user matching filter, auditing and
+// notifying each one like a single delete as its batch is deleted, and
+// returns how many it deleted
+func (s *UserService) DeleteMany(ctx context.Context, filter storage.UserFilter) (int64, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.DeleteMany")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.operation", "delete_many"))
+
+	count, err := s.repo.DeleteMany(ctx, filter, func(deleted []storage.User) {
+		for i := range deleted {
+			s.audit.Write(ctx, deleted[i].ID, "delete", &deleted[i], nil)
+			s.Notify(ctx, EventUserDeleted, deleted[i])
+		}
+		s.metrics.UsersDeleted.Add(ctx, int64(len(deleted)))
+	})
+	if err != nil {
+		return count, err
+	}
+
+	span.AddEvent("users.deleted")
+	return count, nil
+}
+
+// Tenants lists the tenants that may have users, "" standing for the users
+// that belong to none
+func (s *UserService) Tenants(ctx context.Context) ([]string, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Tenants")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.operation", "tenants"))
+	return s.repo.Tenants(ctx)
+}
+
+// Purge permanently removes the tenant's users that were soft-deleted
+// before deletedBefore. They can no longer be restored afterwards.
+func (s *UserService) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Purge")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.operation", "purge"),
+		attribute.String("purge.cutoff", deletedBefore.Format(time.RFC3339)),
+	)
+
+	count, err := s.repo.Purge(ctx, deletedBefore)
+	if err != nil {
+		return count, err
+	}
+
+	span.AddEvent("users.purged", trace.WithAttributes(attribute.Int64("users.count", count)))
+	return count, nil
+}
+
+// Count returns how many of the tenant's users are active and deleted
+func (s *UserService) Count(ctx context.Context) (storage.UserCounts, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Count")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.operation", "count"))
+	return s.repo.Count(ctx)
+}
+
+// Restore brings back a soft-deleted user
+func (s *UserService) Restore(ctx context.Context, id primitive.ObjectID) (storage.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Restore")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.operation", "restore"),
+		attribute.String("user.id", id.Hex()),
+	)
+
+	restored, err := s.repo.Restore(ctx, id)
+	if err != nil {
+		return storage.User{}, err
+	}
+
+	span.AddEvent("user.restored")
+	s.audit.Write(ctx, id, "restore", nil, &restored)
+	s.Notify(ctx, EventUserRestored, restored)
+	return restored, nil
+}
+
+// ensureEmailAvailable fails with ErrEmailTaken if a user other than self
+// already has the address. Matching uses the case-insensitive user collation.
+// Soft-deleted users keep their address so they can be restored.
+func (s *UserService) ensureEmailAvailable(ctx context.Context, email string, self primitive.ObjectID) error {
+	_, total, err := s.repo.List(ctx, storage.UserQuery{
+		Filter:         storage.UserFilter{Emails: []string{email}, ExcludeID: self},
+		Limit:          1,
+		IncludeDeleted: true,
+	})
+	if err != nil {
+		return err
+	}
+	if total > 0 {
+		trace.SpanFromContext(ctx).AddEvent("user.email_taken")
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// ensureDeliverable rejects addresses the email verification service says
+// cannot receive mail. The check is advisory, so an unreachable service
+// does not block the change.
+func (s *UserService) ensureDeliverable(ctx context.Context, email string) error {
+	if s.verifier == nil {
+		return nil
+	}
+
+	deliverable, err := s.verifier.Verify(ctx, email)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Email verification unavailable, skipping")
+		trace.SpanFromContext(ctx).AddEvent("user.email_unverified", trace.WithAttributes(attribute.String("error.message", err.Error())))
+		return nil
+	}
+	if !deliverable {
+		trace.SpanFromContext(ctx).AddEvent("user.email_undeliverable")
+		return ValidationError{Message: "email is not deliverable"}
+	}
+	return nil
+}
+
+// validateUser checks a user before it is created
+func validateUser(user storage.User) error {
+	if user.Name == "" {
+		return ValidationError{Message: "name must not be empty"}
+	}
+	if user.Email == "" {
+		return ValidationError{Message: "email must not be empty"}
+	}
+	if _, err := mail.ParseAddress(user.Email); err != nil {
+		return ValidationError{Message: "email is not a valid address"}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.uber.org/mock/gomock"
+
+	"tracer/internal/storage"
+	"tracer/internal/storage/storagemock"
+	"tracer/internal/telemetry"
+)
+
+// auditRecorder keeps the audit entries in memory
+type auditRecorder struct {
+	mu      sync.Mutex
+	entries []storage.AuditEntry
+}
+
+func (a *auditRecorder) Write(_ context.Context, userID primitive.ObjectID, operation string, oldValue, newValue *storage.User) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, storage.AuditEntry{UserID: userID, Operation: operation, OldValue: oldValue, NewValue: newValue})
+}
+
+// eventRecorder keeps the published events in memory
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []UserEvent
+}
+
+func (e *eventRecorder) Publish(_ context.Context, event UserEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+func newTestService(t *testing.T) (*UserService, *storagemock.MockUserRepository, *auditRecorder, *eventRecorder) {
+	t.Helper()
+	metrics, err := telemetry.NewMetrics(noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+
+	repo := storagemock.NewMockUserRepository(gomock.NewController(t))
+	audit := &auditRecorder{}
+	events := &eventRecorder{}
+	return NewUserService(repo, audit, nil, telemetry.NewTracer(), metrics, nil, events), repo, audit, events
+}
+
+func TestUpdateWritesAuditEntry(t *testing.T) {
+	s, repo, audit, _ := newTestService(t)
+	id := primitive.NewObjectID()
+	before := storage.User{ID: id, Name: "Alice", Email: "alice@example.com", Version: 1}
+	after := storage.User{ID: id, Name: "Alicia", Email: "alice@example.com", Version: 2}
+	update := storage.UserUpdate{Name: storage.Some("Alicia")}
+	repo.EXPECT().Update(gomock.Any(), id, update).Return(before, after, nil)
+
+	if _, err := s.Update(context.Background(), id, update); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if len(audit.entries) != 1 {
+		t.Fatalf("audit entries = %d, want 1", len(audit.entries))
+	}
+	entry := audit.entries[0]
+	if entry.Operation != "update" || entry.UserID != id {
+		t.Errorf("audit entry = %s %s, want update %s", entry.Operation, entry.UserID.Hex(), id.Hex())
+	}
+	if entry.OldValue == nil || entry.OldValue.Name != "Alice" || entry.NewValue == nil || entry.NewValue.Name != "Alicia" {
+		t.Errorf("audit values = %+v -> %+v, want Alice -> Alicia", entry.OldValue, entry.NewValue)
+	}
+}
+
+func TestDeleteManyAuditsAndPublishesEachUser(t *testing.T) {
+	s, repo, audit, events := newTestService(t)
+	filter := storage.UserFilter{Emails: []string{"shared@example.com"}}
+	deleted := []storage.User{
+		{ID: primitive.NewObjectID(), Name: "Alice"},
+		{ID: primitive.NewObjectID(), Name: "Bob"},
+	}
+	// Two batches, as a large match would be deleted in
+	repo.EXPECT().DeleteMany(gomock.Any(), filter, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ storage.UserFilter, fn func([]storage.User)) (int64, error) {
+			fn(deleted[:1])
+			fn(deleted[1:])
+			return int64(len(deleted)), nil
+		})
+
+	count, err := s.DeleteMany(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("DeleteMany() error = %v", err)
+	}
+	if count != int64(len(deleted)) {
+		t.Errorf("DeleteMany() = %d, want %d", count, len(deleted))
+	}
+
+	if len(audit.entries) != len(deleted) {
+		t.Fatalf("audit entries = %d, want %d", len(audit.entries), len(deleted))
+	}
+	for i, entry := range audit.entries {
+		if entry.Operation != "delete" || entry.UserID != deleted[i].ID || entry.OldValue == nil || entry.OldValue.Name != deleted[i].Name || entry.NewValue != nil {
+			t.Errorf("audit entry %d = %+v, want delete of %s", i, entry, deleted[i].Name)
+		}
+	}
+	if len(events.events) != len(deleted) {
+		t.Fatalf("events = %d, want %d", len(events.events), len(deleted))
+	}
+	for i, event := range events.events {
+		if event.Type != EventUserDeleted || event.User.ID != deleted[i].ID {
+			t.Errorf("event %d = %s %s, want %s %s", i, event.Type, event.User.ID.Hex(), EventUserDeleted, deleted[i].ID.Hex())
+		}
+	}
+}
+
+// fakeTransactor runs fn once and then fails the commit with err
+type fakeTransactor struct {
+	err error
+}
+
+func (f fakeTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	return f.err
+}
+
+func TestUpdateManyAuditsOnlyAfterCommit(t *testing.T) {
+	tests := []struct {
+		name      string
+		commitErr error
+		wantAudit int
+	}{
+		{name: "committed", wantAudit: 2},
+		{name: "commit failed", commitErr: errors.New("write conflict")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo, audit, events := newTestService(t)
+			s.transactions = fakeTransactor{err: tt.commitErr}
+
+			changes := []UserChange{
+				{ID: primitive.NewObjectID(), Update: storage.UserUpdate{Name: storage.Some("Alice")}},
+				{ID: primitive.NewObjectID(), Update: storage.UserUpdate{Name: storage.Some("Bob")}},
+			}
+			for _, change := range changes {
+				repo.EXPECT().Update(gomock.Any(), change.ID, change.Update).
+					Return(storage.User{ID: change.ID}, storage.User{ID: change.ID, Name: change.Update.Name.Value}, nil)
+			}
+
+			_, err := s.UpdateMany(context.Background(), changes)
+			if !errors.Is(err, tt.commitErr) {
+				t.Fatalf("UpdateMany() error = %v, want %v", err, tt.commitErr)
+			}
+			if len(audit.entries) != tt.wantAudit {
+				t.Errorf("audit entries = %d, want %d", len(audit.entries), tt.wantAudit)
+			}
+			if len(events.events) != tt.wantAudit {
+				t.Errorf("events = %d, want %d", len(events.events), tt.wantAudit)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"tracer/internal/telemetry"
+)
+
+// APIKey is a credential issued to a machine client. Only the SHA-256 hash of
+// the key is stored.
+type APIKey struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name      string             `bson:"name" json:"name"`
+	Owner     string             `bson:"owner,omitempty" json:"owner,omitempty"`
+	KeyHash   string             `bson:"keyHash" json:"-"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	RevokedAt *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// HashAPIKey returns the value stored in keyHash for a raw key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyStore looks up API keys kept in MongoDB
+type APIKeyStore struct {
+	collection       *mongo.Collection
+	tracer           telemetry.Tracer
+	operationTimeout time.Duration
+}
+
+func NewAPIKeyStore(collection *mongo.Collection, tracer telemetry.Tracer, operationTimeout time.Duration) *APIKeyStore {
+	return &APIKeyStore{
+		collection:       collection,
+		tracer:           tracer,
+		operationTimeout: operationTimeout,
+	}
+}
+
+// Lookup returns the active key matching the raw key, or ErrNotFound if it
+// is unknown or revoked
+func (s *APIKeyStore) Lookup(ctx context.Context, key string) (APIKey, error) {
+	ctx, span := s.tracer.Start(ctx, "APIKeyStore.Lookup")
+	defer span.End()
+
+	opCtx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+
+	var found APIKey
+	filter := bson.M{"keyHash": HashAPIKey(key), "revokedAt": bson.M{"$exists": false}}
+	if err := s.collection.FindOne(opCtx, filter).Decode(&found); err != nil {
+		RecordTimeout(ctx, span, err)
+		return APIKey{}, notFound(err)
+	}
+
+	span.SetAttributes(attribute.String("apikey.id", found.ID.Hex()))
+	return found, nil
+}
+
+// EnsureAPIKeyIndexes creates the unique index keys are looked up by
+func EnsureAPIKeyIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "keyHash", Value: 1}},
+		Options: options.Index().SetName("api_keys_hash_unique").SetUnique(true),
+	})
+	return err
+}
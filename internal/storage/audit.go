@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/telemetry"
+)
+
+type AuditEntry struct {
+	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID     `bson:"userId" json:"userId"`
+	Operation string                 `bson:"operation" json:"operation"`
+	Actor     string                 `bson:"actor,omitempty" json:"actor,omitempty"`
+	OldValue  *User                  `bson:"oldValue,omitempty" json:"oldValue,omitempty"`
+	NewValue  *User                  `bson:"newValue,omitempty" json:"newValue,omitempty"`
+	Changes   map[string]FieldChange `bson:"changes,omitempty" json:"changes,omitempty"`
+	TraceID   string                 `bson:"traceId,omitempty" json:"traceId,omitempty"`
+	TenantID  string                 `bson:"tenantId,omitempty" json:"-"`
+	Timestamp time.Time              `bson:"timestamp" json:"timestamp"`
+}
+
+// FieldChange is one field that differs between the old and new value
+type FieldChange struct {
+	From any `bson:"from" json:"from"`
+	To   any `bson:"to" json:"to"`
+}
+
+type actorKey struct{}
+
+// WithActor records who is making the request, so audit entries written
+// further down the call chain can name them
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// diffUsers lists the user fields that differ between oldValue and newValue.
+// A nil side counts as every field being unset.
+func diffUsers(oldValue, newValue *User) map[string]FieldChange {
+	fields := func(u *User) map[string]any {
+		if u == nil {
+			return map[string]any{}
+		}
+		values := map[string]any{"name": u.Name, "email": u.Email}
+		if u.DeletedAt != nil {
+			values["deletedAt"] = *u.DeletedAt
+		}
+		return values
+	}
+
+	from, to := fields(oldValue), fields(newValue)
+	changes := map[string]FieldChange{}
+	for _, key := range []string{"name", "email", "deletedAt"} {
+		if from[key] != to[key] {
+			changes[key] = FieldChange{From: from[key], To: to[key]}
+		}
+	}
+	return changes
+}
+
+// AuditLog stores the history of user mutations
+type AuditLog struct {
+	collection       *mongo.Collection
+	tracer           telemetry.Tracer
+	operationTimeout time.Duration
+	tenancy          *Tenancy
+}
+
+func NewAuditLog(collection *mongo.Collection, tracer telemetry.Tracer, operationTimeout time.Duration, tenancy *Tenancy) *AuditLog {
+	return &AuditLog{
+		collection:       collection,
+		tracer:           tracer,
+		operationTimeout: operationTimeout,
+		tenancy:          tenancy,
+	}
+}
+
+// Write records a user mutation. It is best-effort: a failed write is
+// logged but never fails the operation being audited.
+func (a *AuditLog) Write(ctx context.Context, userID primitive.ObjectID, operation string, oldValue, newValue *User) {
+	ctx, span := a.tracer.Start(ctx, "writeAudit")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", userID.Hex()),
+		attribute.String("audit.operation", operation),
+		attribute.String("audit.actor", actorFromContext(ctx)),
+	)
+
+	entry := AuditEntry{
+		UserID:    userID,
+		Operation: operation,
+		Actor:     actorFromContext(ctx),
+		OldValue:  oldValue,
+		NewValue:  newValue,
+		Changes:   diffUsers(oldValue, newValue),
+		Timestamp: Now(),
+		TenantID:  a.tenancy.DocumentTenant(ctx),
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		entry.TraceID = sc.TraceID().String()
+	}
+
+	collection, err := a.tenancy.Collection(ctx, a.collection)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("userId", userID.Hex()).Msg("Failed to prepare tenant audit log")
+		return
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, a.operationTimeout)
+	defer cancel()
+
+	if _, err := collection.InsertOne(opCtx, entry); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("userId", userID.Hex()).Str("operation", operation).Msg("Failed to write audit entry")
+	}
+}
+
+// History returns a page of the entries recorded for a user, oldest first,
+// along with the total number of entries
+func (a *AuditLog) History(ctx context.Context, userID primitive.ObjectID, limit, offset int64) ([]AuditEntry, int64, error) {
+	ctx, span := a.tracer.Start(ctx, "AuditLog.History")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", userID.Hex()))
+
+	collection, err := a.tenancy.Collection(ctx, a.collection)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, a.operationTimeout)
+	defer cancel()
+
+	filter := a.tenancy.Filter(ctx, bson.M{"userId": userID})
+	total, err := collection.CountDocuments(opCtx, filter)
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return nil, 0, err
+	}
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(opCtx, filter, findOpts)
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return nil, 0, err
+	}
+
+	var entries []AuditEntry
+	if err := cursor.All(opCtx, &entries); err != nil {
+		RecordTimeout(ctx, span, err)
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
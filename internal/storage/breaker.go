@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sony/gobreaker"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/telemetry"
+)
+
+// ErrCircuitOpen is returned without contacting MongoDB while the circuit
+// breaker is open, or half-open with its trial requests in flight
+var ErrCircuitOpen = errors.New("mongodb circuit breaker is open")
+
+// BreakerUserRepository fails fast once MongoDB keeps failing, instead of
+// letting every request wait out its own timeout. Only errors that point at
+// an unhealthy server count as failures; not found, duplicate keys and
+// cancelled requests don't.
+type BreakerUserRepository struct {
+	repo    UserRepository
+	breaker *gobreaker.CircuitBreaker
+}
+
+// NewBreakerUserRepository opens the breaker after threshold consecutive
+// failures and lets halfOpenRequests trial requests through after timeout
+func NewBreakerUserRepository(repo UserRepository, threshold, halfOpenRequests uint32, timeout time.Duration, metrics *telemetry.Metrics) *BreakerUserRepository {
+	settings := gobreaker.Settings{
+		Name:        "mongodb",
+		MaxRequests: halfOpenRequests,
+		Timeout:     timeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= threshold
+		},
+		IsSuccessful: func(err error) bool {
+			return err == nil || !isServerFailure(err)
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			log.Warn().Str("breaker", name).Str("from", from.String()).Str("to", to.String()).Msg("Circuit breaker state changed")
+			metrics.BreakerStateChanges.Add(context.Background(), 1, metric.WithAttributes(
+				attribute.String("breaker.name", name),
+				attribute.String("breaker.state", to.String()),
+			))
+		},
+	}
+
+	return &BreakerUserRepository{
+		repo:    repo,
+		breaker: gobreaker.NewCircuitBreaker(settings),
+	}
+}
+
+// isServerFailure reports whether err means MongoDB itself is in trouble
+func isServerFailure(err error) bool {
+	return mongo.IsNetworkError(err) ||
+		mongo.IsTimeout(err) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, mongo.ErrClientDisconnected)
+}
+
+// guarded runs op through the breaker. Rejections and state changes caused
+// by the call are added to the current span as events.
+func guarded[T any](ctx context.Context, r *BreakerUserRepository, op string, fn func() (T, error)) (T, error) {
+	span := trace.SpanFromContext(ctx)
+	before := r.breaker.State()
+
+	result, err := r.breaker.Execute(func() (any, error) {
+		return fn()
+	})
+
+	if after := r.breaker.State(); after != before {
+		span.AddEvent("circuit_breaker.state_change", trace.WithAttributes(
+			attribute.String("breaker.from", before.String()),
+			attribute.String("breaker.to", after.String()),
+		))
+	}
+
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		span.AddEvent("circuit_breaker.rejected", trace.WithAttributes(
+			attribute.String("breaker.state", r.breaker.State().String()),
+			attribute.String("db.operation", op),
+		))
+		var zero T
+		return zero, fmt.Errorf("%s: %w", op, ErrCircuitOpen)
+	}
+
+	value, _ := result.(T)
+	return value, err
+}
+
+func (r *BreakerUserRepository) Create(ctx context.Context, user *User) error {
+	_, err := guarded(ctx, r, "create", func() (struct{}, error) {
+		return struct{}{}, r.repo.Create(ctx, user)
+	})
+	return err
+}
+
+func (r *BreakerUserRepository) CreateMany(ctx context.Context, users []User, ordered bool) error {
+	_, err := guarded(ctx, r, "create_many", func() (struct{}, error) {
+		return struct{}{}, r.repo.CreateMany(ctx, users, ordered)
+	})
+	return err
+}
+
+func (r *BreakerUserRepository) GetByID(ctx context.Context, id primitive.ObjectID, includeDeleted bool) (User, error) {
+	return guarded(ctx, r, "get", func() (User, error) {
+		return r.repo.GetByID(ctx, id, includeDeleted)
+	})
+}
+
+func (r *BreakerUserRepository) Update(ctx context.Context, id primitive.ObjectID, update UserUpdate) (User, User, error) {
+	result, err := guarded(ctx, r, "update", func() ([2]User, error) {
+		before, after, err := r.repo.Update(ctx, id, update)
+		return [2]User{before, after}, err
+	})
+	return result[0], result[1], err
+}
+
+func (r *BreakerUserRepository) Delete(ctx context.Context, id primitive.ObjectID) (User, error) {
+	return guarded(ctx, r, "delete", func() (User, error) {
+		return r.repo.Delete(ctx, id)
+	})
+}
+
+func (r *BreakerUserRepository) Restore(ctx context.Context, id primitive.ObjectID) (User, error) {
+	return guarded(ctx, r, "restore", func() (User, error) {
+		return r.repo.Restore(ctx, id)
+	})
+}
+
+func (r *BreakerUserRepository) DeleteMany(ctx context.Context, filter UserFilter, deleted func([]User)) (int64, error) {
+	return guarded(ctx, r, "delete_many", func() (int64, error) {
+		return r.repo.DeleteMany(ctx, filter, deleted)
+	})
+}
+
+func (r *BreakerUserRepository) List(ctx context.Context, query UserQuery) ([]User, int64, error) {
+	type page struct {
+		users []User
+		total int64
+	}
+	result, err := guarded(ctx, r, "list", func() (page, error) {
+		users, total, err := r.repo.List(ctx, query)
+		return page{users, total}, err
+	})
+	return result.users, result.total, err
+}
+
+// Each counts as one call however long it runs. Errors from fn, such as a
+// client going away mid-export, are not server failures.
+func (r *BreakerUserRepository) Each(ctx context.Context, fn func(User) error) error {
+	_, err := guarded(ctx, r, "each", func() (struct{}, error) {
+		return struct{}{}, r.repo.Each(ctx, fn)
+	})
+	return err
+}
+
+func (r *BreakerUserRepository) Watch(ctx context.Context, resumeAfter string) (ChangeStream, error) {
+	return guarded(ctx, r, "watch", func() (ChangeStream, error) {
+		return r.repo.Watch(ctx, resumeAfter)
+	})
+}
+
+func (r *BreakerUserRepository) Tenants(ctx context.Context) ([]string, error) {
+	return guarded(ctx, r, "tenants", func() ([]string, error) {
+		return r.repo.Tenants(ctx)
+	})
+}
+
+func (r *BreakerUserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	return guarded(ctx, r, "purge", func() (int64, error) {
+		return r.repo.Purge(ctx, deletedBefore)
+	})
+}
+
+func (r *BreakerUserRepository) Count(ctx context.Context) (UserCounts, error) {
+	return guarded(ctx, r, "count", func() (UserCounts, error) {
+		return r.repo.Count(ctx)
+	})
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/telemetry"
+)
+
+// UserCache keeps active users in Redis, keyed by ID. Redis failures are
+// logged and treated as misses so the cache can never fail a request.
+type UserCache struct {
+	client  redis.UniversalClient
+	ttl     time.Duration
+	metrics *telemetry.Metrics
+}
+
+func NewUserCache(client redis.UniversalClient, ttl time.Duration, metrics *telemetry.Metrics) *UserCache {
+	return &UserCache{
+		client:  client,
+		ttl:     ttl,
+		metrics: metrics,
+	}
+}
+
+// userCacheKey includes the tenant so one tenant never reads another's entry
+func userCacheKey(ctx context.Context, id primitive.ObjectID) string {
+	if tenant := telemetry.TenantFromContext(ctx); tenant != "" {
+		return "user:" + tenant + ":" + id.Hex()
+	}
+	return "user:" + id.Hex()
+}
+
+// Get returns the cached user and whether it was found, recording the
+// outcome on the current span and in the cache.requests metric
+func (c *UserCache) Get(ctx context.Context, id primitive.ObjectID) (User, bool) {
+	var user User
+	hit := false
+
+	data, err := c.client.Get(ctx, userCacheKey(ctx, id)).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+	case err != nil:
+		log.Ctx(ctx).Warn().Err(err).Str("userId", id.Hex()).Msg("Failed to read user from cache")
+	default:
+		if err := json.Unmarshal(data, &user); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("userId", id.Hex()).Msg("Discarding undecodable cached user")
+			break
+		}
+		hit = true
+	}
+
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.hit", hit))
+	c.metrics.CacheRequests.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.result", result)))
+	return user, hit
+}
+
+// Set stores an active user for the cache TTL
+func (c *UserCache) Set(ctx context.Context, user User) {
+	data, err := json.Marshal(user)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("userId", user.ID.Hex()).Msg("Failed to encode user for cache")
+		return
+	}
+	if err := c.client.Set(ctx, userCacheKey(ctx, user.ID), data, c.ttl).Err(); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("userId", user.ID.Hex()).Msg("Failed to write user to cache")
+	}
+}
+
+// Invalidate evicts the given users. It is safe to call on a nil cache.
+func (c *UserCache) Invalidate(ctx context.Context, ids ...primitive.ObjectID) {
+	if c == nil || len(ids) == 0 {
+		return
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = userCacheKey(ctx, id)
+	}
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		// Stale entries expire with the TTL at the latest
+		log.Ctx(ctx).Warn().Err(err).Int("count", len(ids)).Msg("Failed to invalidate cached users")
+	}
+}
+
+// CachedUserRepository is a read-through cache in front of another
+// repository. Only GetByID for active users is served from the cache; every
+// write evicts the user it touched, once its transaction, if any, commits.
+type CachedUserRepository struct {
+	UserRepository
+	cache *UserCache
+}
+
+func NewCachedUserRepository(repo UserRepository, cache *UserCache) *CachedUserRepository {
+	return &CachedUserRepository{UserRepository: repo, cache: cache}
+}
+
+func (r *CachedUserRepository) GetByID(ctx context.Context, id primitive.ObjectID, includeDeleted bool) (User, error) {
+	// Soft-deleted users are never cached, so these reads go to MongoDB
+	if includeDeleted {
+		return r.UserRepository.GetByID(ctx, id, includeDeleted)
+	}
+
+	if user, ok := r.cache.Get(ctx, id); ok {
+		return user, nil
+	}
+
+	user, err := r.UserRepository.GetByID(ctx, id, includeDeleted)
+	if err != nil {
+		return User{}, err
+	}
+	r.cache.Set(ctx, user)
+	return user, nil
+}
+
+func (r *CachedUserRepository) Update(ctx context.Context, id primitive.ObjectID, update UserUpdate) (User, User, error) {
+	before, after, err := r.UserRepository.Update(ctx, id, update)
+	// Inside a transaction, evicting before the commit would let a read
+	// cache the old user again
+	AfterCommit(ctx, func(ctx context.Context) {
+		r.cache.Invalidate(ctx, id)
+	})
+	return before, after, err
+}
+
+func (r *CachedUserRepository) Delete(ctx context.Context, id primitive.ObjectID) (User, error) {
+	deleted, err := r.UserRepository.Delete(ctx, id)
+	AfterCommit(ctx, func(ctx context.Context) {
+		r.cache.Invalidate(ctx, id)
+	})
+	return deleted, err
+}
+
+func (r *CachedUserRepository) Restore(ctx context.Context, id primitive.ObjectID) (User, error) {
+	restored, err := r.UserRepository.Restore(ctx, id)
+	AfterCommit(ctx, func(ctx context.Context) {
+		r.cache.Invalidate(ctx, id)
+	})
+	return restored, err
+}
+
+func (r *CachedUserRepository) DeleteMany(ctx context.Context, filter UserFilter, deleted func([]User)) (int64, error) {
+	return r.UserRepository.DeleteMany(ctx, filter, func(batch []User) {
+		ids := make([]primitive.ObjectID, len(batch))
+		for i, user := range batch {
+			ids[i] = user.ID
+		}
+		AfterCommit(ctx, func(ctx context.Context) {
+			r.cache.Invalidate(ctx, ids...)
+		})
+		deleted(batch)
+	})
+}
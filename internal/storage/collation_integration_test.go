@@ -0,0 +1,81 @@
+//go:build integration
+
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go/modules/mongodb"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"tracer/internal/telemetry"
+)
+
+// newMongoCollection starts MongoDB in a container and returns an empty
+// users collection with the service's indexes
+func newMongoCollection(t *testing.T, locale string) *mongo.Collection {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := mongodb.Run(ctx, "mongo:7")
+	if err != nil {
+		t.Fatalf("start MongoDB: %v", err)
+	}
+	t.Cleanup(func() { container.Terminate(context.Background()) })
+
+	uri, err := container.ConnectionString(ctx)
+	if err != nil {
+		t.Fatalf("MongoDB connection string: %v", err)
+	}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to MongoDB: %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	users := client.Database("test").Collection("users")
+	if err := EnsureIndexes(ctx, users, locale, false); err != nil {
+		t.Fatalf("EnsureIndexes() error = %v", err)
+	}
+	return users
+}
+
+func TestListSortsAndMatchesNamesCaseInsensitively(t *testing.T) {
+	repo := NewMongoUserRepository(newMongoCollection(t, "en"), telemetry.NewTracer(), 10*time.Second, "en", RetryPolicy{}, nil)
+	ctx := context.Background()
+
+	for _, name := range []string{"charlie", "Bob", "alice"} {
+		user := &User{Name: name, Email: name + "@example.com"}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create(%s) error = %v", name, err)
+		}
+	}
+
+	users, total, err := repo.List(ctx, UserQuery{
+		Sort:  UserSort{Field: SortByName},
+		Limit: 10,
+	})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if total != 3 || len(users) != 3 {
+		t.Fatalf("List() = %d users of %d, want 3 of 3", len(users), total)
+	}
+	want := []string{"alice", "Bob", "charlie"}
+	for i, user := range users {
+		if user.Name != want[i] {
+			t.Errorf("users[%d] = %q, want %q", i, user.Name, want[i])
+		}
+	}
+
+	matched, _, err := repo.List(ctx, UserQuery{Filter: UserFilter{Name: "BOB"}, Limit: 10})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(matched) != 1 || matched[0].Name != "Bob" {
+		t.Errorf("name BOB matched %v, want Bob", matched)
+	}
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ID identifies a stored user, API key or other document
+type ID = primitive.ObjectID
+
+// NewID returns a fresh ID
+func NewID() ID {
+	return primitive.NewObjectID()
+}
+
+// ParseID reads the hex form clients see IDs in
+func ParseID(hex string) (ID, error) {
+	return primitive.ObjectIDFromHex(hex)
+}
+
+// UserFilter selects users by the fields they can be looked up by. Every
+// field that is set must match; the zero value matches every user. Values
+// are always compared as plain strings, so query operators cannot be
+// smuggled in through them.
+type UserFilter struct {
+	IDs []ID
+	// Leaves out the user with this ID, unless it is zero
+	ExcludeID ID
+	Name      string
+	Emails    []string
+	// Full-text search over names and emails
+	Search string
+}
+
+// document translates the filter into a MongoDB query
+func (f UserFilter) document() bson.M {
+	filter := bson.M{}
+	switch {
+	case len(f.IDs) > 0 && !f.ExcludeID.IsZero():
+		filter["_id"] = bson.M{"$in": f.IDs, "$ne": f.ExcludeID}
+	case len(f.IDs) > 0:
+		filter["_id"] = bson.M{"$in": f.IDs}
+	case !f.ExcludeID.IsZero():
+		filter["_id"] = bson.M{"$ne": f.ExcludeID}
+	}
+	if f.Name != "" {
+		filter["name"] = f.Name
+	}
+	switch len(f.Emails) {
+	case 0:
+	case 1:
+		filter["email"] = f.Emails[0]
+	default:
+		filter["email"] = bson.M{"$in": f.Emails}
+	}
+	if f.Search != "" {
+		filter["$text"] = bson.M{"$search": f.Search}
+	}
+	return filter
+}
+
+// String renders the filter as the query it runs, for span attributes and
+// logs
+func (f UserFilter) String() string {
+	data, err := bson.MarshalExtJSON(f.document(), false, false)
+	if err != nil {
+		return fmt.Sprint(f.document())
+	}
+	return string(data)
+}
+
+// SortField is a user field pages can be ordered by
+type SortField string
+
+const (
+	// SortByID orders users by when they were created, which their IDs embed
+	SortByID    SortField = "_id"
+	SortByName  SortField = "name"
+	SortByEmail SortField = "email"
+)
+
+// UserSort orders users by one field. Users that tie on it are ordered by
+// ascending ID, so they keep a stable order between pages. The zero value
+// sorts by ascending ID.
+type UserSort struct {
+	Field      SortField
+	Descending bool
+}
+
+// field returns the sort field, defaulting to the ID
+func (s UserSort) field() SortField {
+	if s.Field == "" {
+		return SortByID
+	}
+	return s.Field
+}
+
+// document translates the sort into a MongoDB sort spec
+func (s UserSort) document() bson.D {
+	direction := 1
+	if s.Descending {
+		direction = -1
+	}
+
+	field := s.field()
+	if field == SortByID {
+		return bson.D{{Key: string(SortByID), Value: direction}}
+	}
+	return bson.D{{Key: string(field), Value: direction}, {Key: string(SortByID), Value: 1}}
+}
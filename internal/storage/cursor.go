@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Cursor marks where the previous page ended. It is only valid for the sort
+// it was issued with.
+type Cursor struct {
+	Sort  string `json:"s"`
+	ID    ID     `json:"id"`
+	Value string `json:"v,omitempty"`
+}
+
+// CursorAfter builds the cursor pointing past user for the given sort
+func CursorAfter(sortName string, sort UserSort, user User) Cursor {
+	cursor := Cursor{Sort: sortName, ID: user.ID}
+	switch sort.field() {
+	case SortByName:
+		cursor.Value = user.Name
+	case SortByEmail:
+		cursor.Value = user.Email
+	}
+	return cursor
+}
+
+// cursorFilter matches the documents that come after cursor in sort order.
+// Sorts are either _id alone or a field with ascending _id as tiebreaker.
+func cursorFilter(sort UserSort, cursor Cursor) bson.M {
+	after := "$gt"
+	if sort.Descending {
+		after = "$lt"
+	}
+
+	field := string(sort.field())
+	if sort.field() == SortByID {
+		return bson.M{"_id": bson.M{after: cursor.ID}}
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{after: cursor.Value}},
+		bson.M{field: cursor.Value, "_id": bson.M{"$gt": cursor.ID}},
+	}}
+}
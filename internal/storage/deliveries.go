@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+
+	"tracer/internal/telemetry"
+)
+
+// Final states of a webhook delivery
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is the outcome of sending one event to one webhook URL
+type WebhookDelivery struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	EventID     string             `bson:"eventId" json:"eventId"`
+	EventType   string             `bson:"eventType" json:"eventType"`
+	URL         string             `bson:"url" json:"url"`
+	Status      string             `bson:"status" json:"status"`
+	Attempts    int                `bson:"attempts" json:"attempts"`
+	StatusCode  int                `bson:"statusCode,omitempty" json:"statusCode,omitempty"`
+	LastError   string             `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	TraceID     string             `bson:"traceId,omitempty" json:"traceId,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	CompletedAt time.Time          `bson:"completedAt" json:"completedAt"`
+}
+
+// DeliveryLog stores the status of webhook deliveries
+type DeliveryLog struct {
+	collection       *mongo.Collection
+	tracer           telemetry.Tracer
+	operationTimeout time.Duration
+}
+
+func NewDeliveryLog(collection *mongo.Collection, tracer telemetry.Tracer, operationTimeout time.Duration) *DeliveryLog {
+	return &DeliveryLog{
+		collection:       collection,
+		tracer:           tracer,
+		operationTimeout: operationTimeout,
+	}
+}
+
+// Record stores a finished delivery. Like audit entries it is best-effort:
+// a failed write is only logged.
+func (d *DeliveryLog) Record(ctx context.Context, delivery WebhookDelivery) {
+	ctx, span := d.tracer.Start(ctx, "DeliveryLog.Record")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("webhook.event_id", delivery.EventID),
+		attribute.String("webhook.status", delivery.Status),
+	)
+
+	opCtx, cancel := context.WithTimeout(ctx, d.operationTimeout)
+	defer cancel()
+
+	if _, err := d.collection.InsertOne(opCtx, delivery); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("eventId", delivery.EventID).Msg("Failed to record webhook delivery")
+	}
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned when the requested document does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrVersionConflict is returned when an update names a version the user no
+// longer has, because someone else changed it first
+var ErrVersionConflict = errors.New("user version conflict")
+
+// DuplicateKeyError is returned when a write would break a unique index.
+// Field is empty if the index is not one of ours.
+type DuplicateKeyError struct {
+	Field string
+	Err   error
+}
+
+func (e *DuplicateKeyError) Error() string {
+	if e.Field == "" {
+		return "duplicate key"
+	}
+	return "duplicate " + e.Field
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.Err
+}
+
+// BatchInsertError is returned by CreateMany when some users were not
+// inserted. Users before Attempted that are not in Failed were written; an
+// ordered insert stops at its first failure, so later users never are.
+type BatchInsertError struct {
+	// Errors keyed by the index of the user they rejected
+	Failed    map[int]error
+	Attempted int
+	Err       error
+}
+
+func (e *BatchInsertError) Error() string {
+	return fmt.Sprintf("%d of %d users not inserted: %v", len(e.Failed), e.Attempted, e.Err)
+}
+
+func (e *BatchInsertError) Unwrap() error {
+	return e.Err
+}
+
+// Inserted reports whether the user at index i was written
+func (e *BatchInsertError) Inserted(i int) bool {
+	_, failed := e.Failed[i]
+	return i < e.Attempted && !failed
+}
+
+// wrapDuplicateKey names the field behind a duplicate-key error, leaving
+// other errors untouched
+func wrapDuplicateKey(err error) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	// The server only reports the violated index in the error message
+	for index, field := range uniqueIndexFields {
+		if strings.Contains(err.Error(), index) {
+			return &DuplicateKeyError{Field: field, Err: err}
+		}
+	}
+	return &DuplicateKeyError{Err: err}
+}
+
+// notFound replaces the driver's mongo.ErrNoDocuments with ErrNotFound,
+// leaving other errors untouched
+func notFound(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// IsDuplicateKey reports whether err means a write would break a unique index
+func IsDuplicateKey(err error) bool {
+	var duplicate *DuplicateKeyError
+	return errors.As(err, &duplicate) || mongo.IsDuplicateKeyError(err)
+}
+
+// IsTimeout reports whether err means an operation ran out of time, whether
+// its own or the request's
+func IsTimeout(err error) bool {
+	return mongo.IsTimeout(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// IsUnavailable reports whether err means the database could not be reached
+// or could not complete the operation for now, so it may succeed if retried
+func IsUnavailable(err error) bool {
+	if mongo.IsNetworkError(err) || errors.Is(err, mongo.ErrClientDisconnected) || errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) && writeErr.WriteConcernError != nil {
+		return true
+	}
+
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.HasErrorLabel("TransientTransactionError") || serverErr.HasErrorLabel("RetryableWriteError")
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestErrorClassification(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		wantNotFound    bool
+		wantDuplicate   bool
+		wantTimeout     bool
+		wantUnavailable bool
+	}{
+		{name: "no documents", err: notFound(mongo.ErrNoDocuments), wantNotFound: true},
+		{name: "wrapped not found", err: fmt.Errorf("get user: %w", ErrNotFound), wantNotFound: true},
+		{
+			name:          "duplicate key",
+			err:           mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}},
+			wantDuplicate: true,
+		},
+		{name: "named duplicate key", err: &DuplicateKeyError{Field: "email"}, wantDuplicate: true},
+		{
+			name:            "write concern",
+			err:             mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"}},
+			wantUnavailable: true,
+		},
+		{
+			name:            "network error",
+			err:             mongo.CommandError{Code: 6, Message: "connection reset", Labels: []string{"NetworkError"}},
+			wantUnavailable: true,
+		},
+		{
+			name:            "transient transaction error",
+			err:             mongo.CommandError{Code: 112, Message: "write conflict", Labels: []string{"TransientTransactionError"}},
+			wantUnavailable: true,
+		},
+		{name: "client disconnected", err: mongo.ErrClientDisconnected, wantUnavailable: true},
+		{name: "circuit open", err: ErrCircuitOpen, wantUnavailable: true},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, wantTimeout: true},
+		{
+			name:        "server time limit",
+			err:         mongo.CommandError{Code: 50, Message: "operation exceeded time limit"},
+			wantTimeout: true,
+		},
+		{name: "other", err: errors.New("boom")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, ErrNotFound); got != tt.wantNotFound {
+				t.Errorf("errors.Is(err, ErrNotFound) = %v, want %v", got, tt.wantNotFound)
+			}
+			if got := IsDuplicateKey(tt.err); got != tt.wantDuplicate {
+				t.Errorf("IsDuplicateKey() = %v, want %v", got, tt.wantDuplicate)
+			}
+			if got := IsTimeout(tt.err); got != tt.wantTimeout {
+				t.Errorf("IsTimeout() = %v, want %v", got, tt.wantTimeout)
+			}
+			if got := IsUnavailable(tt.err); got != tt.wantUnavailable {
+				t.Errorf("IsUnavailable() = %v, want %v", got, tt.wantUnavailable)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+
+	"tracer/internal/telemetry"
+)
+
+// IdempotencyRecord is the outcome of the first request made with an
+// idempotency key. Status is 0 while that request is still running.
+type IdempotencyRecord struct {
+	Key         string `bson:"_id"`
+	Fingerprint string `bson:"fingerprint"`
+	Status      int    `bson:"status"`
+	Body        []byte `bson:"body,omitempty"`
+	// Response headers replayed along with the body, such as ETag
+	Headers   map[string]string `bson:"headers,omitempty"`
+	CreatedAt time.Time         `bson:"createdAt"`
+	// Removed by the TTL index once this passes
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// IdempotencyStore keeps the responses of requests made with an
+// Idempotency-Key so retries can be answered without repeating them
+type IdempotencyStore struct {
+	collection       *mongo.Collection
+	tracer           telemetry.Tracer
+	operationTimeout time.Duration
+	ttl              time.Duration
+}
+
+func NewIdempotencyStore(collection *mongo.Collection, tracer telemetry.Tracer, operationTimeout, ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		collection:       collection,
+		tracer:           tracer,
+		operationTimeout: operationTimeout,
+		ttl:              ttl,
+	}
+}
+
+// Begin claims key for a request with the given fingerprint. It returns nil
+// when the claim succeeded, or the existing record when the key was used before.
+func (s *IdempotencyStore) Begin(ctx context.Context, key, fingerprint string) (*IdempotencyRecord, error) {
+	ctx, span := s.tracer.Start(ctx, "IdempotencyStore.Begin")
+	defer span.End()
+
+	opCtx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+
+	now := time.Now()
+	record := IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+	_, err := s.collection.InsertOne(opCtx, record)
+	if err == nil {
+		span.SetAttributes(attribute.Bool("idempotency.claimed", true))
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		RecordTimeout(ctx, span, err)
+		return nil, err
+	}
+
+	var existing IdempotencyRecord
+	if err := s.collection.FindOne(opCtx, bson.M{"_id": key}).Decode(&existing); err != nil {
+		RecordTimeout(ctx, span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Bool("idempotency.claimed", false))
+	return &existing, nil
+}
+
+// Complete stores the response to the request that claimed key
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, status int, headers map[string]string, body []byte) error {
+	ctx, span := s.tracer.Start(ctx, "IdempotencyStore.Complete")
+	defer span.End()
+
+	opCtx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"status": status, "headers": headers, "body": body}}
+	if _, err := s.collection.UpdateOne(opCtx, bson.M{"_id": key}, update); err != nil {
+		RecordTimeout(ctx, span, err)
+		return err
+	}
+	return nil
+}
+
+// Release drops the claim on key so a retry runs the request again
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	ctx, span := s.tracer.Start(ctx, "IdempotencyStore.Release")
+	defer span.End()
+
+	opCtx, cancel := context.WithTimeout(ctx, s.operationTimeout)
+	defer cancel()
+
+	if _, err := s.collection.DeleteOne(opCtx, bson.M{"_id": key}); err != nil {
+		RecordTimeout(ctx, span, err)
+		return err
+	}
+	return nil
+}
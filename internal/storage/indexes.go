@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	emailIndexName       = "users_email_unique"
+	tenantEmailIndexName = "users_tenant_email_unique"
+)
+
+// Unique indexes and the field each one guards
+var uniqueIndexFields = map[string]string{
+	emailIndexName:       "email",
+	tenantEmailIndexName: "email",
+}
+
+// EnsureIndexes creates the indexes the user queries rely on. Creating an
+// index that already exists with the same definition is a no-op. Creating
+// the unique email index fails if stored users already share an address.
+// When tenants share the collection, emails are only unique per tenant.
+func EnsureIndexes(ctx context.Context, collection *mongo.Collection, collationLocale string, sharedByTenants bool) error {
+	emailKeys, emailIndex := bson.D{{Key: "email", Value: 1}}, emailIndexName
+	if sharedByTenants {
+		emailKeys, emailIndex = bson.D{{Key: "tenantId", Value: 1}, {Key: "email", Value: 1}}, tenantEmailIndexName
+	}
+
+	models := []mongo.IndexModel{
+		{
+			// Backs the q parameter of GET /users
+			Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "email", Value: "text"}},
+			Options: options.Index().SetName("users_text"),
+		},
+		{
+			// Built with the query collation so addresses differing only in
+			// case count as duplicates
+			Keys: emailKeys,
+			Options: options.Index().
+				SetName(emailIndex).
+				SetUnique(true).
+				SetCollation(&options.Collation{Locale: collationLocale, Strength: 2}),
+		},
+	}
+
+	names, err := collection.Indexes().CreateMany(ctx, models)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Strs("indexes", names).Msg("Indexes ensured")
+	return nil
+}
+
+// EnsureAuditIndexes creates the index that serves user history lookups
+func EnsureAuditIndexes(ctx context.Context, collection *mongo.Collection) error {
+	model := mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}},
+		Options: options.Index().SetName("audit_user_history"),
+	}
+
+	name, err := collection.Indexes().CreateOne(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("index", name).Msg("Audit index ensured")
+	return nil
+}
+
+// EnsureDeliveryIndexes lets the deliveries of an event be looked up
+func EnsureDeliveryIndexes(ctx context.Context, collection *mongo.Collection) error {
+	model := mongo.IndexModel{
+		Keys:    bson.D{{Key: "eventId", Value: 1}},
+		Options: options.Index().SetName("delivery_event"),
+	}
+
+	name, err := collection.Indexes().CreateOne(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("index", name).Msg("Webhook delivery index ensured")
+	return nil
+}
+
+// EnsureIdempotencyIndexes expires stored responses once their TTL passes
+func EnsureIdempotencyIndexes(ctx context.Context, collection *mongo.Collection) error {
+	model := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("idempotency_ttl").SetExpireAfterSeconds(0),
+	}
+
+	name, err := collection.Indexes().CreateOne(ctx, model)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("index", name).Msg("Idempotency index ensured")
+	return nil
+}
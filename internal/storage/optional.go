@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Optional is a JSON field that remembers whether it was in the body at all,
+// so an update can tell a field that was left out, and stays unchanged, from
+// one sent as null
+type Optional[T any] struct {
+	Value T
+	// The field was in the body, possibly as null
+	Set bool
+	// The field was sent as null
+	Null bool
+}
+
+// Some returns an Optional holding value
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{Value: value, Set: true}
+}
+
+// Present reports whether the field was sent with a value other than null
+func (o Optional[T]) Present() bool {
+	return o.Set && !o.Null
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	var zero T
+	o.Value, o.Set = zero, true
+	o.Null = bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+	if o.Null {
+		return nil
+	}
+	return json.Unmarshal(data, &o.Value)
+}
+
+// MarshalJSON writes null for fields that are unset or null
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.Present() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.Value)
+}
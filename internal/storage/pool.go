@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// NewPoolMonitor reports connection pool events as metrics: how long
+// checkouts wait, how many connections are in use, and how often
+// connections are opened and closed
+func NewPoolMonitor(meter metric.Meter) (*event.PoolMonitor, error) {
+	checkoutWait, err := meter.Float64Histogram("mongo.pool.checkout.duration",
+		metric.WithDescription("Time spent waiting for a connection from the pool"),
+		metric.WithUnit("ms"))
+	if err != nil {
+		return nil, fmt.Errorf("create mongo.pool.checkout.duration histogram: %w", err)
+	}
+
+	checkoutFailures, err := meter.Int64Counter("mongo.pool.checkout.failures",
+		metric.WithDescription("Number of failed connection checkouts, by reason"),
+		metric.WithUnit("{checkout}"))
+	if err != nil {
+		return nil, fmt.Errorf("create mongo.pool.checkout.failures counter: %w", err)
+	}
+
+	inUse, err := meter.Int64UpDownCounter("mongo.pool.connections.in_use",
+		metric.WithDescription("Connections currently checked out of the pool"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return nil, fmt.Errorf("create mongo.pool.connections.in_use counter: %w", err)
+	}
+
+	created, err := meter.Int64Counter("mongo.pool.connections.created",
+		metric.WithDescription("Number of connections opened"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return nil, fmt.Errorf("create mongo.pool.connections.created counter: %w", err)
+	}
+
+	closed, err := meter.Int64Counter("mongo.pool.connections.closed",
+		metric.WithDescription("Number of connections closed, by reason"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return nil, fmt.Errorf("create mongo.pool.connections.closed counter: %w", err)
+	}
+
+	cleared, err := meter.Int64Counter("mongo.pool.cleared",
+		metric.WithDescription("Number of times a pool was cleared after a server error"),
+		metric.WithUnit("{clear}"))
+	if err != nil {
+		return nil, fmt.Errorf("create mongo.pool.cleared counter: %w", err)
+	}
+
+	return &event.PoolMonitor{
+		Event: func(evt *event.PoolEvent) {
+			// Pool events carry no request context
+			ctx := context.Background()
+			server := metric.WithAttributes(attribute.String("server.address", evt.Address))
+
+			switch evt.Type {
+			case event.GetSucceeded:
+				checkoutWait.Record(ctx, float64(evt.Duration.Microseconds())/1000, server)
+				inUse.Add(ctx, 1, server)
+			case event.GetFailed:
+				checkoutWait.Record(ctx, float64(evt.Duration.Microseconds())/1000, server)
+				checkoutFailures.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("server.address", evt.Address),
+					attribute.String("reason", evt.Reason),
+				))
+			case event.ConnectionReturned:
+				inUse.Add(ctx, -1, server)
+			case event.ConnectionCreated:
+				created.Add(ctx, 1, server)
+			case event.ConnectionClosed:
+				closed.Add(ctx, 1, metric.WithAttributes(
+					attribute.String("server.address", evt.Address),
+					attribute.String("reason", evt.Reason),
+				))
+			case event.PoolCleared:
+				cleared.Add(ctx, 1, server)
+			}
+		},
+	}, nil
+}
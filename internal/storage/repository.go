@@ -0,0 +1,624 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"tracer/internal/telemetry"
+)
+
+//go:generate go run go.uber.org/mock/mockgen@v0.4.0 -source=repository.go -destination=storagemock/repository.go -package=storagemock
+
+// UserRepository is the storage behind the user handlers. Implementations
+// return ErrNotFound when a user does not exist. Soft-deleted users
+// are treated as missing unless a read explicitly includes them.
+type UserRepository interface {
+	Create(ctx context.Context, user *User) error
+	// CreateMany inserts users in one round trip, filling in the same fields
+	// as Create. Users without an ID are given one. It returns a
+	// *BatchInsertError when the server rejected some of them.
+	CreateMany(ctx context.Context, users []User, ordered bool) error
+	GetByID(ctx context.Context, id primitive.ObjectID, includeDeleted bool) (User, error)
+	// Update applies the update and returns the user as it was before and
+	// after. It returns ErrVersionConflict when update.Version is stale.
+	Update(ctx context.Context, id primitive.ObjectID, update UserUpdate) (before, after User, err error)
+	// Delete soft-deletes the user and returns it as it was before
+	Delete(ctx context.Context, id primitive.ObjectID) (User, error)
+	// DeleteMany soft-deletes the active users matching filter and returns
+	// how many it deleted. It works in batches, passing each to deleted as
+	// the users were before, so the matches are never all held in memory.
+	DeleteMany(ctx context.Context, filter UserFilter, deleted func([]User)) (int64, error)
+	// Restore undoes a soft delete and returns the restored user
+	Restore(ctx context.Context, id primitive.ObjectID) (User, error)
+	List(ctx context.Context, query UserQuery) ([]User, int64, error)
+	// Each calls fn with every active user, one at a time, and stops at the
+	// first error fn returns
+	Each(ctx context.Context, fn func(User) error) error
+	// Watch opens a change stream over the tenant's users, resuming after
+	// the given token unless it is empty
+	Watch(ctx context.Context, resumeAfter string) (ChangeStream, error)
+	// Tenants lists the tenants that may have users, "" standing for the
+	// users that belong to none
+	Tenants(ctx context.Context) ([]string, error)
+	// Purge permanently removes the tenant's users that were soft-deleted
+	// before deletedBefore and returns how many it removed
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// Count returns how many of the tenant's users are active and deleted
+	Count(ctx context.Context) (UserCounts, error)
+}
+
+// UserQuery selects a page of users. Total counts ignore After, so they stay
+// stable while a client walks the pages with a cursor.
+type UserQuery struct {
+	Filter         UserFilter
+	Sort           UserSort
+	Limit          int64
+	Offset         int64
+	After          *Cursor
+	IncludeDeleted bool
+}
+
+// UserCounts are the users of one tenant by state
+type UserCounts struct {
+	Active  int64
+	Deleted int64
+}
+
+// notDeleted matches users that have not been soft-deleted
+var notDeleted = bson.M{"$exists": false}
+
+// withoutDeleted returns a copy of filter that skips soft-deleted users
+func withoutDeleted(filter bson.M) bson.M {
+	active := make(bson.M, len(filter)+1)
+	for key, value := range filter {
+		active[key] = value
+	}
+	active["deletedAt"] = notDeleted
+	return active
+}
+
+type MongoUserRepository struct {
+	collection *mongo.Collection
+	tracer     telemetry.Tracer
+
+	// Upper bound for a single MongoDB operation, independent of the request deadline
+	operationTimeout time.Duration
+
+	// Locale used to compare user names and emails
+	collationLocale string
+
+	// Applied to reads only; single writes rely on the driver's retryable writes
+	retry RetryPolicy
+
+	// Scopes every operation to the request's tenant; nil when tenancy is off
+	tenancy *Tenancy
+}
+
+func NewMongoUserRepository(collection *mongo.Collection, tracer telemetry.Tracer, operationTimeout time.Duration, collationLocale string, retry RetryPolicy, tenancy *Tenancy) *MongoUserRepository {
+	return &MongoUserRepository{
+		collection:       collection,
+		tracer:           tracer,
+		operationTimeout: operationTimeout,
+		collationLocale:  collationLocale,
+		retry:            retry,
+		tenancy:          tenancy,
+	}
+}
+
+// scope returns the tenant's collection and restricts filter to its documents
+func (r *MongoUserRepository) scope(ctx context.Context, filter bson.M) (*mongo.Collection, bson.M, error) {
+	collection, err := r.tenancy.Collection(ctx, r.collection)
+	if err != nil {
+		return nil, nil, err
+	}
+	return collection, r.tenancy.Filter(ctx, filter), nil
+}
+
+// withOperationTimeout derives the context for a single MongoDB operation.
+// The request deadline still applies, so whichever is tighter wins.
+func (r *MongoUserRepository) withOperationTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, r.operationTimeout)
+}
+
+// collation makes name sorting and matching case-insensitive while still
+// telling accented characters apart. Indexes only serve these queries when
+// they are built with the same collation.
+func (r *MongoUserRepository) collation() *options.Collation {
+	return &options.Collation{
+		Locale:   r.collationLocale,
+		Strength: 2,
+	}
+}
+
+func (r *MongoUserRepository) Create(ctx context.Context, user *User) error {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.Create")
+	defer span.End()
+
+	collection, err := r.tenancy.Collection(ctx, r.collection)
+	if err != nil {
+		return err
+	}
+
+	user.CreatedAt = Now()
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	user.TenantID = r.tenancy.DocumentTenant(ctx)
+	recordStatement(span, collection, "insert", user)
+
+	opCtx, cancel := r.withOperationTimeout(ctx)
+	defer cancel()
+
+	result, err := collection.InsertOne(opCtx, user)
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return wrapDuplicateKey(err)
+	}
+
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	span.SetAttributes(attribute.String("user.id", user.ID.Hex()))
+	return nil
+}
+
+func (r *MongoUserRepository) CreateMany(ctx context.Context, users []User, ordered bool) error {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.CreateMany")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("batch.size", len(users)),
+		attribute.Bool("batch.ordered", ordered),
+	)
+
+	collection, err := r.tenancy.Collection(ctx, r.collection)
+	if err != nil {
+		return err
+	}
+
+	createdAt := Now()
+	tenant := r.tenancy.DocumentTenant(ctx)
+	docs := make([]any, len(users))
+	for i := range users {
+		if users[i].ID.IsZero() {
+			users[i].ID = primitive.NewObjectID()
+		}
+		users[i].CreatedAt = createdAt
+		users[i].UpdatedAt = createdAt
+		users[i].Version = 1
+		users[i].TenantID = tenant
+		docs[i] = users[i]
+	}
+	recordStatement(span, collection, "insertMany", nil)
+
+	opCtx, cancel := r.withOperationTimeout(ctx)
+	defer cancel()
+
+	_, err = collection.InsertMany(opCtx, docs, options.InsertMany().SetOrdered(ordered))
+	if err == nil {
+		span.SetAttributes(attribute.Int("db.inserted_count", len(users)))
+		return nil
+	}
+	RecordTimeout(ctx, span, err)
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) {
+		// Nothing is known to have been written
+		return err
+	}
+
+	batchErr := &BatchInsertError{Failed: make(map[int]error, len(bulkErr.WriteErrors)), Attempted: len(users), Err: err}
+	for _, writeErr := range bulkErr.WriteErrors {
+		batchErr.Failed[writeErr.Index] = wrapDuplicateKey(mongo.WriteException{WriteErrors: []mongo.WriteError{writeErr.WriteError}})
+		if ordered {
+			batchErr.Attempted = min(batchErr.Attempted, writeErr.Index+1)
+		}
+	}
+	span.SetAttributes(attribute.Int("db.inserted_count", batchErr.Attempted-len(batchErr.Failed)))
+	return batchErr
+}
+
+func (r *MongoUserRepository) GetByID(ctx context.Context, id primitive.ObjectID, includeDeleted bool) (User, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.GetByID")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("user.id", id.Hex()),
+		attribute.Bool("db.include_deleted", includeDeleted),
+	)
+
+	filter := bson.M{"_id": id}
+	if !includeDeleted {
+		filter = withoutDeleted(filter)
+	}
+	collection, filter, err := r.scope(ctx, filter)
+	if err != nil {
+		return User{}, err
+	}
+	recordStatement(span, collection, "findOne", filter)
+
+	var user User
+	err = r.retry.do(ctx, span, func(ctx context.Context) error {
+		opCtx, cancel := r.withOperationTimeout(ctx)
+		defer cancel()
+		return collection.FindOne(opCtx, filter).Decode(&user)
+	})
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return User{}, notFound(err)
+	}
+	return user, nil
+}
+
+func (r *MongoUserRepository) Update(ctx context.Context, id primitive.ObjectID, update UserUpdate) (User, User, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.Update")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", id.Hex()))
+
+	set, err := update.SetDocument()
+	if err != nil {
+		return User{}, User{}, err
+	}
+	updatedAt := Now()
+	set["updatedAt"] = updatedAt
+
+	collection, filter, err := r.scope(ctx, withoutDeleted(bson.M{"_id": id}))
+	if err != nil {
+		return User{}, User{}, err
+	}
+	if update.Version != nil {
+		filter["version"] = versionFilter(*update.Version)
+		span.SetAttributes(attribute.Int64("user.expected_version", *update.Version))
+	}
+	recordStatement(span, collection, "findOneAndUpdate", filter)
+
+	opCtx, cancel := r.withOperationTimeout(ctx)
+	defer cancel()
+
+	// Fetch the previous version in the same round trip for the audit trail
+	var before User
+	err = collection.FindOneAndUpdate(opCtx, filter, bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&before)
+	if errors.Is(err, mongo.ErrNoDocuments) && update.Version != nil {
+		err = r.versionConflict(opCtx, collection, id)
+		span.SetAttributes(attribute.Bool("user.version_conflict", errors.Is(err, ErrVersionConflict)))
+	}
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return User{}, User{}, notFound(wrapDuplicateKey(err))
+	}
+
+	after := update.Apply(before)
+	after.UpdatedAt = updatedAt
+	after.Version = before.Version + 1
+	return before, after, nil
+}
+
+// versionConflict tells apart the two reasons a versioned update can match
+// nothing: ErrVersionConflict if the user exists, ErrNotFound if not
+func (r *MongoUserRepository) versionConflict(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID) error {
+	filter := r.tenancy.Filter(ctx, withoutDeleted(bson.M{"_id": id}))
+	count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionConflict
+}
+
+func (r *MongoUserRepository) Delete(ctx context.Context, id primitive.ObjectID) (User, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.Delete")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", id.Hex()))
+
+	collection, filter, err := r.scope(ctx, withoutDeleted(bson.M{"_id": id}))
+	if err != nil {
+		return User{}, err
+	}
+	recordStatement(span, collection, "findOneAndUpdate", filter)
+
+	opCtx, cancel := r.withOperationTimeout(ctx)
+	defer cancel()
+
+	var deleted User
+	deletedAt := Now()
+	update := bson.M{
+		"$set": bson.M{"deletedAt": deletedAt, "updatedAt": deletedAt},
+		"$inc": bson.M{"version": 1},
+	}
+	err = collection.FindOneAndUpdate(opCtx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.Before)).Decode(&deleted)
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return User{}, notFound(err)
+	}
+	return deleted, nil
+}
+
+// Number of users DeleteMany soft-deletes per round trip
+const deleteBatchSize = 500
+
+func (r *MongoUserRepository) DeleteMany(ctx context.Context, criteria UserFilter, deleted func([]User)) (int64, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.DeleteMany")
+	defer span.End()
+
+	collection, filter, err := r.scope(ctx, withoutDeleted(criteria.document()))
+	if err != nil {
+		return 0, err
+	}
+	recordStatement(span, collection, "updateMany", filter)
+
+	var count int64
+	defer func() {
+		span.SetAttributes(attribute.Int64("db.deleted_count", count))
+	}()
+
+	// Each batch is read before it is deleted, so every deletion can be
+	// audited with its old value. No operation timeout: the cursor lives as
+	// long as the batches take.
+	cursor, err := collection.Find(ctx, filter, options.Find().SetBatchSize(deleteBatchSize))
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	deletedAt := Now()
+	batch := make([]User, 0, deleteBatchSize)
+	flush := func() error {
+		ours, err := r.deleteBatch(ctx, collection, batch, deletedAt)
+		if err != nil {
+			RecordTimeout(ctx, span, err)
+			return err
+		}
+		count += int64(len(ours))
+		if len(ours) > 0 {
+			deleted(ours)
+		}
+		// deleted may hold on to the batch, so the next one gets its own
+		batch = make([]User, 0, deleteBatchSize)
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return count, err
+		}
+		batch = append(batch, user)
+		if len(batch) == deleteBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		RecordTimeout(ctx, span, err)
+		return count, err
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// deleteBatch soft-deletes the users in batch with one updateMany and
+// returns the ones it deleted, as they were before
+func (r *MongoUserRepository) deleteBatch(ctx context.Context, collection *mongo.Collection, batch []User, deletedAt time.Time) ([]User, error) {
+	opCtx, cancel := r.withOperationTimeout(ctx)
+	defer cancel()
+
+	ids := make([]primitive.ObjectID, len(batch))
+	for i, user := range batch {
+		ids[i] = user.ID
+	}
+
+	update := bson.M{
+		"$set": bson.M{"deletedAt": deletedAt, "updatedAt": deletedAt},
+		"$inc": bson.M{"version": 1},
+	}
+	result, err := collection.UpdateMany(opCtx, withoutDeleted(bson.M{"_id": bson.M{"$in": ids}}), update)
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount == int64(len(batch)) {
+		return batch, nil
+	}
+
+	// Someone else deleted some of them in between; report only ours, which
+	// carry this call's timestamp
+	cursor, err := collection.Find(opCtx, bson.M{"_id": bson.M{"$in": ids}, "deletedAt": deletedAt},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var ours []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(opCtx, &ours); err != nil {
+		return nil, err
+	}
+	deletedByUs := make(map[primitive.ObjectID]bool, len(ours))
+	for _, doc := range ours {
+		deletedByUs[doc.ID] = true
+	}
+	deleted := make([]User, 0, len(ours))
+	for _, user := range batch {
+		if deletedByUs[user.ID] {
+			deleted = append(deleted, user)
+		}
+	}
+	return deleted, nil
+}
+
+func (r *MongoUserRepository) Restore(ctx context.Context, id primitive.ObjectID) (User, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.Restore")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.id", id.Hex()))
+
+	collection, filter, err := r.scope(ctx, bson.M{"_id": id, "deletedAt": bson.M{"$exists": true}})
+	if err != nil {
+		return User{}, err
+	}
+	recordStatement(span, collection, "findOneAndUpdate", filter)
+
+	opCtx, cancel := r.withOperationTimeout(ctx)
+	defer cancel()
+
+	var restored User
+	update := bson.M{
+		"$unset": bson.M{"deletedAt": ""},
+		"$set":   bson.M{"updatedAt": Now()},
+		"$inc":   bson.M{"version": 1},
+	}
+	err = collection.FindOneAndUpdate(opCtx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&restored)
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return User{}, notFound(err)
+	}
+	return restored, nil
+}
+
+func (r *MongoUserRepository) List(ctx context.Context, query UserQuery) ([]User, int64, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.List")
+	defer span.End()
+
+	findOpts := options.Find().
+		SetSort(query.Sort.document()).
+		SetLimit(query.Limit)
+
+	// Text indexes only support simple binary comparison, so text searches
+	// run without the case-insensitive collation
+	if query.Filter.Search == "" {
+		findOpts.SetCollation(r.collation())
+	}
+
+	base := query.Filter.document()
+	if !query.IncludeDeleted {
+		base = withoutDeleted(base)
+	}
+	collection, base, err := r.scope(ctx, base)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Keyset pagination: continue after the cursor instead of skipping
+	filter := base
+	if query.After != nil {
+		filter = bson.M{"$and": bson.A{base, cursorFilter(query.Sort, *query.After)}}
+	} else {
+		findOpts.SetSkip(query.Offset)
+	}
+	recordStatement(span, collection, "find", filter)
+
+	countOpts := options.Count()
+	if findOpts.Collation != nil {
+		countOpts.SetCollation(findOpts.Collation)
+	}
+
+	var total int64
+	var users []User
+	err = r.retry.do(ctx, span, func(ctx context.Context) error {
+		opCtx, cancel := r.withOperationTimeout(ctx)
+		defer cancel()
+
+		var err error
+		total, err = collection.CountDocuments(opCtx, base, countOpts)
+		if err != nil {
+			return err
+		}
+
+		cursor, err := collection.Find(opCtx, filter, findOpts)
+		if err != nil {
+			return err
+		}
+		users = nil
+		return cursor.All(opCtx, &users)
+	})
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return nil, 0, err
+	}
+
+	span.SetAttributes(attribute.Int("db.returned", len(users)))
+	return users, total, nil
+}
+
+func (r *MongoUserRepository) Tenants(ctx context.Context) ([]string, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.Tenants")
+	defer span.End()
+
+	opCtx, cancel := r.withOperationTimeout(ctx)
+	defer cancel()
+
+	tenants, err := r.tenancy.Tenants(opCtx, r.collection)
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("tenant.count", len(tenants)))
+	return tenants, nil
+}
+
+func (r *MongoUserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.Purge")
+	defer span.End()
+
+	collection, filter, err := r.scope(ctx, bson.M{"deletedAt": bson.M{"$lt": deletedBefore}})
+	if err != nil {
+		return 0, err
+	}
+	recordStatement(span, collection, "deleteMany", filter)
+
+	// No operation timeout: a purge may remove a backlog of users, and the
+	// job's own timeout bounds it
+	result, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return 0, err
+	}
+	span.SetAttributes(attribute.Int64("db.deleted_count", result.DeletedCount))
+	return result.DeletedCount, nil
+}
+
+func (r *MongoUserRepository) Count(ctx context.Context) (UserCounts, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.Count")
+	defer span.End()
+
+	collection, active, err := r.scope(ctx, withoutDeleted(bson.M{}))
+	if err != nil {
+		return UserCounts{}, err
+	}
+	deleted := r.tenancy.Filter(ctx, bson.M{"deletedAt": bson.M{"$exists": true}})
+	recordStatement(span, collection, "countDocuments", active)
+
+	var counts UserCounts
+	err = r.retry.do(ctx, span, func(ctx context.Context) error {
+		opCtx, cancel := r.withOperationTimeout(ctx)
+		defer cancel()
+
+		var err error
+		if counts.Active, err = collection.CountDocuments(opCtx, active); err != nil {
+			return err
+		}
+		counts.Deleted, err = collection.CountDocuments(opCtx, deleted)
+		return err
+	})
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return UserCounts{}, err
+	}
+	return counts, nil
+}
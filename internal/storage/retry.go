@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Server error codes seen while a replica set elects a new primary
+var electionErrorCodes = map[int]bool{
+	91:    true, // ShutdownInProgress
+	189:   true, // PrimarySteppedDown
+	10107: true, // NotWritablePrimary
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotPrimaryNoSecondaryOk
+	13436: true, // NotPrimaryOrSecondary
+}
+
+// RetryPolicy retries transient MongoDB errors with exponential backoff and
+// full jitter. It never sleeps past the context deadline.
+type RetryPolicy struct {
+	// Total attempts including the first, so 1 disables retries
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// do runs fn until it succeeds, fails with a permanent error or runs out of
+// attempts. Every retry is recorded as a db.retry event on span.
+func (p RetryPolicy) do(ctx context.Context, span trace.Span, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !isRetryable(ctx, err) {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			span.AddEvent("db.retry_abandoned", trace.WithAttributes(
+				attribute.Int("db.attempt", attempt),
+				attribute.String("error.message", err.Error()),
+			))
+			return err
+		}
+
+		span.AddEvent("db.retry", trace.WithAttributes(
+			attribute.Int("db.attempt", attempt),
+			attribute.Int64("db.retry_delay_ms", delay.Milliseconds()),
+			attribute.String("error.message", err.Error()),
+		))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff picks a random delay up to BaseDelay doubled once per attempt,
+// capped at MaxDelay
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		ceiling = min(p.MaxDelay, p.BaseDelay<<shift)
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// isRetryable reports whether err is worth another attempt: network errors,
+// timeouts of a single operation while the request still has time, and
+// errors raised during a primary election. Operations inside a transaction
+// are never retried alone; the whole transaction is retried instead.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || mongo.SessionFromContext(ctx) != nil {
+		return false
+	}
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		if serverErr.HasErrorLabel("RetryableWriteError") || serverErr.HasErrorLabel("TransientTransactionError") {
+			return true
+		}
+		for code := range electionErrorCodes {
+			if serverErr.HasErrorCode(code) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SeedResult counts the fixtures Seed inserted and the ones already stored
+type SeedResult struct {
+	Inserted int64
+	Existing int64
+}
+
+// Seed inserts the users whose email is not stored yet, in batches of
+// batchSize. Stored users, soft-deleted ones included, are left untouched,
+// so seeding the same fixtures again changes nothing.
+func (r *MongoUserRepository) Seed(ctx context.Context, users []User, batchSize int) (SeedResult, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.Seed")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("seed.users", len(users)),
+		attribute.Int("seed.batch_size", batchSize),
+	)
+
+	var result SeedResult
+	for start := 0; start < len(users); start += batchSize {
+		end := min(start+batchSize, len(users))
+		batch, err := r.seedBatch(ctx, users[start:end])
+		result.Inserted += batch.Inserted
+		result.Existing += batch.Existing
+		if err != nil {
+			return result, err
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int64("seed.inserted", result.Inserted),
+		attribute.Int64("seed.existing", result.Existing),
+	)
+	return result, nil
+}
+
+// seedBatch upserts one batch keyed on email, with the collation of the
+// unique email index so addresses differing only in case match
+func (r *MongoUserRepository) seedBatch(ctx context.Context, users []User) (SeedResult, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.seedBatch")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("seed.batch.users", len(users)))
+
+	// Every upsert has the shape of this filter
+	collection, shape, err := r.scope(ctx, bson.M{"email": ""})
+	if err != nil {
+		return SeedResult{}, err
+	}
+
+	now := Now()
+	tenant := r.tenancy.DocumentTenant(ctx)
+	models := make([]mongo.WriteModel, 0, len(users))
+	for _, user := range users {
+		insert := bson.M{
+			"name":      user.Name,
+			"email":     user.Email,
+			"createdAt": now,
+			"updatedAt": now,
+			"version":   1,
+		}
+		if tenant != "" {
+			insert["tenantId"] = tenant
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(r.tenancy.Filter(ctx, bson.M{"email": user.Email})).
+			SetUpdate(bson.M{"$setOnInsert": insert}).
+			SetCollation(r.collation()).
+			SetUpsert(true))
+	}
+	recordStatement(span, collection, "bulkWrite", shape)
+
+	opCtx, cancel := r.withOperationTimeout(ctx)
+	defer cancel()
+
+	written, err := collection.BulkWrite(opCtx, models, options.BulkWrite().SetOrdered(false))
+	if written == nil {
+		RecordTimeout(ctx, span, err)
+		return SeedResult{}, err
+	}
+
+	result := SeedResult{Inserted: written.UpsertedCount, Existing: written.MatchedCount}
+	span.SetAttributes(
+		attribute.Int64("seed.batch.inserted", result.Inserted),
+		attribute.Int64("seed.batch.existing", result.Existing),
+	)
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return result, wrapDuplicateKey(err)
+	}
+	return result, nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordStatement tags a repository span with the database semantic
+// conventions and adds the query shape as a db.statement event, so traces
+// show what ran without exposing user data
+func recordStatement(span trace.Span, collection *mongo.Collection, operation string, filter any) {
+	span.SetAttributes(
+		semconv.DBSystemMongoDB,
+		semconv.DBNameKey.String(collection.Database().Name()),
+		semconv.DBMongoDBCollectionKey.String(collection.Name()),
+		semconv.DBOperationKey.String(operation),
+	)
+
+	statement, err := sanitizeFilter(filter)
+	if err != nil {
+		return
+	}
+	span.AddEvent("db.statement", trace.WithAttributes(semconv.DBStatementKey.String(statement)))
+}
+
+// sanitizeFilter renders filter as JSON with every value replaced by "?",
+// keeping field names and operators
+func sanitizeFilter(filter any) (string, error) {
+	raw, err := bson.Marshal(filter)
+	if err != nil {
+		return "", err
+	}
+
+	doc, err := sanitizeDocument(raw)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func sanitizeDocument(raw bson.Raw) (bson.D, error) {
+	elements, err := raw.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := make(bson.D, 0, len(elements))
+	for _, element := range elements {
+		value, err := sanitizeValue(element.Value())
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, bson.E{Key: element.Key(), Value: value})
+	}
+	return doc, nil
+}
+
+func sanitizeValue(value bson.RawValue) (any, error) {
+	switch value.Type {
+	case bsontype.EmbeddedDocument:
+		return sanitizeDocument(value.Document())
+	case bsontype.Array:
+		values, err := value.Array().Values()
+		if err != nil {
+			return nil, err
+		}
+		array := make(bson.A, 0, len(values))
+		for _, v := range values {
+			sanitized, err := sanitizeValue(v)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, sanitized)
+		}
+		return array, nil
+	default:
+		return "?", nil
+	}
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/otel/attribute"
+
+	"tracer/internal/telemetry"
+)
+
+// ChangeStream reads user changes in the order they happened
+type ChangeStream interface {
+	Next(ctx context.Context) bool
+	// Event decodes the change Next moved to
+	Event() (ChangeEvent, error)
+	// ResumeToken identifies the current change, so a later stream can
+	// resume after it
+	ResumeToken() string
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// ChangeEvent is one change to a user. FullDocument is nil for hard deletes.
+type ChangeEvent struct {
+	OperationType string `bson:"operationType"`
+	FullDocument  *User  `bson:"fullDocument,omitempty"`
+	DocumentKey   struct {
+		ID ID `bson:"_id"`
+	} `bson:"documentKey"`
+	Namespace struct {
+		DB string `bson:"db"`
+	} `bson:"ns"`
+}
+
+// mongoChangeStream adapts *mongo.ChangeStream to ChangeStream
+type mongoChangeStream struct {
+	*mongo.ChangeStream
+}
+
+func (s mongoChangeStream) Event() (ChangeEvent, error) {
+	var event ChangeEvent
+	err := s.Decode(&event)
+	return event, err
+}
+
+func (s mongoChangeStream) ResumeToken() string {
+	token, _ := s.ChangeStream.ResumeToken().Lookup("_data").StringValueOK()
+	return token
+}
+
+// userChangePipeline keeps the changes that clients are told about
+func userChangePipeline() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{"insert", "update", "replace", "delete"}}}},
+		}}},
+	}
+}
+
+// changeStreamOptions looks up the full document of every update, so clients
+// receive the user as it is now, and resumes after the given token unless
+// it is empty
+func changeStreamOptions(resumeAfter string) *options.ChangeStreamOptions {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeAfter != "" {
+		opts.SetResumeAfter(bson.M{"_data": resumeAfter})
+	}
+	return opts
+}
+
+// UserFeed opens change streams over the users of every tenant at once, for
+// fanning changes out to clients of all of them
+type UserFeed struct {
+	collection *mongo.Collection
+	tenancy    *Tenancy
+}
+
+func NewUserFeed(collection *mongo.Collection, tenancy *Tenancy) *UserFeed {
+	return &UserFeed{collection: collection, tenancy: tenancy}
+}
+
+// Open watches the users collection, or with per-tenant databases the users
+// collection of every tenant through a cluster-wide stream. It resumes after
+// the given token unless it is empty.
+func (f *UserFeed) Open(ctx context.Context, resumeAfter string) (ChangeStream, error) {
+	opts := changeStreamOptions(resumeAfter)
+	if !f.tenancy.PerDatabase() {
+		stream, err := f.collection.Watch(ctx, userChangePipeline(), opts)
+		if err != nil {
+			return nil, err
+		}
+		return mongoChangeStream{stream}, nil
+	}
+
+	database := f.collection.Database().Name()
+	pipeline := append(mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"ns.coll": f.collection.Name(),
+			"$or": bson.A{
+				bson.M{"ns.db": database},
+				bson.M{"ns.db": bson.M{"$regex": "^" + regexp.QuoteMeta(f.tenancy.Prefix())}},
+			},
+		}}},
+	}, userChangePipeline()...)
+	stream, err := f.collection.Database().Client().Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	return mongoChangeStream{stream}, nil
+}
+
+func (r *MongoUserRepository) Each(ctx context.Context, fn func(User) error) error {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.Each")
+	defer span.End()
+
+	collection, filter, err := r.scope(ctx, withoutDeleted(bson.M{}))
+	if err != nil {
+		return err
+	}
+	recordStatement(span, collection, "find", filter)
+
+	// No operation timeout: the cursor lives as long as the caller reads
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		return err
+	}
+	// The request context is canceled when the client disconnects, so the
+	// server-side cursor is closed with a fresh one
+	defer cursor.Close(context.Background())
+
+	var read int64
+	defer func() {
+		span.SetAttributes(attribute.Int64("db.returned", read))
+	}()
+
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		read++
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		RecordTimeout(ctx, span, err)
+		return err
+	}
+	return nil
+}
+
+// Watch requires MongoDB to run as a replica set
+func (r *MongoUserRepository) Watch(ctx context.Context, resumeAfter string) (ChangeStream, error) {
+	ctx, span := r.tracer.Start(ctx, "UserRepository.Watch")
+	defer span.End()
+
+	collection, err := r.tenancy.Collection(ctx, r.collection)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := changeStreamOptions(resumeAfter)
+	if resumeAfter != "" {
+		span.SetAttributes(attribute.Bool("change_stream.resumed", true))
+	}
+
+	pipeline := userChangePipeline()
+	if r.tenancy != nil && !r.tenancy.PerDatabase() {
+		// Deletes carry no document and so no tenant; users are soft
+		// deleted, which leaves only purges out
+		var tenant any = bson.M{"$exists": false}
+		if id := telemetry.TenantFromContext(ctx); id != "" {
+			tenant = id
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"fullDocument.tenantId": tenant}}})
+	}
+	recordStatement(span, collection, "watch", nil)
+
+	stream, err := collection.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	return mongoChangeStream{stream}, nil
+}
+
+// Ping checks that the primary answers, for readiness probes
+func (r *MongoUserRepository) Ping(ctx context.Context) error {
+	return r.collection.Database().Client().Ping(ctx, readpref.Primary())
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tracer/internal/telemetry"
+)
+
+// Tenancy routes reads and writes to the tenant in the request context, as
+// set by telemetry.WithTenant. A nil Tenancy leaves everything unscoped.
+//
+// With a filter tenancy tenants share collections: documents carry a
+// tenantId and every query matches it. With a database tenancy each tenant
+// has its own database. Either way, requests without a tenant see the
+// configured database and only documents without a tenantId.
+type Tenancy struct {
+	client *mongo.Client
+	// Set for database tenancy
+	prefix       string
+	setup        func(ctx context.Context, db *mongo.Database) error
+	setupTimeout time.Duration
+
+	mu       sync.Mutex
+	ready    map[string]bool
+	inflight map[string]*tenantSetup
+}
+
+// tenantSetup is a setup run that requests for the same tenant wait on
+type tenantSetup struct {
+	done chan struct{}
+	err  error
+}
+
+func NewFilterTenancy() *Tenancy {
+	return &Tenancy{}
+}
+
+// NewDatabaseTenancy keeps each tenant in the database prefix + tenant.
+// setup runs the first time a tenant database is used by this process and
+// should create its indexes. It gets at most setupTimeout.
+func NewDatabaseTenancy(client *mongo.Client, prefix string, setupTimeout time.Duration, setup func(ctx context.Context, db *mongo.Database) error) *Tenancy {
+	return &Tenancy{
+		client:       client,
+		prefix:       prefix,
+		setup:        setup,
+		setupTimeout: setupTimeout,
+		ready:        make(map[string]bool),
+		inflight:     make(map[string]*tenantSetup),
+	}
+}
+
+// Collection returns base, or the collection of the same name in the
+// tenant's database
+func (t *Tenancy) Collection(ctx context.Context, base *mongo.Collection) (*mongo.Collection, error) {
+	tenant := telemetry.TenantFromContext(ctx)
+	if !t.PerDatabase() || tenant == "" {
+		return base, nil
+	}
+
+	db := t.client.Database(t.prefix + tenant)
+	if err := t.prepare(ctx, tenant, db); err != nil {
+		return nil, err
+	}
+	return db.Collection(base.Name()), nil
+}
+
+// prepare runs setup once per tenant database. Requests for a tenant that
+// is being set up wait for that run, or until their own context is done,
+// without holding up other tenants. Failed setups are retried on the next
+// request.
+func (t *Tenancy) prepare(ctx context.Context, tenant string, db *mongo.Database) error {
+	if t.setup == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	if t.ready[tenant] {
+		t.mu.Unlock()
+		return nil
+	}
+	run, ok := t.inflight[tenant]
+	if !ok {
+		run = &tenantSetup{done: make(chan struct{})}
+		t.inflight[tenant] = run
+		go t.runSetup(ctx, tenant, db, run)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-run.done:
+		return run.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runSetup outlives the request that started it, so a client giving up
+// does not fail the requests waiting with it, but is bounded by
+// setupTimeout
+func (t *Tenancy) runSetup(ctx context.Context, tenant string, db *mongo.Database, run *tenantSetup) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), t.setupTimeout)
+	defer cancel()
+
+	run.err = t.setup(ctx, db)
+
+	t.mu.Lock()
+	if run.err == nil {
+		t.ready[tenant] = true
+	}
+	delete(t.inflight, tenant)
+	t.mu.Unlock()
+	close(run.done)
+}
+
+// Filter returns a copy of filter restricted to the tenant's documents. It
+// returns filter unchanged unless tenants share collections.
+func (t *Tenancy) Filter(ctx context.Context, filter bson.M) bson.M {
+	if t == nil || t.PerDatabase() {
+		return filter
+	}
+
+	scoped := make(bson.M, len(filter)+1)
+	for key, value := range filter {
+		scoped[key] = value
+	}
+	if tenant := telemetry.TenantFromContext(ctx); tenant != "" {
+		scoped["tenantId"] = tenant
+	} else {
+		scoped["tenantId"] = bson.M{"$exists": false}
+	}
+	return scoped
+}
+
+// DocumentTenant is the tenantId to store on new documents, "" unless
+// tenants share collections
+func (t *Tenancy) DocumentTenant(ctx context.Context) string {
+	if t == nil || t.PerDatabase() {
+		return ""
+	}
+	return telemetry.TenantFromContext(ctx)
+}
+
+// TenantOf returns the tenant owning a change stream event, from the
+// database it happened in or the tenantId of the document
+func (t *Tenancy) TenantOf(database string, user *User) string {
+	if t.PerDatabase() {
+		if tenant, ok := strings.CutPrefix(database, t.prefix); ok {
+			return tenant
+		}
+		return ""
+	}
+	if user != nil {
+		return user.TenantID
+	}
+	return ""
+}
+
+// Tenants lists the tenants with data in base, or in a database of their
+// own, starting with "" for the data that belongs to no tenant. Jobs that
+// run outside any request use it to visit every tenant in turn.
+func (t *Tenancy) Tenants(ctx context.Context, base *mongo.Collection) ([]string, error) {
+	tenants := []string{""}
+	switch {
+	case t == nil:
+	case t.PerDatabase():
+		names, err := t.client.ListDatabaseNames(ctx, bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(t.prefix)}})
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if tenant := strings.TrimPrefix(name, t.prefix); tenant != "" {
+				tenants = append(tenants, tenant)
+			}
+		}
+	default:
+		values, err := base.Distinct(ctx, "tenantId", bson.M{"tenantId": bson.M{"$exists": true}})
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if tenant, ok := value.(string); ok && tenant != "" {
+				tenants = append(tenants, tenant)
+			}
+		}
+	}
+	return tenants, nil
+}
+
+// Prefix is the start of every tenant database name
+func (t *Tenancy) Prefix() string {
+	if t == nil {
+		return ""
+	}
+	return t.prefix
+}
+
+// PerDatabase reports whether tenants have databases of their own
+func (t *Tenancy) PerDatabase() bool {
+	return t != nil && t.client != nil
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tracer/internal/telemetry"
+)
+
+func newTestTenancy(setup func(ctx context.Context, db *mongo.Database) error) *Tenancy {
+	return NewDatabaseTenancy(nil, "tenant_", time.Second, setup)
+}
+
+func TestPrepareRunsSetupOncePerTenant(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	tenancy := newTestTenancy(func(context.Context, *mongo.Database) error {
+		runs.Add(1)
+		<-release
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = tenancy.prepare(context.Background(), "acme", nil)
+		}(i)
+	}
+	// Let every caller reach the in-flight run before it finishes
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("prepare() #%d error = %v", i, err)
+		}
+	}
+	if runs.Load() != 1 {
+		t.Errorf("setup ran %d times, want 1", runs.Load())
+	}
+	if err := tenancy.prepare(context.Background(), "acme", nil); err != nil || runs.Load() != 1 {
+		t.Errorf("prepare() after setup: error = %v, runs = %d", err, runs.Load())
+	}
+}
+
+func TestPrepareDoesNotBlockOtherTenants(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	tenancy := newTestTenancy(func(ctx context.Context, db *mongo.Database) error {
+		if telemetry.TenantFromContext(ctx) == "slow" {
+			<-release
+		}
+		return nil
+	})
+
+	go tenancy.prepare(telemetry.WithTenant(context.Background(), "slow"), "slow", nil)
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(telemetry.WithTenant(context.Background(), "fast"), 500*time.Millisecond)
+	defer cancel()
+	if err := tenancy.prepare(ctx, "fast", nil); err != nil {
+		t.Errorf("prepare() error = %v while another tenant is set up", err)
+	}
+}
+
+func TestPrepareReturnsWhenCallerGivesUp(t *testing.T) {
+	release := make(chan struct{})
+	tenancy := newTestTenancy(func(context.Context, *mongo.Database) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tenancy.prepare(ctx, "acme", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("prepare() error = %v, want deadline exceeded", err)
+	}
+
+	// The run carries on for the callers still waiting
+	close(release)
+	if err := tenancy.prepare(context.Background(), "acme", nil); err != nil {
+		t.Errorf("prepare() error = %v after setup finished", err)
+	}
+}
+
+func TestPrepareBoundsSetup(t *testing.T) {
+	tenancy := NewDatabaseTenancy(nil, "tenant_", 10*time.Millisecond, func(ctx context.Context, _ *mongo.Database) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := tenancy.prepare(context.Background(), "acme", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("prepare() error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestPrepareRetriesFailedSetup(t *testing.T) {
+	fail := errors.New("index build failed")
+	var runs atomic.Int32
+	tenancy := newTestTenancy(func(context.Context, *mongo.Database) error {
+		if runs.Add(1) == 1 {
+			return fail
+		}
+		return nil
+	})
+
+	if err := tenancy.prepare(context.Background(), "acme", nil); !errors.Is(err, fail) {
+		t.Errorf("first prepare() error = %v, want %v", err, fail)
+	}
+	if err := tenancy.prepare(context.Background(), "acme", nil); err != nil {
+		t.Errorf("second prepare() error = %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecordTimeout marks on the span which deadline cut a MongoDB operation short
+func RecordTimeout(ctx context.Context, span trace.Span, err error) {
+	if !IsTimeout(err) {
+		return
+	}
+
+	source := "operation"
+	if ctx.Err() != nil {
+		source = "request"
+	}
+	span.SetAttributes(attribute.String("db.timeout.source", source))
+}
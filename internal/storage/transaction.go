@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/telemetry"
+)
+
+// Transactor runs functions inside MongoDB multi-document transactions.
+// Transactions require MongoDB to run as a replica set.
+type Transactor struct {
+	client *mongo.Client
+	tracer telemetry.Tracer
+}
+
+func NewTransactor(client *mongo.Client, tracer telemetry.Tracer) *Transactor {
+	return &Transactor{client: client, tracer: tracer}
+}
+
+// WithTransaction runs fn in a transaction on a fresh session. Repository
+// calls made with the context passed to fn join the transaction. fn may run
+// more than once, since the driver retries transient transaction errors.
+// The session lifecycle is recorded as events on a mongo.transaction span.
+func (t *Transactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, span := t.tracer.Start(ctx, "mongo.transaction")
+	defer span.End()
+
+	session, err := t.client.StartSession()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("start session: %w", err)
+	}
+	span.AddEvent("session.started")
+	defer func() {
+		session.EndSession(ctx)
+		span.AddEvent("session.ended")
+	}()
+
+	attempts := 0
+	var hooks *commitHooks
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (any, error) {
+		attempts++
+		span.AddEvent("transaction.started", trace.WithAttributes(attribute.Int("db.transaction.attempt", attempts)))
+		// Hooks registered by an aborted attempt must not run
+		hooks = &commitHooks{}
+		return nil, fn(context.WithValue(sessCtx, commitHooksKey{}, hooks))
+	})
+	span.SetAttributes(attribute.Int("db.transaction.attempts", attempts))
+
+	if err != nil {
+		RecordTimeout(ctx, span, err)
+		span.AddEvent("transaction.aborted", trace.WithAttributes(attribute.String("error.message", err.Error())))
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	span.AddEvent("transaction.committed")
+	for _, hook := range hooks.fns {
+		hook(ctx)
+	}
+	return nil
+}
+
+type commitHooksKey struct{}
+
+// commitHooks collects the work deferred until a transaction commits
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func(ctx context.Context)
+}
+
+// AfterCommit runs fn once the transaction ctx belongs to has committed, and
+// never if it aborts. Outside a transaction fn runs right away. fn gets a
+// context that is no longer bound to the session.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	hooks, ok := ctx.Value(commitHooksKey{}).(*commitHooks)
+	if !ok {
+		fn(ctx)
+		return
+	}
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	hooks.fns = append(hooks.fns, fn)
+}
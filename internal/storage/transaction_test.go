@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAfterCommitRunsAtOnceOutsideTransactions(t *testing.T) {
+	ran := false
+	AfterCommit(context.Background(), func(context.Context) { ran = true })
+	if !ran {
+		t.Error("AfterCommit() did not run fn outside a transaction")
+	}
+}
+
+func TestAfterCommitDefersInsideTransactions(t *testing.T) {
+	hooks := &commitHooks{}
+	ctx := context.WithValue(context.Background(), commitHooksKey{}, hooks)
+
+	ran := false
+	AfterCommit(ctx, func(context.Context) { ran = true })
+	if ran {
+		t.Fatal("AfterCommit() ran fn before the commit")
+	}
+	if len(hooks.fns) != 1 {
+		t.Fatalf("hooks = %d, want 1", len(hooks.fns))
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"net/mail"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type User struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name  string             `bson:"name" json:"name" binding:"required,max=100"`
+	Email string             `bson:"email" json:"email" binding:"required,email,max=254"`
+
+	// Maintained by the repository on every write
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt" binding:"-"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt" binding:"-"`
+
+	// Set when the user is soft-deleted; cleared again on restore
+	DeletedAt *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty" binding:"-"`
+
+	// Owning tenant when tenants share collections; never set by clients
+	TenantID string `bson:"tenantId,omitempty" json:"-" binding:"-"`
+
+	// Incremented on every write. Documents written before versions were
+	// tracked have none and read as 0.
+	Version int64 `bson:"version" json:"version" binding:"-"`
+}
+
+// UserUpdate is the PUT and PATCH payload. Fields left out of the body stay
+// unchanged. Name and email can't be cleared, so sending either as null or
+// as an empty string is rejected rather than ignored.
+type UserUpdate struct {
+	Name  Optional[string] `json:"name" binding:"omitempty,max=100"`
+	Email Optional[string] `json:"email" binding:"omitempty,email,max=254"`
+
+	// Version the client last read. When set, the update is only applied
+	// if the stored user still has it; otherwise ErrVersionConflict.
+	Version *int64 `json:"version" binding:"omitempty,min=0"`
+}
+
+// SetDocument builds the $set document from the fields that were provided
+func (u UserUpdate) SetDocument() (bson.M, error) {
+	set := bson.M{}
+	if u.Name.Set {
+		switch {
+		case u.Name.Null:
+			return nil, errors.New("name must not be null")
+		case u.Name.Value == "":
+			return nil, errors.New("name must not be empty")
+		}
+		set["name"] = u.Name.Value
+	}
+	if u.Email.Set {
+		switch {
+		case u.Email.Null:
+			return nil, errors.New("email must not be null")
+		case u.Email.Value == "":
+			return nil, errors.New("email must not be empty")
+		}
+		if _, err := mail.ParseAddress(u.Email.Value); err != nil {
+			return nil, errors.New("email is not a valid address")
+		}
+		set["email"] = u.Email.Value
+	}
+
+	if len(set) == 0 {
+		return nil, errors.New("no fields to update")
+	}
+	return set, nil
+}
+
+// versionFilter matches documents at version. Version 0 also matches
+// documents without a version field.
+func versionFilter(version int64) any {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+// Now returns the current time at the millisecond precision MongoDB stores,
+// so timestamps read back compare equal to the ones that were written
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// Apply returns a copy of user with the provided fields overwritten
+func (u UserUpdate) Apply(user User) User {
+	if u.Name.Present() {
+		user.Name = u.Name.Value
+	}
+	if u.Email.Present() {
+		user.Email = u.Email.Value
+	}
+	return user
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUserUpdateSetDocument(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    bson.M
+		wantErr string
+	}{
+		{name: "name omitted", body: `{"email":"a@example.com"}`, want: bson.M{"email": "a@example.com"}},
+		{name: "email omitted", body: `{"name":"Alice"}`, want: bson.M{"name": "Alice"}},
+		{name: "both set", body: `{"name":"Alice","email":"a@example.com"}`, want: bson.M{"name": "Alice", "email": "a@example.com"}},
+		{name: "name null", body: `{"name":null,"email":"a@example.com"}`, wantErr: "name must not be null"},
+		{name: "email null", body: `{"name":"Alice","email":null}`, wantErr: "email must not be null"},
+		{name: "name empty", body: `{"name":""}`, wantErr: "name must not be empty"},
+		{name: "email empty", body: `{"email":""}`, wantErr: "email must not be empty"},
+		{name: "email invalid", body: `{"email":"not-an-address"}`, wantErr: "email is not a valid address"},
+		{name: "nothing to update", body: `{}`, wantErr: "no fields to update"},
+		{name: "only version", body: `{"version":3}`, wantErr: "no fields to update"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update UserUpdate
+			if err := json.Unmarshal([]byte(tt.body), &update); err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v", tt.body, err)
+			}
+
+			set, err := update.SetDocument()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("SetDocument() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetDocument() error = %v", err)
+			}
+			if !reflect.DeepEqual(set, tt.want) {
+				t.Errorf("SetDocument() = %v, want %v", set, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionalTracksPresence(t *testing.T) {
+	tests := []struct {
+		body              string
+		wantSet, wantNull bool
+		wantValue         string
+		wantPresent       bool
+	}{
+		{body: `{}`},
+		{body: `{"name":null}`, wantSet: true, wantNull: true},
+		{body: `{"name":""}`, wantSet: true, wantPresent: true},
+		{body: `{"name":"Bob"}`, wantSet: true, wantValue: "Bob", wantPresent: true},
+	}
+
+	for _, tt := range tests {
+		var update UserUpdate
+		if err := json.Unmarshal([]byte(tt.body), &update); err != nil {
+			t.Fatalf("Unmarshal(%s) error = %v", tt.body, err)
+		}
+
+		got := update.Name
+		if got.Set != tt.wantSet || got.Null != tt.wantNull || got.Value != tt.wantValue || got.Present() != tt.wantPresent {
+			t.Errorf("%s: Name = %+v (present %v), want set=%v null=%v value=%q present=%v",
+				tt.body, got, got.Present(), tt.wantSet, tt.wantNull, tt.wantValue, tt.wantPresent)
+		}
+	}
+}
+
+func TestUserUpdateApplyKeepsOmittedFields(t *testing.T) {
+	user := User{Name: "Alice", Email: "alice@example.com"}
+
+	got := UserUpdate{Email: Some("new@example.com")}.Apply(user)
+	if got.Name != "Alice" || got.Email != "new@example.com" {
+		t.Errorf("Apply() = %+v, want name kept and email replaced", got)
+	}
+}
@@ -0,0 +1,55 @@
+package telemetry
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// AccessLog writes one structured line per request once it has been
+// served, skipping the excluded paths. It must run after RequestID, so the
+// line carries request_id, and the tracing hook adds trace_id and span_id.
+// Server errors log at error, client errors at warn and the rest at info.
+func AccessLog(excluded []string) gin.HandlerFunc {
+	skip := make(map[string]struct{}, len(excluded))
+	for _, path := range excluded {
+		skip[path] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		if _, found := skip[c.Request.URL.Path]; found {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := zerolog.InfoLevel
+		switch {
+		case status >= 500:
+			level = zerolog.ErrorLevel
+		case status >= 400:
+			level = zerolog.WarnLevel
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		log.Ctx(c.Request.Context()).WithLevel(level).
+			Str("method", c.Request.Method).
+			Str("route", route).
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("size", max(c.Writer.Size(), 0)).
+			Str("clientIp", c.ClientIP()).
+			Str("userAgent", c.Request.UserAgent()).
+			Msg("Request served")
+	}
+}
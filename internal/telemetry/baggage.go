@@ -0,0 +1,70 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Baggage members set by upstream callers
+const (
+	BaggageTenantID      = "tenant.id"
+	BaggageCallerService = "caller.service"
+)
+
+// BaggageValue returns the baggage member key from ctx, or "" when the
+// caller did not send it. Baggage comes from the caller and is not verified.
+func BaggageValue(ctx context.Context, key string) string {
+	return baggage.FromContext(ctx).Member(key).Value()
+}
+
+// TenantID returns the tenant.id baggage member
+func TenantID(ctx context.Context) string {
+	return BaggageValue(ctx, BaggageTenantID)
+}
+
+// CallerService returns the caller.service baggage member
+func CallerService(ctx context.Context) string {
+	return BaggageValue(ctx, BaggageCallerService)
+}
+
+// WithBaggageFields copies the given baggage members onto the active span and
+// the context logger. Baggage itself stays in ctx, so instrumented outbound
+// calls forward it through the global propagator.
+func WithBaggageFields(ctx context.Context, keys []string) context.Context {
+	bag := baggage.FromContext(ctx)
+	if bag.Len() == 0 {
+		return ctx
+	}
+
+	var attrs []attribute.KeyValue
+	fields := log.Ctx(ctx).With()
+	for _, key := range keys {
+		member := bag.Member(key)
+		if member.Key() == "" {
+			continue
+		}
+		attrs = append(attrs, attribute.String(key, member.Value()))
+		fields = fields.Str(key, member.Value())
+	}
+	if len(attrs) == 0 {
+		return ctx
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+	logger := fields.Logger()
+	return logger.WithContext(ctx)
+}
+
+// Baggage applies WithBaggageFields to each request. It must run after
+// ContextLogger.
+func Baggage(keys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithBaggageFields(c.Request.Context(), keys))
+		c.Next()
+	}
+}
@@ -0,0 +1,140 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// How often a collector that keeps failing is reported again
+const exportFailureLogInterval = time.Minute
+
+// healthExporter tracks whether spans reach the collector. The exporter
+// itself reconnects in the background, so this only reports the outcome of
+// each export: once when exports start failing, every
+// exportFailureLogInterval while they keep failing and once when they
+// recover.
+type healthExporter struct {
+	sdktrace.SpanExporter
+	name string
+
+	// Spans accepted by the collector and spans lost to failed exports
+	exported atomic.Int64
+	failed   atomic.Int64
+	dropped  metric.Int64Counter
+
+	mu           sync.Mutex
+	healthy      bool
+	failingSince time.Time
+	lastLogged   time.Time
+}
+
+// withExportHealth wraps exporter and registers the trace.exporter.healthy
+// gauge, which is 1 until an export fails. The gauge is created on the
+// global meter provider and is exported once InitMeter has run.
+func withExportHealth(exporter sdktrace.SpanExporter, name string) (*healthExporter, error) {
+	e := &healthExporter{SpanExporter: exporter, name: name, healthy: true}
+	meter := otel.Meter(instrumentationName)
+
+	var err error
+	e.dropped, err = meter.Int64Counter("trace.exporter.dropped_spans",
+		metric.WithDescription("Number of spans that were never exported, by failed export or shutdown"),
+		metric.WithUnit("{span}"))
+	if err != nil {
+		return nil, fmt.Errorf("create trace.exporter.dropped_spans counter: %w", err)
+	}
+
+	_, err = meter.Int64ObservableGauge("trace.exporter.healthy",
+		metric.WithDescription("Whether the last span export succeeded (1) or failed (0)"),
+		metric.WithUnit("1"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			var value int64
+			if e.isHealthy() {
+				value = 1
+			}
+			o.Observe(value, metric.WithAttributes(attribute.String("exporter", name)))
+			return nil
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("create trace.exporter.healthy gauge: %w", err)
+	}
+	return e, nil
+}
+
+func (e *healthExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		e.failed.Add(int64(len(spans)))
+		e.dropped.Add(ctx, int64(len(spans)), metric.WithAttributes(
+			attribute.String("exporter", e.name),
+			attribute.String("reason", "export_failed"),
+		))
+	} else {
+		e.exported.Add(int64(len(spans)))
+	}
+	e.record(err, len(spans))
+	return err
+}
+
+// queueCounter counts the spans handed to the batch processor, so spans
+// still queued when the tracer shuts down can be told apart from exported ones
+type queueCounter struct {
+	sdktrace.SpanProcessor
+	queued atomic.Int64
+}
+
+func (p *queueCounter) OnEnd(s sdktrace.ReadOnlySpan) {
+	// The batch processor ignores unsampled spans as well
+	if s.SpanContext().IsSampled() {
+		p.queued.Add(1)
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+// reportUnexported records the spans that were queued but never reached an
+// export attempt, and returns how many spans were lost in total
+func (e *healthExporter) reportUnexported(ctx context.Context, queued int64) (unexported, failed int64) {
+	failed = e.failed.Load()
+	unexported = queued - e.exported.Load() - failed
+	if unexported <= 0 {
+		return 0, failed
+	}
+	e.dropped.Add(ctx, unexported, metric.WithAttributes(
+		attribute.String("exporter", e.name),
+		attribute.String("reason", "shutdown"),
+	))
+	return unexported, failed
+}
+
+func (e *healthExporter) isHealthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.healthy
+}
+
+func (e *healthExporter) record(err error, spans int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	switch {
+	case err == nil && !e.healthy:
+		e.healthy = true
+		log.Info().Str("exporter", e.name).Dur("downtime", now.Sub(e.failingSince)).Msg("Span exports recovered")
+	case err != nil && e.healthy:
+		e.healthy = false
+		e.failingSince, e.lastLogged = now, now
+		log.Warn().Err(err).Str("exporter", e.name).Int("spans", spans).Msg("Span export failed, retrying in the background")
+	case err != nil && now.Sub(e.lastLogged) >= exportFailureLogInterval:
+		e.lastLogged = now
+		log.Warn().Err(err).Str("exporter", e.name).Dur("downtime", now.Sub(e.failingSince)).Msg("Span exports still failing")
+	}
+}
@@ -0,0 +1,159 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/diode"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"tracer/internal/config"
+)
+
+// SetupLogging installs the global zerolog logger. The returned function
+// flushes buffered log lines and must run before the process exits.
+func SetupLogging(cfg config.LoggingConfig, resources *resource.Resource) (func(), error) {
+	if _, err := SetLogLevel(cfg.Level); err != nil {
+		return nil, err
+	}
+
+	// Multi-writer for both console and file
+	consoleWriter := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
+	writers := []io.Writer{consoleWriter}
+
+	// Buffer file writes so a slow or full disk drops log lines instead of
+	// blocking request handling. Without a file, as in containers, logs
+	// only go to stdout.
+	var fileWriter io.Closer
+	if cfg.File != "" {
+		rotated := &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.Rotation.MaxSizeMB,
+			MaxBackups: cfg.Rotation.MaxBackups,
+			MaxAge:     cfg.Rotation.MaxAgeDays,
+			Compress:   cfg.Rotation.Compress,
+		}
+		// Open the file now so a bad path fails startup instead of every write
+		if _, err := rotated.Write(nil); err != nil {
+			return nil, fmt.Errorf("open log file: %w", err)
+		}
+		diodeWriter := newBufferedWriter(rotated, cfg.BufferSize)
+		fileWriter = diodeWriter
+		writers = append(writers, diodeWriter)
+	}
+
+	// Ship logs to the collector as well when an OTLP endpoint is configured
+	var provider *sdklog.LoggerProvider
+	if cfg.OTLPEndpoint != "" {
+		// host:port endpoints stay plaintext; URLs pick TLS by their scheme
+		opts := []otlploggrpc.Option{otlploggrpc.WithInsecure(), otlploggrpc.WithEndpoint(cfg.OTLPEndpoint)}
+		if isEndpointURL(cfg.OTLPEndpoint) {
+			opts = []otlploggrpc.Option{otlploggrpc.WithEndpointURL(cfg.OTLPEndpoint)}
+		}
+		exporter, err := otlploggrpc.New(context.Background(), opts...)
+		if err != nil {
+			if fileWriter != nil {
+				fileWriter.Close()
+			}
+			return nil, fmt.Errorf("create log exporter: %w", err)
+		}
+
+		provider = sdklog.NewLoggerProvider(
+			sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+			sdklog.WithResource(resources),
+		)
+		writers = append(writers, newOTelLogWriter(provider.Logger(instrumentationName)))
+	}
+
+	multi := zerolog.MultiLevelWriter(writers...)
+
+	log.Logger = zerolog.New(multi).Hook(tracingHook{}).With().Timestamp().Caller().Logger()
+
+	// Enable caller tracking
+	log.Logger = log.With().Caller().Logger()
+
+	return func() {
+		if provider != nil {
+			if err := provider.Shutdown(context.Background()); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to shutdown LoggerProvider: %v\n", err)
+			}
+		}
+
+		// Closing the diode flushes pending messages and closes the file
+		if fileWriter != nil {
+			fileWriter.Close()
+		}
+	}, nil
+}
+
+// newBufferedWriter puts a buffer of size log lines in front of w, so
+// writes never wait for it. Lines that do not fit are dropped and counted
+// on stderr.
+func newBufferedWriter(w io.Writer, size int) diode.Writer {
+	return diode.NewWriter(w, size, 10*time.Millisecond, func(missed int) {
+		fmt.Fprintf(os.Stderr, "Dropped %d log messages\n", missed)
+	})
+}
+
+// SetLogLevel changes the global log level to one of config.LogLevels and
+// returns the previous one
+func SetLogLevel(name string) (string, error) {
+	level, err := zerolog.ParseLevel(name)
+	if err != nil || !slices.Contains(config.LogLevels, name) {
+		return "", fmt.Errorf("unknown log level %q", name)
+	}
+	previous := LogLevel()
+	zerolog.SetGlobalLevel(level)
+	return previous, nil
+}
+
+// LogLevel returns the global log level
+func LogLevel() string {
+	return zerolog.GlobalLevel().String()
+}
+
+// tracingHook stamps the trace and span IDs from the event's context on every
+// log line, so entries in app.log can be looked up in Jaeger
+type tracingHook struct{}
+
+func (tracingHook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	sc := trace.SpanContextFromContext(e.GetCtx())
+	if !sc.IsValid() {
+		return
+	}
+
+	e.Str("trace_id", sc.TraceID().String()).Str("span_id", sc.SpanID().String())
+}
+
+// WithLogger stores a logger bound to ctx, so events from log.Ctx(ctx) carry
+// the span that is active in ctx. Fields already added to the context logger,
+// such as the authenticated user, are kept.
+func WithLogger(ctx context.Context) context.Context {
+	base := zerolog.Ctx(ctx)
+	if base.GetLevel() == zerolog.Disabled {
+		base = &log.Logger
+	}
+
+	logger := base.With().Ctx(ctx).Logger()
+	return logger.WithContext(ctx)
+}
+
+// ContextLogger binds the request context logger to the server span started
+// by otelgin, covering log lines written by middleware
+func ContextLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithLogger(c.Request.Context()))
+		c.Next()
+	}
+}
@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// failingWriter fails every write, like a file on a full disk
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, syscall.ENOSPC
+}
+
+// stallingWriter blocks every write until released, like a hung mount
+type stallingWriter struct {
+	release chan struct{}
+}
+
+func (w stallingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func TestBufferedLogWriterDoesNotHoldUpRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stalled := stallingWriter{release: make(chan struct{})}
+	tests := []struct {
+		name    string
+		target  io.Writer
+		release func()
+	}{
+		{name: "failing", target: failingWriter{}, release: func() {}},
+		{name: "stalling", target: stalled, release: func() { close(stalled.release) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := newBufferedWriter(tt.target, 16)
+			defer func() {
+				// Close waits for the line being written
+				tt.release()
+				writer.Close()
+			}()
+			logger := zerolog.New(writer)
+
+			router := gin.New()
+			router.GET("/users", func(c *gin.Context) {
+				for i := 0; i < 100; i++ {
+					logger.Info().Int("line", i).Msg("Listing users")
+				}
+				c.Status(http.StatusOK)
+			})
+
+			done := make(chan int)
+			go func() {
+				for i := 0; i < 20; i++ {
+					rec := httptest.NewRecorder()
+					router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+					if rec.Code != http.StatusOK {
+						done <- rec.Code
+						return
+					}
+				}
+				done <- http.StatusOK
+			}()
+
+			select {
+			case status := <-done:
+				if status != http.StatusOK {
+					t.Errorf("status = %d, want %d", status, http.StatusOK)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("requests blocked on the log writer")
+			}
+		})
+	}
+}
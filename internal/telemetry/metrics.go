@@ -0,0 +1,194 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/host"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"tracer/internal/config"
+)
+
+// InitMeter registers a meter provider that either serves metrics on
+// /metrics for Prometheus or pushes them to an OTLP collector, and starts
+// the runtime and host instrumentation. The returned function flushes
+// pending metrics.
+func InitMeter(cfg config.MetricsConfig, resources *resource.Resource) (func(context.Context) error, error) {
+	// Exemplars are experimental in this SDK release and only switched on
+	// through the environment, which is read when instruments are created
+	if cfg.Exemplars {
+		if err := os.Setenv("OTEL_GO_X_EXEMPLAR", "true"); err != nil {
+			return nil, fmt.Errorf("enable exemplars: %w", err)
+		}
+	}
+
+	var reader sdkmetric.Reader
+	switch cfg.Exporter {
+	case config.MetricsExporterOTLP:
+		// host:port endpoints stay plaintext; URLs pick TLS by their scheme
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithInsecure(), otlpmetricgrpc.WithEndpoint(cfg.Endpoint)}
+		if isEndpointURL(cfg.Endpoint) {
+			opts = []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpointURL(cfg.Endpoint)}
+		}
+		exporter, err := otlpmetricgrpc.New(context.Background(), opts...)
+		if err != nil {
+			return nil, err
+		}
+		reader = sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(cfg.Interval))
+	default:
+		exporter, err := prometheus.New()
+		if err != nil {
+			return nil, err
+		}
+		reader = exporter
+	}
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resources),
+	)
+
+	otel.SetMeterProvider(provider)
+
+	// Go runtime (GC, goroutines, memory) and host (CPU, memory, network)
+	// metrics, collected on each export
+	if err := runtime.Start(runtime.WithMeterProvider(provider)); err != nil {
+		return nil, fmt.Errorf("start runtime metrics: %w", err)
+	}
+	if err := host.Start(host.WithMeterProvider(provider)); err != nil {
+		return nil, fmt.Errorf("start host metrics: %w", err)
+	}
+
+	return provider.Shutdown, nil
+}
+
+// NewMeter returns a meter backed by the global meter provider
+func NewMeter() metric.Meter {
+	return otel.Meter(instrumentationName)
+}
+
+// Metrics holds the business counters recorded by the service and handlers
+type Metrics struct {
+	UsersCreated metric.Int64Counter
+	UsersDeleted metric.Int64Counter
+	MongoErrors  metric.Int64Counter
+
+	// Lookups in the user cache, by cache.result
+	CacheRequests metric.Int64Counter
+
+	// Transitions of the MongoDB circuit breaker, by the state entered
+	BreakerStateChanges metric.Int64Counter
+}
+
+func NewMetrics(meter metric.Meter) (*Metrics, error) {
+	var m Metrics
+	var err error
+
+	m.UsersCreated, err = meter.Int64Counter("users.created",
+		metric.WithDescription("Number of users created"),
+		metric.WithUnit("{user}"))
+	if err != nil {
+		return nil, fmt.Errorf("create users.created counter: %w", err)
+	}
+
+	m.UsersDeleted, err = meter.Int64Counter("users.deleted",
+		metric.WithDescription("Number of users deleted"),
+		metric.WithUnit("{user}"))
+	if err != nil {
+		return nil, fmt.Errorf("create users.deleted counter: %w", err)
+	}
+
+	m.MongoErrors, err = meter.Int64Counter("mongo.errors",
+		metric.WithDescription("Number of failed MongoDB operations"),
+		metric.WithUnit("{error}"))
+	if err != nil {
+		return nil, fmt.Errorf("create mongo.errors counter: %w", err)
+	}
+
+	m.CacheRequests, err = meter.Int64Counter("cache.requests",
+		metric.WithDescription("Number of user cache lookups, by hit or miss"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, fmt.Errorf("create cache.requests counter: %w", err)
+	}
+
+	m.BreakerStateChanges, err = meter.Int64Counter("breaker.state_changes",
+		metric.WithDescription("Number of circuit breaker state changes, by new state"),
+		metric.WithUnit("{change}"))
+	if err != nil {
+		return nil, fmt.Errorf("create breaker.state_changes counter: %w", err)
+	}
+
+	// Breaker state changes are not caused by any one tenant
+	m.UsersCreated = tenantCounter{m.UsersCreated}
+	m.UsersDeleted = tenantCounter{m.UsersDeleted}
+	m.MongoErrors = tenantCounter{m.MongoErrors}
+	m.CacheRequests = tenantCounter{m.CacheRequests}
+
+	return &m, nil
+}
+
+// MetricsMiddleware records request count, latency and in-flight requests
+// labeled by route, method and status code
+func MetricsMiddleware(meter metric.Meter) (gin.HandlerFunc, error) {
+	requests, err := meter.Int64Counter("http.server.request.count",
+		metric.WithDescription("Number of HTTP requests handled"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, fmt.Errorf("create request counter: %w", err)
+	}
+
+	duration, err := meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of HTTP requests"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, fmt.Errorf("create request duration histogram: %w", err)
+	}
+
+	inFlight, err := meter.Int64UpDownCounter("http.server.active_requests",
+		metric.WithDescription("Number of HTTP requests in flight"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, fmt.Errorf("create in-flight gauge: %w", err)
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		ctx := c.Request.Context()
+
+		// Label by route template rather than raw path to keep cardinality bounded
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		routeAttrs := []attribute.KeyValue{
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+		}
+
+		inFlight.Add(ctx, 1, metric.WithAttributes(routeAttrs...))
+		defer inFlight.Add(ctx, -1, metric.WithAttributes(routeAttrs...))
+
+		c.Next()
+
+		resultAttrs := append(routeAttrs, attribute.Int("http.response.status_code", c.Writer.Status()))
+		// Set by a later middleware, so read from the updated request
+		if tenant := TenantFromContext(c.Request.Context()); tenant != "" {
+			resultAttrs = append(resultAttrs, attribute.String(TenantAttribute, tenant))
+		}
+		attrs := metric.WithAttributes(resultAttrs...)
+		requests.Add(ctx, 1, attrs)
+		duration.Record(ctx, time.Since(start).Seconds(), attrs)
+	}, nil
+}
@@ -0,0 +1,120 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/rs/zerolog"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otelLogWriter adapts zerolog's JSON output to OpenTelemetry log records.
+// The trace_id and span_id fields stamped by tracingHook are turned back into
+// a span context so the collector correlates each record with its trace.
+type otelLogWriter struct {
+	logger otellog.Logger
+}
+
+func newOTelLogWriter(logger otellog.Logger) otelLogWriter {
+	return otelLogWriter{logger: logger}
+}
+
+func (w otelLogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w otelLogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return 0, err
+	}
+
+	var record otellog.Record
+	record.SetObservedTimestamp(time.Now())
+	record.SetTimestamp(time.Now())
+	record.SetSeverity(otelSeverity(level))
+	record.SetSeverityText(level.String())
+
+	ctx := context.Background()
+	if sc, ok := spanContextFromFields(fields); ok {
+		ctx = trace.ContextWithSpanContext(ctx, sc)
+	}
+
+	for key, value := range fields {
+		switch key {
+		case zerolog.MessageFieldName:
+			if msg, ok := value.(string); ok {
+				record.SetBody(otellog.StringValue(msg))
+			}
+		case zerolog.TimestampFieldName:
+			if ts, ok := value.(string); ok {
+				if parsed, err := time.Parse(zerolog.TimeFieldFormat, ts); err == nil {
+					record.SetTimestamp(parsed)
+				}
+			}
+		case zerolog.LevelFieldName, "trace_id", "span_id":
+			// Carried by the record's severity and context instead
+		default:
+			record.AddAttributes(otellog.KeyValue{Key: key, Value: otelValue(value)})
+		}
+	}
+
+	w.logger.Emit(ctx, record)
+	return len(p), nil
+}
+
+func spanContextFromFields(fields map[string]any) (trace.SpanContext, bool) {
+	traceHex, _ := fields["trace_id"].(string)
+	spanHex, _ := fields["span_id"].(string)
+
+	traceID, err := trace.TraceIDFromHex(traceHex)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+	spanID, err := trace.SpanIDFromHex(spanHex)
+	if err != nil {
+		return trace.SpanContext{}, false
+	}
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}), true
+}
+
+func otelSeverity(level zerolog.Level) otellog.Severity {
+	switch level {
+	case zerolog.TraceLevel:
+		return otellog.SeverityTrace
+	case zerolog.DebugLevel:
+		return otellog.SeverityDebug
+	case zerolog.InfoLevel:
+		return otellog.SeverityInfo
+	case zerolog.WarnLevel:
+		return otellog.SeverityWarn
+	case zerolog.ErrorLevel:
+		return otellog.SeverityError
+	case zerolog.FatalLevel, zerolog.PanicLevel:
+		return otellog.SeverityFatal
+	default:
+		return otellog.SeverityUndefined
+	}
+}
+
+func otelValue(value any) otellog.Value {
+	switch v := value.(type) {
+	case string:
+		return otellog.StringValue(v)
+	case bool:
+		return otellog.BoolValue(v)
+	case float64:
+		return otellog.Float64Value(v)
+	default:
+		// Nested objects and arrays are kept as their JSON text
+		data, _ := json.Marshal(v)
+		return otellog.StringValue(string(data))
+	}
+}
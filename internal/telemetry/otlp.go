@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"tracer/internal/config"
+)
+
+// otlpTLSConfig builds the client TLS settings for the OTLP collector
+// connection. It returns nil when TLS is off.
+func otlpTLSConfig(cfg config.OTLPTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.ServerName,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read OTLP CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("OTLP CA file contains no certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load OTLP client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// isEndpointURL reports whether an OTLP endpoint is a URL rather than
+// host:port. URLs are handed to the exporters whole, so a path such as a
+// gateway prefix is kept, and their scheme decides whether TLS is used.
+func isEndpointURL(endpoint string) bool {
+	return strings.Contains(endpoint, "://")
+}
+
+// isSecureEndpoint reports whether an endpoint asks for TLS by its scheme
+func isSecureEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "https://")
+}
+
+// CollectorAddress returns the host:port an OTLP endpoint connects to, for
+// checking that the collector accepts connections
+func CollectorAddress(endpoint string) string {
+	if !isEndpointURL(endpoint) {
+		return endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
@@ -0,0 +1,122 @@
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/config"
+)
+
+const redactedValue = "[REDACTED]"
+
+// PayloadLogger records request and response bodies, capped at MaxBytes, as
+// a span event and a debug log line. Only bodies that parse as JSON are
+// recorded, after redaction, so truncated or binary payloads can't leak
+// fields that should have been masked.
+func PayloadLogger(cfg config.PayloadLoggingConfig) gin.HandlerFunc {
+	redact := make(map[string]struct{}, len(cfg.RedactFields))
+	for _, field := range cfg.RedactFields {
+		redact[strings.ToLower(field)] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		var request []byte
+		if c.Request.Body != nil {
+			// Put the captured prefix back in front of the unread rest
+			request, _ = io.ReadAll(io.LimitReader(c.Request.Body, int64(cfg.MaxBytes)+1))
+			c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(request), c.Request.Body), c.Request.Body}
+		}
+
+		writer := &capturingWriter{ResponseWriter: c.Writer, limit: cfg.MaxBytes + 1}
+		c.Writer = writer
+
+		c.Next()
+
+		requestBody := redactPayload(request, cfg.MaxBytes, redact)
+		responseBody := redactPayload(writer.body.Bytes(), cfg.MaxBytes, redact)
+
+		ctx := c.Request.Context()
+		trace.SpanFromContext(ctx).AddEvent("http.payload", trace.WithAttributes(
+			attribute.String("http.request.body", requestBody),
+			attribute.String("http.response.body", responseBody),
+		))
+		log.Ctx(ctx).Debug().
+			Str("request_body", requestBody).
+			Str("response_body", responseBody).
+			Msg("Request payload")
+	}
+}
+
+// redactPayload masks redacted fields in a JSON body. Bodies longer than
+// maxBytes were truncated and are omitted like any other non-JSON body.
+func redactPayload(body []byte, maxBytes int, redact map[string]struct{}) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) > maxBytes {
+		return "[omitted: larger than maxBytes]"
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "[omitted: not JSON]"
+	}
+
+	out, err := json.Marshal(redactValue(value, redact))
+	if err != nil {
+		return "[omitted: not JSON]"
+	}
+	return string(out)
+}
+
+func redactValue(value any, redact map[string]struct{}) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if _, ok := redact[strings.ToLower(key)]; ok {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = redactValue(field, redact)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item, redact)
+		}
+	}
+	return value
+}
+
+// capturingWriter copies the first limit bytes of the response body
+type capturingWriter struct {
+	gin.ResponseWriter
+	body  bytes.Buffer
+	limit int
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	if remaining := w.limit - w.body.Len(); remaining > 0 {
+		w.body.Write(b[:min(len(b), remaining)])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	if remaining := w.limit - w.body.Len(); remaining > 0 {
+		w.body.WriteString(s[:min(len(s), remaining)])
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// readCloser reads from a replacement reader but closes the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
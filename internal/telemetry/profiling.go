@@ -0,0 +1,29 @@
+package telemetry
+
+import (
+	"github.com/grafana/pyroscope-go"
+
+	"tracer/internal/config"
+)
+
+// StartProfiling continuously uploads CPU, memory and goroutine profiles to
+// Pyroscope. The returned function flushes and stops the profiler.
+func StartProfiling(cfg config.ProfilingConfig, tracing config.TracingConfig) (func() error, error) {
+	profiler, err := pyroscope.Start(pyroscope.Config{
+		ApplicationName: tracing.ServiceName,
+		ServerAddress:   cfg.ServerAddress,
+		Tags:            map[string]string{"service_version": serviceVersion(tracing)},
+		ProfileTypes: []pyroscope.ProfileType{
+			pyroscope.ProfileCPU,
+			pyroscope.ProfileAllocObjects,
+			pyroscope.ProfileAllocSpace,
+			pyroscope.ProfileInuseObjects,
+			pyroscope.ProfileInuseSpace,
+			pyroscope.ProfileGoroutines,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profiler.Stop, nil
+}
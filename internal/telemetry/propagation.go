@@ -0,0 +1,31 @@
+package telemetry
+
+import (
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+
+	"tracer/internal/config"
+)
+
+// newPropagator combines the configured header formats. Extraction tries
+// each in order and the last one that finds a span context wins, while
+// injection writes all of them.
+func newPropagator(names []string) propagation.TextMapPropagator {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		switch name {
+		case config.PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case config.PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case config.PropagatorB3:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case config.PropagatorB3Multi:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case config.PropagatorJaeger:
+			propagators = append(propagators, jaeger.Jaeger{})
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...)
+}
@@ -0,0 +1,110 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorReporter forwards panics and server errors to an external error
+// tracker such as Sentry
+type ErrorReporter interface {
+	Report(ctx context.Context, err error, tags map[string]string)
+}
+
+// NoopReporter discards every report. Swap in a real reporter at startup to
+// integrate an error tracker.
+type NoopReporter struct{}
+
+func (NoopReporter) Report(context.Context, error, map[string]string) {}
+
+// WithTraceID wraps reporter so every report is tagged with the active trace
+// ID and links back to Jaeger
+func WithTraceID(reporter ErrorReporter) ErrorReporter {
+	return traceReporter{next: reporter}
+}
+
+type traceReporter struct {
+	next ErrorReporter
+}
+
+func (r traceReporter) Report(ctx context.Context, err error, tags map[string]string) {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		tags["trace_id"] = sc.TraceID().String()
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		tags["request_id"] = id
+	}
+
+	r.next.Report(ctx, err, tags)
+}
+
+// Recovery replaces gin.Recovery so panics are recorded on the active span
+// as an exception event with its stack trace, logged with the trace ID and
+// sent to the error reporter. It must run after the otelgin middleware for
+// the span to be available.
+func Recovery(reporter ErrorReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// Used to abort a response on purpose; net/http handles it
+				panic(recovered)
+			}
+
+			stack := string(debug.Stack())
+			err, ok := recovered.(error)
+			if !ok {
+				err = fmt.Errorf("panic: %v", recovered)
+			}
+
+			ctx := c.Request.Context()
+			span := trace.SpanFromContext(ctx)
+			span.RecordError(err, trace.WithAttributes(
+				semconv.ExceptionStacktraceKey.String(stack),
+				semconv.ExceptionEscapedKey.Bool(true),
+			))
+			span.SetStatus(codes.Error, "panic")
+
+			log.Ctx(ctx).Error().Err(err).Str("path", c.Request.URL.Path).Str("stack", stack).Msg("Recovered from panic")
+			reporter.Report(ctx, err, map[string]string{
+				"method": c.Request.Method,
+				"route":  c.FullPath(),
+			})
+
+			// Nothing can be sent once the client is gone
+			if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+				c.Abort()
+				return
+			}
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+
+			// Same envelope as the handlers' error responses
+			body := gin.H{"code": "internal", "message": "Internal server error"}
+			if sc := span.SpanContext(); sc.IsValid() {
+				body["trace_id"] = sc.TraceID().String()
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, body)
+		}()
+
+		c.Next()
+	}
+}
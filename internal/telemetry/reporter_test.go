@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeReporter keeps every report it receives
+type fakeReporter struct {
+	mu      sync.Mutex
+	reports []report
+}
+
+type report struct {
+	err  error
+	tags map[string]string
+}
+
+func (r *fakeReporter) Report(_ context.Context, err error, tags map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, report{err: err, tags: tags})
+}
+
+func TestRecoveryReportsPanics(t *testing.T) {
+	router, spans := newTracedRouter(t, nil, false)
+	reporter := &fakeReporter{}
+	router.Use(Recovery(WithTraceID(reporter)))
+	router.GET("/users/:id", func(*gin.Context) { panic("boom") })
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if len(reporter.reports) != 1 {
+		t.Fatalf("reports = %d, want 1", len(reporter.reports))
+	}
+
+	got := reporter.reports[0]
+	if got.err == nil || got.err.Error() != "panic: boom" {
+		t.Errorf("reported error = %v, want panic: boom", got.err)
+	}
+	if got.tags["route"] != "/users/:id" || got.tags["method"] != http.MethodGet {
+		t.Errorf("tags = %v, want route /users/:id and method GET", got.tags)
+	}
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("spans = %d, want 1", len(ended))
+	}
+	if want := ended[0].SpanContext().TraceID().String(); got.tags["trace_id"] != want {
+		t.Errorf("trace_id tag = %q, want %q", got.tags["trace_id"], want)
+	}
+}
+
+func TestRecoveryDoesNotReportHealthyRequests(t *testing.T) {
+	router, _ := newTracedRouter(t, nil, false)
+	reporter := &fakeReporter{}
+	router.Use(Recovery(reporter))
+	router.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	if len(reporter.reports) != 0 {
+		t.Errorf("reports = %d, want 0", len(reporter.reports))
+	}
+}
@@ -0,0 +1,67 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Longest incoming request ID that is honoured
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID honours the caller's X-Request-ID or generates one, then puts it
+// on the span, every log line of the request and the response headers. It
+// must run after ContextLogger.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		ctx := c.Request.Context()
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request_id", id))
+
+		logger := log.Ctx(ctx).With().Str("request_id", id).Logger()
+		ctx = context.WithValue(logger.WithContext(ctx), requestIDKey{}, id)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// RequestIDFromContext returns the ID set by RequestID, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand only fails when the OS has no entropy source at all
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts printable ASCII only, so IDs are safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package telemetry
+
+import (
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"tracer/internal/config"
+)
+
+// newSampler builds the sampler named in the config, which Validate has
+// already checked
+func newSampler(cfg config.TracingConfig) sdktrace.Sampler {
+	switch cfg.Sampler {
+	case config.SamplerAlwaysOff:
+		return sdktrace.NeverSample()
+	case config.SamplerTraceIDRatio:
+		return sdktrace.TraceIDRatioBased(cfg.SamplerRatio)
+	case config.SamplerParentBasedAlwaysOn:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	case config.SamplerParentBasedAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	case config.SamplerParentBasedTraceIDRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SamplerRatio))
+	case config.SamplerRules:
+		return newRuleSampler(cfg.SamplingRules, cfg.SamplerRatio)
+	default:
+		return sdktrace.AlwaysSample()
+	}
+}
+
+// ruleSampler picks a ratio for new traces by route and method. Traces it
+// does not sample are still recorded, so keepSlowAndFailed can export their
+// spans once the outcome is known.
+type ruleSampler struct {
+	rules    []samplingRule
+	fallback sdktrace.Sampler
+}
+
+type samplingRule struct {
+	method  string
+	route   string
+	sampler sdktrace.Sampler
+}
+
+func newRuleSampler(rules []config.SamplingRule, fallback float64) *ruleSampler {
+	s := &ruleSampler{fallback: sdktrace.TraceIDRatioBased(fallback)}
+	for _, rule := range rules {
+		s.rules = append(s.rules, samplingRule{
+			method:  rule.Method,
+			route:   rule.Route,
+			sampler: sdktrace.TraceIDRatioBased(rule.Ratio),
+		})
+	}
+	return s
+}
+
+func (s *ruleSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	if parent.IsValid() {
+		switch {
+		case parent.IsSampled():
+			return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: parent.TraceState()}
+		case !parent.IsRemote() && trace.SpanFromContext(p.ParentContext).IsRecording():
+			// Unsampled local trace that may still be kept on failure
+			return sdktrace.SamplingResult{Decision: sdktrace.RecordOnly, Tracestate: parent.TraceState()}
+		default:
+			return sdktrace.SamplingResult{Decision: sdktrace.Drop, Tracestate: parent.TraceState()}
+		}
+	}
+
+	result := s.match(p).ShouldSample(p)
+	if result.Decision == sdktrace.Drop {
+		result.Decision = sdktrace.RecordOnly
+	}
+	return result
+}
+
+// match returns the sampler of the first rule for the span's route, which
+// otelgin uses as the span name
+func (s *ruleSampler) match(p sdktrace.SamplingParameters) sdktrace.Sampler {
+	var method string
+	for _, attr := range p.Attributes {
+		if attr.Key == attribute.Key("http.method") {
+			method = attr.Value.AsString()
+			break
+		}
+	}
+
+	for _, rule := range s.rules {
+		if rule.route == p.Name && (rule.method == "" || rule.method == method) {
+			return rule.sampler
+		}
+	}
+	return s.fallback
+}
+
+func (s *ruleSampler) Description() string {
+	return fmt.Sprintf("RuleSampler{rules:%d,fallback:%s}", len(s.rules), s.fallback.Description())
+}
+
+// keepSlowAndFailed passes sampled spans on and also exports unsampled ones
+// that ended with an error or took at least slow. Children that finish
+// before their request fails are not kept, only the spans that fail or are
+// slow themselves.
+type keepSlowAndFailed struct {
+	sdktrace.SpanProcessor
+	slow time.Duration
+}
+
+func (p *keepSlowAndFailed) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		p.SpanProcessor.OnEnd(s)
+		return
+	}
+	if s.Status().Code == codes.Error || s.EndTime().Sub(s.StartTime()) >= p.slow {
+		p.SpanProcessor.OnEnd(promotedSpan{s})
+	}
+}
+
+// promotedSpan reports an unsampled span as sampled so the batcher exports it
+type promotedSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s promotedSpan) SpanContext() trace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute and log field naming the tenant a request acts for
+const TenantAttribute = "tenant.id"
+
+type tenantKey struct{}
+
+// WithTenant records the tenant a request acts for. The tenant is put on the
+// active span and the context logger; spans started later under the
+// returned context get it from tenantProcessor.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(TenantAttribute, tenant))
+	logger := log.Ctx(ctx).With().Str(TenantAttribute, tenant).Logger()
+	return context.WithValue(logger.WithContext(ctx), tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set by WithTenant, or "" when the
+// request has none
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// tenantProcessor stamps tenant.id on every span started under a tenant
+// context, including the ones created by instrumentation libraries
+type tenantProcessor struct{}
+
+func (tenantProcessor) OnStart(parent context.Context, span sdktrace.ReadWriteSpan) {
+	if tenant := TenantFromContext(parent); tenant != "" {
+		span.SetAttributes(attribute.String(TenantAttribute, tenant))
+	}
+}
+
+func (tenantProcessor) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (tenantProcessor) Shutdown(context.Context) error   { return nil }
+func (tenantProcessor) ForceFlush(context.Context) error { return nil }
+
+// tenantCounter adds tenant.id to every measurement made under a tenant
+// context. Tenants multiply the series of each counter, so it is only used
+// for counters with few other attributes.
+type tenantCounter struct {
+	metric.Int64Counter
+}
+
+func (c tenantCounter) Add(ctx context.Context, incr int64, options ...metric.AddOption) {
+	if tenant := TenantFromContext(ctx); tenant != "" {
+		options = append(options, metric.WithAttributes(attribute.String(TenantAttribute, tenant)))
+	}
+	c.Int64Counter.Add(ctx, incr, options...)
+}
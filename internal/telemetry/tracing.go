@@ -0,0 +1,216 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	otelpyroscope "github.com/grafana/otel-profiling-go"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
+
+	"tracer/internal/buildinfo"
+	"tracer/internal/config"
+)
+
+// Name reported as the instrumentation scope for spans, metrics and logs
+const instrumentationName = "gin-mongo-example"
+
+// NewResource describes this service and its build on exported traces,
+// metrics and logs. Attributes from OTEL_RESOURCE_ATTRIBUTES are included,
+// but the configured service name and version take precedence. The version
+// defaults to the build version.
+func NewResource(cfg config.TracingConfig) (*resource.Resource, error) {
+	build := buildinfo.Get()
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(cfg.ServiceName),
+		semconv.ServiceVersionKey.String(serviceVersion(cfg)),
+		attribute.String("build.version", build.Version),
+		attribute.String("build.commit", build.Commit),
+		attribute.Bool("build.modified", build.Modified),
+		semconv.ProcessRuntimeVersionKey.String(build.GoVersion),
+	}
+	if build.BuildTime != "" {
+		attrs = append(attrs, attribute.String("build.time", build.BuildTime))
+	}
+
+	// WithTelemetrySDK adds the SDK version as telemetry.sdk.version
+	return resource.New(
+		context.Background(),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(attrs...),
+	)
+}
+
+// serviceVersion is the configured version, else the build version
+func serviceVersion(cfg config.TracingConfig) string {
+	if cfg.ServiceVersion != "" {
+		return cfg.ServiceVersion
+	}
+	return buildinfo.Get().Version
+}
+
+// InitTracer registers the global tracer provider exporting through the
+// configured exporter, labelling profiles with spans when span profiles are
+// enabled. The returned function flushes pending spans and gives up when ctx
+// ends, logging how many spans were lost.
+func InitTracer(cfg config.TracingConfig, profiling config.ProfilingConfig, resources *resource.Resource) (func(context.Context) error, error) {
+	spanExporter, closeExporter, err := newSpanExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := withExportHealth(spanExporter, cfg.Exporter)
+	if err != nil {
+		return nil, errors.Join(err, closeExporter())
+	}
+
+	queue := &queueCounter{SpanProcessor: sdktrace.NewBatchSpanProcessor(exporter)}
+	var processor sdktrace.SpanProcessor = queue
+	if cfg.Sampler == config.SamplerRules {
+		processor = &keepSlowAndFailed{SpanProcessor: processor, slow: cfg.SlowThreshold}
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(newSampler(cfg)),
+		sdktrace.WithSpanProcessor(tenantProcessor{}),
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resources),
+	)
+
+	if profiling.ServerAddress != "" && profiling.SpanProfiles {
+		otel.SetTracerProvider(otelpyroscope.NewTracerProvider(provider))
+	} else {
+		otel.SetTracerProvider(provider)
+	}
+	otel.SetTextMapPropagator(newPropagator(cfg.Propagators))
+	return func(ctx context.Context) error {
+		// Flush first so queued spans get the whole deadline to be exported;
+		// Shutdown then only has to stop the processors
+		err := errors.Join(provider.ForceFlush(ctx), provider.Shutdown(ctx), closeExporter())
+
+		if unexported, failed := exporter.reportUnexported(ctx, queue.queued.Load()); unexported > 0 || failed > 0 {
+			log.Warn().Int64("unexported", unexported).Int64("failedExports", failed).Msg("Some spans were never exported")
+		}
+		return err
+	}, nil
+}
+
+// newSpanExporter builds the exporter named in the config. The OTLP
+// exporters connect lazily and reconnect on their own, so an unreachable
+// collector neither delays startup nor stops the service. The returned
+// function releases what the exporter holds beyond its own shutdown, such
+// as the output file.
+func newSpanExporter(cfg config.TracingConfig) (sdktrace.SpanExporter, func() error, error) {
+	noop := func() error { return nil }
+
+	switch cfg.Exporter {
+	case config.TraceExporterOTLPHTTP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithHeaders(cfg.Headers)}
+		if isEndpointURL(cfg.Endpoint) {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		tlsConfig, err := otlpTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case tlsConfig != nil:
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+		case !isSecureEndpoint(cfg.Endpoint):
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		return exporter, noop, err
+	case config.TraceExporterZipkin:
+		exporter, err := zipkin.New(cfg.Endpoint)
+		return exporter, noop, err
+	case config.TraceExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exporter, noop, err
+	case config.TraceExporterFile:
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return exporter, file.Close, nil
+	default:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithHeaders(cfg.Headers)}
+		if isEndpointURL(cfg.Endpoint) {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		tlsConfig, err := otlpTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case tlsConfig != nil:
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		case !isSecureEndpoint(cfg.Endpoint):
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(context.Background(), opts...)
+		return exporter, noop, err
+	}
+}
+
+// Tracer starts spans and rebinds the context logger to each new span
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a Tracer backed by the global tracer provider
+func NewTracer() Tracer {
+	return Tracer{tracer: otel.Tracer(instrumentationName)}
+}
+
+func (t Tracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, name, opts...)
+	return WithLogger(ctx), span
+}
+
+// Middleware traces incoming requests, skipping the excluded paths and,
+// unless tracePreflight is set, CORS preflight requests
+func Middleware(service string, excluded []string, tracePreflight bool) gin.HandlerFunc {
+	return otelgin.Middleware(service, otelgin.WithFilter(traceFilter(excluded, tracePreflight)))
+}
+
+// traceFilter returns an otelgin filter that skips span creation for the given
+// paths and for preflight requests
+func traceFilter(excluded []string, tracePreflight bool) otelgin.Filter {
+	skip := make(map[string]struct{}, len(excluded))
+	for _, path := range excluded {
+		skip[path] = struct{}{}
+	}
+
+	return func(r *http.Request) bool {
+		if !tracePreflight && r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			return false
+		}
+		_, found := skip[r.URL.Path]
+		return !found
+	}
+}
@@ -0,0 +1,75 @@
+package telemetry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTracedRouter serves every path with 200 behind the tracing middleware
+// and records the spans it produces
+func newTracedRouter(t *testing.T, excluded []string, tracePreflight bool) (*gin.Engine, *tracetest.SpanRecorder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	spans := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	router := gin.New()
+	router.Use(Middleware("test", excluded, tracePreflight))
+	router.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.OPTIONS("/users", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	return router, spans
+}
+
+func TestMiddlewareSkipsExcludedPaths(t *testing.T) {
+	tests := []struct {
+		path      string
+		wantSpans int
+	}{
+		{path: "/healthz", wantSpans: 0},
+		{path: "/readyz", wantSpans: 0},
+		{path: "/metrics", wantSpans: 0},
+		{path: "/users", wantSpans: 1},
+		// Only exact paths are excluded
+		{path: "/healthz/extra", wantSpans: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			router, spans := newTracedRouter(t, []string{"/healthz", "/readyz", "/metrics"}, false)
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if got := len(spans.Ended()); got != tt.wantSpans {
+				t.Errorf("spans = %d, want %d", got, tt.wantSpans)
+			}
+		})
+	}
+}
+
+func TestMiddlewareSkipsPreflightUnlessAsked(t *testing.T) {
+	for _, tracePreflight := range []bool{false, true} {
+		router, spans := newTracedRouter(t, nil, tracePreflight)
+
+		req := httptest.NewRequest(http.MethodOptions, "/users", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		want := 0
+		if tracePreflight {
+			want = 1
+		}
+		if got := len(spans.Ended()); got != want {
+			t.Errorf("tracePreflight = %v: spans = %d, want %d", tracePreflight, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// stopHook releases one component within the deadline of ctx
+type stopHook struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// lifecycle stops the server's components in the reverse of the order they
+// were started, like defers, so everything a component depends on is still
+// up while it shuts down. Registering each hook next to the constructor
+// keeps that order in one place instead of a separate shutdown sequence.
+type lifecycle struct {
+	timeout      time.Duration
+	flushTimeout time.Duration
+	hooks        []stopHook
+	flushes      []stopHook
+}
+
+func newLifecycle(timeout, flushTimeout time.Duration) *lifecycle {
+	return &lifecycle{timeout: timeout, flushTimeout: flushTimeout}
+}
+
+// onStop registers stop to run at shutdown, before every hook registered
+// earlier
+func (l *lifecycle) onStop(name string, stop func(ctx context.Context) error) {
+	l.hooks = append(l.hooks, stopHook{name: name, stop: stop})
+}
+
+// onFlush registers a telemetry flush. Flushes run after every onStop hook,
+// newest first, so they export what the components recorded while stopping.
+func (l *lifecycle) onFlush(name string, flush func(ctx context.Context) error) {
+	l.flushes = append(l.flushes, stopHook{name: name, stop: flush})
+}
+
+// stop runs the component hooks under one shared deadline, so shutdown takes
+// at most the timeout however many components there are, and then the
+// flushes under a budget of their own, so a server slow to drain cannot
+// leave them nothing and drop the spans of its final requests. Hooks left
+// when a deadline passes still run, to release what they can at once. A
+// failing hook is logged and does not keep the rest from running.
+func (l *lifecycle) stop() {
+	runHooks(l.hooks, l.timeout)
+	runHooks(l.flushes, l.flushTimeout)
+	l.hooks, l.flushes = nil, nil
+}
+
+// runHooks runs hooks newest first with one deadline of timeout between them
+func runHooks(hooks []stopHook, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hook := hooks[i]
+		if err := hook.stop(ctx); err != nil {
+			log.Error().Err(err).Str("component", hook.name).Msg("Failed to stop component")
+		}
+	}
+}
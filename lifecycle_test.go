@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLifecycleStopsNewestFirstWithFlushesLast(t *testing.T) {
+	var order []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	app := newLifecycle(time.Second, time.Second)
+	app.onFlush("logs", record("logs"))
+	app.onFlush("tracer", record("tracer"))
+	app.onStop("mongo", record("mongo"))
+	app.onStop("http server", record("http server"))
+	app.stop()
+
+	want := []string{"http server", "mongo", "tracer", "logs"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("stop order = %q, want %q", order, want)
+	}
+}
+
+func TestLifecycleContinuesPastFailingHooks(t *testing.T) {
+	stopped := false
+	app := newLifecycle(time.Second, time.Second)
+	app.onStop("mongo", func(context.Context) error {
+		stopped = true
+		return nil
+	})
+	app.onStop("http server", func(context.Context) error { return errors.New("boom") })
+	app.stop()
+
+	if !stopped {
+		t.Error("mongo was not stopped after the http server failed")
+	}
+}
+
+func TestLifecycleSharesOneDeadlineAndReservesTheFlush(t *testing.T) {
+	var deadlines []time.Time
+	var flushErr error
+
+	app := newLifecycle(50*time.Millisecond, time.Second)
+	app.onFlush("tracer", func(ctx context.Context) error {
+		flushErr = ctx.Err()
+		return nil
+	})
+	for _, name := range []string{"mongo", "jobs", "http server"} {
+		app.onStop(name, func(ctx context.Context) error {
+			deadline, _ := ctx.Deadline()
+			deadlines = append(deadlines, deadline)
+			// Each hook runs out the clock, as a stuck component would
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}
+
+	start := time.Now()
+	app.stop()
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("stop took %v, want the components to share one 50ms deadline", elapsed)
+	}
+	for _, deadline := range deadlines[1:] {
+		if !deadline.Equal(deadlines[0]) {
+			t.Errorf("deadlines = %v, want one shared deadline", deadlines)
+			break
+		}
+	}
+	if flushErr != nil {
+		t.Errorf("flush ctx error = %v, want the flush to have its own budget", flushErr)
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+
+	"tracer/internal/config"
+	"tracer/internal/telemetry"
+)
+
+const defaultMix = "create=2,get=4,list=2,update=2,delete=1"
+
+// loadgenOptions are the flags of the loadgen command
+type loadgenOptions struct {
+	target      string
+	rps         float64
+	duration    time.Duration
+	concurrency int
+	mix         string
+	apiKey      string
+	token       string
+	tenant      string
+}
+
+// newLoadgenCommand sends a steady mix of CRUD requests to the users API so
+// Jaeger fills up with realistic traces. Each operation is a root span of its
+// own, with the HTTP client span beneath it and the API's spans beneath that.
+func newLoadgenCommand(loadConfig func() config.Config) *cobra.Command {
+	var opts loadgenOptions
+
+	cmd := &cobra.Command{
+		Use:   "loadgen",
+		Short: "Send a mix of CRUD requests to the API",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return runLoadgen(loadConfig(), opts)
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&opts.target, "target", "", "base URL of the API (default http://localhost:<server.port>)")
+	flags.Float64Var(&opts.rps, "rps", 10, "requests per second")
+	flags.DurationVar(&opts.duration, "duration", 0, "how long to run, 0 runs until interrupted")
+	flags.IntVar(&opts.concurrency, "concurrency", 50, "maximum requests in flight")
+	flags.StringVar(&opts.mix, "mix", defaultMix, "relative weights of the operations")
+	flags.StringVar(&opts.apiKey, "api-key", os.Getenv("LOADGEN_API_KEY"), "sent as X-API-Key")
+	flags.StringVar(&opts.token, "token", os.Getenv("LOADGEN_TOKEN"), "sent as a bearer token")
+	flags.StringVar(&opts.tenant, "tenant", "", "sent as X-Tenant-ID")
+	return cmd
+}
+
+func runLoadgen(cfg config.Config, opts loadgenOptions) error {
+	if opts.rps <= 0 || opts.concurrency <= 0 {
+		return errors.New("--rps and --concurrency must be positive")
+	}
+	ops, err := parseMix(opts.mix)
+	if err != nil {
+		return fmt.Errorf("invalid --mix: %w", err)
+	}
+	if opts.target == "" {
+		opts.target = "http://localhost:" + strconv.Itoa(cfg.Server.Port)
+	}
+
+	shutdownTelemetry := initCommandTelemetry(cfg, "loadgen")
+	defer shutdownTelemetry()
+
+	headers := http.Header{}
+	if opts.apiKey != "" {
+		headers.Set("X-API-Key", opts.apiKey)
+	}
+	if opts.token != "" {
+		headers.Set("Authorization", "Bearer "+opts.token)
+	}
+	if opts.tenant != "" {
+		headers.Set("X-Tenant-ID", opts.tenant)
+	}
+
+	g := &generator{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+		target:  strings.TrimSuffix(opts.target, "/"),
+		headers: headers,
+		tracer:  telemetry.NewTracer(),
+		ops:     ops,
+		counts:  make(map[string]*opCounts, len(ops)),
+	}
+	for _, op := range ops {
+		g.counts[op.name] = &opCounts{}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if opts.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.duration)
+		defer cancel()
+	}
+
+	log.Info().Str("target", g.target).Float64("rps", opts.rps).Str("mix", opts.mix).Msg("Generating load")
+	g.run(ctx, opts.rps, opts.concurrency)
+	g.report()
+	return nil
+}
+
+// operation is one kind of request, picked in proportion to its weight
+type operation struct {
+	name   string
+	weight int
+	run    func(g *generator, ctx context.Context) (int, error)
+}
+
+var operations = map[string]func(g *generator, ctx context.Context) (int, error){
+	"create": (*generator).create,
+	"get":    (*generator).get,
+	"list":   (*generator).list,
+	"update": (*generator).update,
+	"delete": (*generator).remove,
+}
+
+// parseMix reads weights written as create=2,get=4 and so on. Operations
+// left out are not sent.
+func parseMix(mix string) ([]operation, error) {
+	var ops []operation
+	for _, part := range strings.Split(mix, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		run, known := operations[name]
+		if !ok || !known {
+			return nil, fmt.Errorf("%q: expected one of create, get, list, update or delete with a weight", part)
+		}
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%q: weight must be a non-negative integer", part)
+		}
+		if weight > 0 {
+			ops = append(ops, operation{name: name, weight: weight, run: run})
+		}
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("no operation has a positive weight")
+	}
+	return ops, nil
+}
+
+type opCounts struct {
+	sent   atomic.Int64
+	failed atomic.Int64
+}
+
+// knownUser is a user this generator created, with the ETag it last saw
+type knownUser struct {
+	id   string
+	etag string
+}
+
+type generator struct {
+	client  *http.Client
+	target  string
+	headers http.Header
+	tracer  telemetry.Tracer
+	ops     []operation
+	counts  map[string]*opCounts
+	skipped atomic.Int64
+
+	mu    sync.Mutex
+	users []knownUser
+}
+
+// run starts an operation every 1/rps until ctx ends, skipping ticks while
+// concurrency requests are still in flight, then waits for those to finish
+func (g *generator) run(ctx context.Context, rps float64, concurrency int) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rps))
+	defer ticker.Stop()
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			g.skipped.Add(1)
+			continue
+		}
+
+		op := g.pick()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			g.do(op)
+		}()
+	}
+}
+
+func (g *generator) pick() operation {
+	total := 0
+	for _, op := range g.ops {
+		total += op.weight
+	}
+	n := rand.Intn(total)
+	for _, op := range g.ops {
+		if n < op.weight {
+			return op
+		}
+		n -= op.weight
+	}
+	return g.ops[len(g.ops)-1]
+}
+
+// do runs op under a new root span. Server errors and transport failures
+// mark the span as failed; 4xx answers such as a lost ETag race do not.
+func (g *generator) do(op operation) {
+	ctx, span := g.tracer.Start(context.Background(), "loadgen "+op.name)
+	defer span.End()
+	span.SetAttributes(attribute.String("loadgen.operation", op.name))
+
+	counts := g.counts[op.name]
+	counts.sent.Add(1)
+
+	status, err := op.run(g, ctx)
+	if status != 0 {
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+	}
+	if err == nil && status >= http.StatusInternalServerError {
+		err = fmt.Errorf("server answered %d", status)
+	}
+	if err != nil {
+		counts.failed.Add(1)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Ctx(ctx).Warn().Err(err).Str("operation", op.name).Msg("Request failed")
+	}
+}
+
+func (g *generator) create(ctx context.Context) (int, error) {
+	n := rand.Int63()
+	body := map[string]string{
+		"name":  "Load Test " + strconv.FormatInt(n%100000, 10),
+		"email": "loadgen+" + strconv.FormatInt(n, 36) + "@example.com",
+	}
+	var user struct {
+		ID string `json:"id"`
+	}
+	resp, err := g.send(ctx, http.MethodPost, "/users", body, nil, &user)
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		return statusOf(resp), err
+	}
+
+	g.mu.Lock()
+	g.users = append(g.users, knownUser{id: user.ID, etag: resp.Header.Get("ETag")})
+	g.mu.Unlock()
+	return resp.StatusCode, nil
+}
+
+// get reads back a known user, or lists users before any were created
+func (g *generator) get(ctx context.Context) (int, error) {
+	user, ok := g.randomUser()
+	if !ok {
+		return g.list(ctx)
+	}
+	resp, err := g.send(ctx, http.MethodGet, "/users/"+user.id, nil, nil, nil)
+	g.observe(user.id, resp)
+	return statusOf(resp), err
+}
+
+func (g *generator) list(ctx context.Context) (int, error) {
+	resp, err := g.send(ctx, http.MethodGet, "/users?limit=20", nil, nil, nil)
+	return statusOf(resp), err
+}
+
+func (g *generator) update(ctx context.Context) (int, error) {
+	user, ok := g.randomUser()
+	if !ok {
+		return g.create(ctx)
+	}
+	body := map[string]string{"name": "Load Test " + strconv.Itoa(rand.Intn(100000))}
+	resp, err := g.send(ctx, http.MethodPatch, "/users/"+user.id, body, nil, nil)
+	g.observe(user.id, resp)
+	return statusOf(resp), err
+}
+
+// remove deletes a known user with the ETag last seen for it, so racing
+// updates show up as 412 answers
+func (g *generator) remove(ctx context.Context) (int, error) {
+	user, ok := g.randomUser()
+	if !ok {
+		return g.create(ctx)
+	}
+	header := http.Header{"If-Match": {user.etag}}
+	resp, err := g.send(ctx, http.MethodDelete, "/users/"+user.id, nil, header, nil)
+	if resp != nil && (resp.StatusCode < 300 || resp.StatusCode == http.StatusNotFound) {
+		g.forget(user.id)
+	} else {
+		g.observe(user.id, resp)
+	}
+	return statusOf(resp), err
+}
+
+// send makes one request, decoding a successful JSON answer into out when
+// it is not nil. The body is always read so the connection is reused.
+func (g *generator) send(ctx context.Context, method, path string, body any, header http.Header, out any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.target+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range g.headers {
+		req.Header[name] = values
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp, nil
+}
+
+func statusOf(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+func (g *generator) randomUser() (knownUser, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.users) == 0 {
+		return knownUser{}, false
+	}
+	return g.users[rand.Intn(len(g.users))], true
+}
+
+// observe keeps the newest ETag for id, and drops users the API no longer has
+func (g *generator) observe(id string, resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		g.forget(id)
+		return
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range g.users {
+		if g.users[i].id == id {
+			g.users[i].etag = etag
+			return
+		}
+	}
+}
+
+func (g *generator) forget(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range g.users {
+		if g.users[i].id == id {
+			last := len(g.users) - 1
+			g.users[i] = g.users[last]
+			g.users = g.users[:last]
+			return
+		}
+	}
+}
+
+func (g *generator) report() {
+	for _, op := range g.ops {
+		counts := g.counts[op.name]
+		log.Info().Str("operation", op.name).Int64("sent", counts.sent.Load()).Int64("failed", counts.failed.Load()).Msg("Load generated")
+	}
+	if skipped := g.skipped.Load(); skipped > 0 {
+		log.Warn().Int64("skipped", skipped).Msg("Requests skipped while at the concurrency limit")
+	}
+}
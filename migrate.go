@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"tracer/internal/config"
+	"tracer/internal/migrations"
+	"tracer/internal/telemetry"
+)
+
+// runMigrations applies the pending migrations to db within timeout, which
+// is also the lease on the migration lock
+func runMigrations(ctx context.Context, db *mongo.Database, tracer telemetry.Tracer, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := migrations.NewMigrator(db, tracer, migrations.All, timeout).Up(ctx)
+	return err
+}
+
+// newMigrateCommand applies the pending migrations to the configured
+// database and, in database tenancy, to every tenant database
+func newMigrateCommand(loadConfig func() config.Config) *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending schema migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return runMigrate(loadConfig(), dryRun)
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the pending migrations without applying them")
+	return cmd
+}
+
+func runMigrate(cfg config.Config, dryRun bool) error {
+	shutdownTelemetry := initCommandTelemetry(cfg, "migrate")
+	defer shutdownTelemetry()
+	tracer := telemetry.NewTracer()
+
+	client, err := connectMongo(cfg)
+	if err != nil {
+		return err
+	}
+	defer disconnectMongo(client, cfg.Server.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Migrations.Timeout)
+	defer cancel()
+
+	databases := []string{cfg.Mongo.Database}
+	if cfg.Tenancy.Mode == config.TenancyDatabase {
+		prefix := bson.M{"$regex": "^" + regexp.QuoteMeta(cfg.Tenancy.DatabasePrefix)}
+		tenants, err := client.ListDatabaseNames(ctx, bson.M{"name": prefix})
+		if err != nil {
+			return fmt.Errorf("list tenant databases: %w", err)
+		}
+		databases = append(databases, tenants...)
+	}
+
+	for _, name := range databases {
+		db := client.Database(name)
+		if dryRun {
+			pending, err := migrations.NewMigrator(db, tracer, migrations.All, cfg.Migrations.Timeout).Pending(ctx)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			for _, migration := range pending {
+				log.Info().Str("database", name).Int("version", migration.Version).Str("migration", migration.Name).Msg("Pending migration")
+			}
+			continue
+		}
+
+		if err := runMigrations(ctx, db, tracer, cfg.Migrations.Timeout); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
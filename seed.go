@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"tracer/internal/config"
+	"tracer/internal/storage"
+	"tracer/internal/telemetry"
+)
+
+// newSeedCommand loads users from a JSON or CSV fixture file into MongoDB,
+// so demos start from a known dataset. Users whose email is already stored
+// are skipped, so running it twice is harmless.
+//
+// JSON fixtures are an array of {"name": ..., "email": ...} objects. CSV
+// fixtures have a header row naming the name and email columns.
+func newSeedCommand(loadConfig func() config.Config) *cobra.Command {
+	var file, tenant string
+	var batchSize int
+
+	cmd := &cobra.Command{
+		Use:   "seed --file users.json",
+		Short: "Load user fixtures into MongoDB",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return runSeed(loadConfig(), file, tenant, batchSize)
+		},
+	}
+	cmd.Flags().StringVar(&file, "file", "", "fixture file, .json or .csv")
+	cmd.Flags().IntVar(&batchSize, "batch-size", 500, "users written per bulk write")
+	cmd.Flags().StringVar(&tenant, "tenant", "", "tenant to seed when tenancy is enabled")
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+func runSeed(cfg config.Config, file, tenant string, batchSize int) error {
+	if batchSize <= 0 {
+		return errors.New("--batch-size must be positive")
+	}
+	if tenant != "" && cfg.Tenancy.Mode == config.TenancyOff {
+		return errors.New("--tenant needs tenancy.mode to be set")
+	}
+
+	users, err := readFixtures(file)
+	if err != nil {
+		return fmt.Errorf("read fixtures from %s: %w", file, err)
+	}
+
+	shutdownTelemetry := initCommandTelemetry(cfg, "seed")
+	defer shutdownTelemetry()
+	tracer := telemetry.NewTracer()
+
+	client, err := connectMongo(cfg)
+	if err != nil {
+		return err
+	}
+	defer disconnectMongo(client, cfg.Server.ShutdownTimeout)
+
+	// Seeding relies on the unique email index to stay idempotent
+	ensureIndexes := func(ctx context.Context, db *mongo.Database) error {
+		ctx, cancel := context.WithTimeout(ctx, cfg.Mongo.OperationTimeout)
+		defer cancel()
+		return storage.EnsureIndexes(ctx, db.Collection("users"), cfg.Server.CollationLocale, cfg.Tenancy.Mode == config.TenancyFilter)
+	}
+
+	db := client.Database(cfg.Mongo.Database)
+	if err := ensureIndexes(context.Background(), db); err != nil {
+		return fmt.Errorf("create indexes: %w", err)
+	}
+
+	var tenancy *storage.Tenancy
+	switch cfg.Tenancy.Mode {
+	case config.TenancyFilter:
+		tenancy = storage.NewFilterTenancy()
+	case config.TenancyDatabase:
+		tenancy = storage.NewDatabaseTenancy(client, cfg.Tenancy.DatabasePrefix, cfg.Mongo.OperationTimeout, ensureIndexes)
+	}
+
+	repo := storage.NewMongoUserRepository(db.Collection("users"), tracer, cfg.Mongo.OperationTimeout,
+		cfg.Server.CollationLocale, storage.RetryPolicy{}, tenancy)
+
+	ctx, span := tracer.Start(context.Background(), "seed users")
+	span.SetAttributes(
+		attribute.String("seed.file", filepath.Base(file)),
+		attribute.String("tenant.id", tenant),
+	)
+	if tenant != "" {
+		ctx = telemetry.WithTenant(ctx, tenant)
+	}
+
+	result, err := repo.Seed(ctx, users, batchSize)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	log.Ctx(ctx).Info().Int("users", len(users)).Int64("inserted", result.Inserted).Int64("existing", result.Existing).Msg("Seeding finished")
+	if err != nil {
+		return fmt.Errorf("seed users: %w", err)
+	}
+	return nil
+}
+
+// readFixtures loads and validates the users in path, picking the format
+// from its extension
+func readFixtures(path string) ([]storage.User, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var users []storage.User
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		users, err = readJSON(f)
+	case ".csv":
+		users, err = readCSV(f)
+	default:
+		return nil, errors.New("fixture files must end in .json or .csv")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, user := range users {
+		if err := validateFixture(user); err != nil {
+			return nil, fmt.Errorf("user %d: %w", i+1, err)
+		}
+	}
+	return users, nil
+}
+
+func readJSON(r io.Reader) ([]storage.User, error) {
+	var fixtures []struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r).Decode(&fixtures); err != nil {
+		return nil, err
+	}
+
+	users := make([]storage.User, len(fixtures))
+	for i, fixture := range fixtures {
+		users[i] = storage.User{Name: strings.TrimSpace(fixture.Name), Email: strings.TrimSpace(fixture.Email)}
+	}
+	return users, nil
+}
+
+func readCSV(r io.Reader) ([]storage.User, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	nameCol, emailCol := -1, -1
+	for i, column := range rows[0] {
+		switch strings.ToLower(strings.TrimSpace(column)) {
+		case "name":
+			nameCol = i
+		case "email":
+			emailCol = i
+		}
+	}
+	if nameCol < 0 || emailCol < 0 {
+		return nil, errors.New("the header row must name a name and an email column")
+	}
+
+	users := make([]storage.User, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		users = append(users, storage.User{Name: strings.TrimSpace(row[nameCol]), Email: strings.TrimSpace(row[emailCol])})
+	}
+	return users, nil
+}
+
+// validateFixture applies the rules POST /users enforces
+func validateFixture(user storage.User) error {
+	if user.Name == "" || len(user.Name) > 100 {
+		return errors.New("name must be 1 to 100 characters")
+	}
+	if len(user.Email) > 254 {
+		return errors.New("email must be at most 254 characters")
+	}
+	if _, err := mail.ParseAddress(user.Email); err != nil {
+		return fmt.Errorf("email %q is not a valid address", user.Email)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+)
+
+// serve runs srv until SIGINT or SIGTERM arrives, or until a server sends
+// to failed, then sets draining so new requests are turned away. It returns
+// the failure, if any. The server itself is stopped by shutdownHTTP, as a
+// lifecycle hook.
+func serve(srv *http.Server, timeout time.Duration, draining *atomic.Bool, failed chan error) error {
+	go func() {
+		var err error
+		if srv.TLSConfig != nil {
+			// The certificate comes from TLSConfig.GetCertificate
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			failed <- fmt.Errorf("start server: %w", err)
+		}
+	}()
+	log.Info().Str("addr", srv.Addr).Bool("tls", srv.TLSConfig != nil).Msg("Server started")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-failed:
+	}
+	stop()
+
+	log.Info().Dur("timeout", timeout).Msg("Shutting down server")
+	draining.Store(true)
+	return err
+}
+
+// shutdownHTTP stops accepting connections and waits for in-flight
+// requests to finish until ctx is done
+func shutdownHTTP(ctx context.Context, srv *http.Server) error {
+	if err := srv.Shutdown(ctx); err != nil {
+		// Long-lived streams (watch, export) may still be open, so cut them off
+		log.Warn().Err(err).Msg("Timed out draining requests, closing remaining connections")
+		return srv.Close()
+	}
+
+	log.Info().Msg("Server stopped")
+	return nil
+}
+
+// serveGRPC starts srv on addr in the background, reporting to failed if
+// it stops serving before it is shut down
+func serveGRPC(srv *grpc.Server, addr string, failed chan<- error) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen for gRPC: %w", err)
+	}
+
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			failed <- fmt.Errorf("start gRPC server: %w", err)
+		}
+	}()
+	log.Info().Str("addr", addr).Msg("gRPC server started")
+	return nil
+}
+
+// stopGRPC lets in-flight calls finish until ctx is done, then closes the
+// remaining connections
+func stopGRPC(ctx context.Context, srv *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		log.Info().Msg("gRPC server stopped")
+	case <-ctx.Done():
+		log.Warn().Msg("Timed out draining gRPC calls, closing remaining connections")
+		srv.Stop()
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"tracer/internal/config"
+)
+
+// certReloader hands out the certificate in certFile and keyFile, loading it
+// again when either file changes so a rotated certificate is used without a
+// restart. Connections already open keep the certificate they started with.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	stop     chan struct{}
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, stop: make(chan struct{})}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// newServerTLS returns the TLS settings for the REST API and the reloader
+// behind them, which is already watching the files when cfg asks for it
+func newServerTLS(cfg config.ServerTLSConfig) (*tls.Config, *certReloader, error) {
+	certs, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.ReloadInterval > 0 {
+		go certs.watch(cfg.ReloadInterval)
+	}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.getCertificate,
+	}, certs, nil
+}
+
+func (r *certReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// latestModTime is the most recent modification time of the two files
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// watch checks the files every interval until Close. A certificate that
+// fails to load is logged and the previous one stays in use.
+func (r *certReloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		modTime, err := r.latestModTime()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to check TLS certificate")
+			continue
+		}
+		r.mu.RLock()
+		changed := modTime.After(r.modTime)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if err := r.load(); err != nil {
+			log.Error().Err(err).Msg("Failed to reload TLS certificate, keeping the previous one")
+			continue
+		}
+		log.Info().Str("certFile", r.certFile).Msg("TLS certificate reloaded")
+	}
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Close stops watching the files
+func (r *certReloader) Close() {
+	close(r.stop)
+}
+
+// newRedirectServer answers plain HTTP requests on port with a permanent
+// redirect to the same URL over HTTPS on httpsPort
+func newRedirectServer(port, httpsPort int, readHeaderTimeout time.Duration) *http.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		// 308 keeps the method and body of non-GET requests
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+
+	return &http.Server{Addr: ":" + strconv.Itoa(port), Handler: handler, ReadHeaderTimeout: readHeaderTimeout}
+}
+
+// serveRedirect starts srv in the background, reporting to failed if it
+// stops serving before it is closed
+func serveRedirect(srv *http.Server, failed chan<- error) {
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			failed <- fmt.Errorf("start HTTPS redirect server: %w", err)
+		}
+	}()
+	log.Info().Str("addr", srv.Addr).Msg("HTTPS redirect server started")
+}